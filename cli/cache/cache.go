@@ -0,0 +1,311 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xschemadev/xschema/internal/atomicfile"
+	"github.com/xschemadev/xschema/ui"
+)
+
+const (
+	blobsDir   = "blobs"   // content-addressed response bodies: blobs/<sha256>
+	urlsDir    = "urls"    // one JSON entry per URL: urls/<sha256(url)>.json
+	outputsDir = "outputs" // generated adapter outputs: outputs/<key>.json
+)
+
+var storeDirs = []string{blobsDir, urlsDir, outputsDir}
+
+// Entry describes a cached URL response
+type Entry struct {
+	URL          string    `json:"url"`
+	Digest       string    `json:"digest"` // hex SHA-256 of the body, names the blob
+	Size         int       `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"` // last time the body was fetched or revalidated
+}
+
+// Fresh reports whether the entry can be used without revalidation
+func (e Entry) Fresh(ttl time.Duration, now time.Time) bool {
+	return ttl > 0 && now.Sub(e.FetchedAt) < ttl
+}
+
+// Store is an on-disk, content-addressed cache of URL responses and of the
+// code adapters generated from schemas
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns the per-user cache directory, e.g. ~/.cache/xschema
+func DefaultDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate user cache directory: %w", err)
+	}
+	return filepath.Join(base, "xschema"), nil
+}
+
+// Open returns a store rooted at dir, creating it if needed
+func Open(dir string) (*Store, error) {
+	for _, sub := range storeDirs {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the root directory of the store
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Digest returns the hex SHA-256 of data
+func Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) entryPath(url string) string {
+	return filepath.Join(s.dir, urlsDir, Digest([]byte(url))+".json")
+}
+
+func (s *Store) blobPath(digest string) string {
+	return filepath.Join(s.dir, blobsDir, digest)
+}
+
+// Lookup returns the cached entry and body for url
+// Returns nil entry on a miss; a corrupt entry or blob is treated as a miss
+func (s *Store) Lookup(url string) (*Entry, []byte, error) {
+	data, err := os.ReadFile(s.entryPath(url))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read cache entry for %s: %w", url, err)
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.URL != url {
+		ui.Verbosef("ignoring corrupt cache entry: url=%s", url)
+		return nil, nil, nil
+	}
+
+	body, ok := s.Blob(entry.Digest)
+	if !ok {
+		ui.Verbosef("ignoring missing or corrupt cache blob: url=%s, digest=%s", url, entry.Digest)
+		return nil, nil, nil
+	}
+
+	return &entry, body, nil
+}
+
+// Blob returns the content stored under digest, verifying it still matches
+func (s *Store) Blob(digest string) ([]byte, bool) {
+	body, err := os.ReadFile(s.blobPath(digest))
+	if err != nil || Digest(body) != digest {
+		return nil, false
+	}
+	return body, true
+}
+
+// Put stores body for url along with its validators
+func (s *Store) Put(url string, body []byte, etag, lastModified string, fetchedAt time.Time) (*Entry, error) {
+	entry := Entry{
+		URL:          url,
+		Digest:       Digest(body),
+		Size:         len(body),
+		ETag:         etag,
+		LastModified: lastModified,
+		FetchedAt:    fetchedAt,
+	}
+
+	// Blob first, so an entry never points at a missing blob
+	if _, err := os.Stat(s.blobPath(entry.Digest)); err != nil {
+		if err := atomicfile.WriteFile(s.blobPath(entry.Digest), body); err != nil {
+			return nil, fmt.Errorf("failed to write cache blob for %s: %w", url, err)
+		}
+	}
+	if err := s.writeEntry(entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Touch records a successful revalidation (HTTP 304) of an existing entry
+func (s *Store) Touch(entry Entry, fetchedAt time.Time) error {
+	entry.FetchedAt = fetchedAt
+	return s.writeEntry(entry)
+}
+
+func (s *Store) writeEntry(entry Entry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry for %s: %w", entry.URL, err)
+	}
+	if err := atomicfile.WriteFile(s.entryPath(entry.URL), data); err != nil {
+		return fmt.Errorf("failed to write cache entry for %s: %w", entry.URL, err)
+	}
+	return nil
+}
+
+func (s *Store) outputPath(key string) string {
+	return filepath.Join(s.dir, outputsDir, key+".json")
+}
+
+// Output returns the adapter output stored under key, a hex digest chosen by
+// the caller. A hit counts as a use, so Prune keeps outputs still in use.
+func (s *Store) Output(key string) ([]byte, bool) {
+	p := s.outputPath(key)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(p, now, now)
+	return data, true
+}
+
+// PutOutput stores an adapter output under key
+func (s *Store) PutOutput(key string, data []byte) error {
+	if err := atomicfile.WriteFile(s.outputPath(key), data); err != nil {
+		return fmt.Errorf("failed to write cached output %s: %w", key, err)
+	}
+	return nil
+}
+
+// OutputStats returns the number and total size of cached adapter outputs
+func (s *Store) OutputStats() (count, size int, err error) {
+	files, err := os.ReadDir(filepath.Join(s.dir, outputsDir))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list cached outputs: %w", err)
+	}
+	for _, f := range files {
+		if info, err := f.Info(); err == nil && !f.IsDir() {
+			count++
+			size += int(info.Size())
+		}
+	}
+	return count, size, nil
+}
+
+// Entries returns all URL entries sorted by URL
+func (s *Store) Entries() ([]Entry, error) {
+	files, err := os.ReadDir(filepath.Join(s.dir, urlsDir))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache entries: %w", err)
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, urlsDir, f.Name()))
+		if err != nil {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	return entries, nil
+}
+
+// Clear removes every entry, blob and output
+func (s *Store) Clear() error {
+	for _, sub := range storeDirs {
+		if err := os.RemoveAll(filepath.Join(s.dir, sub)); err != nil {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Join(s.dir, sub), 0755); err != nil {
+			return fmt.Errorf("failed to clear cache: %w", err)
+		}
+	}
+	return nil
+}
+
+// PruneResult reports what Prune removed
+type PruneResult struct {
+	Entries int // expired URL entries removed
+	Blobs   int // unreferenced blobs removed
+	Outputs int // adapter outputs removed
+	Bytes   int // total blob and output bytes reclaimed
+}
+
+// Prune removes entries not fetched or revalidated within maxAge, then any
+// blob no longer referenced by an entry, then outputs not used within maxAge.
+// A zero maxAge only removes orphans.
+func (s *Store) Prune(maxAge time.Duration, now time.Time) (PruneResult, error) {
+	var result PruneResult
+
+	entries, err := s.Entries()
+	if err != nil {
+		return result, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, e := range entries {
+		if maxAge > 0 && now.Sub(e.FetchedAt) >= maxAge {
+			if err := os.Remove(s.entryPath(e.URL)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return result, fmt.Errorf("failed to remove cache entry for %s: %w", e.URL, err)
+			}
+			result.Entries++
+			continue
+		}
+		referenced[e.Digest] = true
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(s.dir, blobsDir))
+	if err != nil {
+		return result, fmt.Errorf("failed to list cache blobs: %w", err)
+	}
+	for _, b := range blobs {
+		if b.IsDir() || referenced[b.Name()] {
+			continue
+		}
+		info, err := b.Info()
+		if err == nil {
+			result.Bytes += int(info.Size())
+		}
+		if err := os.Remove(s.blobPath(b.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return result, fmt.Errorf("failed to remove cache blob %s: %w", b.Name(), err)
+		}
+		result.Blobs++
+	}
+
+	if maxAge <= 0 {
+		return result, nil
+	}
+	outputs, err := os.ReadDir(filepath.Join(s.dir, outputsDir))
+	if err != nil {
+		return result, fmt.Errorf("failed to list cached outputs: %w", err)
+	}
+	for _, o := range outputs {
+		info, err := o.Info()
+		if err != nil || o.IsDir() || now.Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, outputsDir, o.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return result, fmt.Errorf("failed to remove cached output %s: %w", o.Name(), err)
+		}
+		result.Outputs++
+		result.Bytes += int(info.Size())
+	}
+
+	return result, nil
+}
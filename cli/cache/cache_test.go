@@ -0,0 +1,233 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorePutLookup(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	url := "https://example.com/user.json"
+	body := []byte(`{"type": "object"}`)
+	now := time.Now()
+
+	entry, got, err := store.Lookup(url)
+	if err != nil || entry != nil || got != nil {
+		t.Fatalf("expected miss, got entry=%v body=%s err=%v", entry, got, err)
+	}
+
+	if _, err := store.Put(url, body, `"abc"`, "Mon, 02 Jan 2006 15:04:05 GMT", now); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	entry, got, err = store.Lookup(url)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if entry == nil {
+		t.Fatal("expected hit, got miss")
+	}
+	if string(got) != string(body) {
+		t.Errorf("body mismatch: %s", got)
+	}
+	if entry.ETag != `"abc"` || entry.LastModified == "" {
+		t.Errorf("validators not stored: %+v", entry)
+	}
+	if entry.Digest != Digest(body) || entry.Size != len(body) {
+		t.Errorf("unexpected digest/size: %+v", entry)
+	}
+}
+
+func TestStoreContentAddressed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	body := []byte(`{"type": "string"}`)
+	now := time.Now()
+	store.Put("https://a.example.com/s.json", body, "", "", now)
+	store.Put("https://b.example.com/s.json", body, "", "", now)
+
+	blobs, err := os.ReadDir(filepath.Join(dir, blobsDir))
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(blobs) != 1 {
+		t.Errorf("expected identical bodies to share 1 blob, got %d", len(blobs))
+	}
+
+	entries, err := store.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].URL != "https://a.example.com/s.json" {
+		t.Errorf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestStoreCorruptBlobIsMiss(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	url := "https://example.com/user.json"
+	entry, err := store.Put(url, []byte(`{}`), "", "", time.Now())
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, blobsDir, entry.Digest), []byte(`{"tampered": true}`), 0644); err != nil {
+		t.Fatalf("failed to tamper blob: %v", err)
+	}
+
+	got, _, err := store.Lookup(url)
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if got != nil {
+		t.Error("expected corrupt blob to be treated as a miss")
+	}
+}
+
+func TestEntryFresh(t *testing.T) {
+	now := time.Now()
+	e := Entry{FetchedAt: now.Add(-30 * time.Minute)}
+
+	if !e.Fresh(time.Hour, now) {
+		t.Error("expected entry within TTL to be fresh")
+	}
+	if e.Fresh(10*time.Minute, now) {
+		t.Error("expected entry past TTL to be stale")
+	}
+	if e.Fresh(0, now) {
+		t.Error("expected zero TTL to always revalidate")
+	}
+}
+
+func TestStoreTouch(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	url := "https://example.com/user.json"
+	old := time.Now().Add(-2 * time.Hour)
+	entry, _ := store.Put(url, []byte(`{}`), `"v1"`, "", old)
+
+	now := time.Now()
+	if err := store.Touch(*entry, now); err != nil {
+		t.Fatalf("Touch failed: %v", err)
+	}
+	entry, _, _ = store.Lookup(url)
+	if !entry.FetchedAt.Equal(now) {
+		t.Errorf("expected FetchedAt to be updated, got %v", entry.FetchedAt)
+	}
+	if entry.ETag != `"v1"` {
+		t.Errorf("expected ETag to be kept, got %q", entry.ETag)
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	now := time.Now()
+	store.Put("https://example.com/old.json", []byte(`{"old": true}`), "", "", now.Add(-48*time.Hour))
+	store.Put("https://example.com/new.json", []byte(`{"new": true}`), "", "", now)
+	// Orphan blob left behind by an entry that was overwritten
+	store.Put("https://example.com/changed.json", []byte(`{"v": 1}`), "", "", now)
+	store.Put("https://example.com/changed.json", []byte(`{"v": 2}`), "", "", now)
+
+	result, err := store.Prune(24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if result.Entries != 1 {
+		t.Errorf("expected 1 expired entry removed, got %d", result.Entries)
+	}
+	if result.Blobs != 2 {
+		t.Errorf("expected 2 blobs removed, got %d", result.Blobs)
+	}
+
+	entries, _ := store.Entries()
+	if len(entries) != 2 {
+		t.Errorf("expected 2 entries left, got %d", len(entries))
+	}
+	if e, _, _ := store.Lookup("https://example.com/changed.json"); e == nil {
+		t.Error("expected live entry to survive prune")
+	}
+}
+
+func TestStoreClear(t *testing.T) {
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	store.Put("https://example.com/user.json", []byte(`{}`), "", "", time.Now())
+
+	if err := store.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	entries, err := store.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed after clear: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected empty cache, got %d entries", len(entries))
+	}
+}
+
+func TestStoreOutputs(t *testing.T) {
+	dir := t.TempDir()
+	store, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if _, ok := store.Output("abc"); ok {
+		t.Fatal("expected miss")
+	}
+	if err := store.PutOutput("abc", []byte(`{"id": "A"}`)); err != nil {
+		t.Fatalf("PutOutput failed: %v", err)
+	}
+	if err := store.PutOutput("old", []byte(`{"id": "B"}`)); err != nil {
+		t.Fatalf("PutOutput failed: %v", err)
+	}
+	if got, ok := store.Output("abc"); !ok || string(got) != `{"id": "A"}` {
+		t.Errorf("Output = %s, %v", got, ok)
+	}
+
+	// Outputs not used within maxAge are pruned
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(dir, outputsDir, "old.json"), old, old)
+	result, err := store.Prune(24*time.Hour, now)
+	if err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if result.Outputs != 1 {
+		t.Errorf("expected 1 output removed, got %d", result.Outputs)
+	}
+	if count, _, _ := store.OutputStats(); count != 1 {
+		t.Errorf("expected 1 output left, got %d", count)
+	}
+
+	if err := store.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if _, ok := store.Output("abc"); ok {
+		t.Error("expected outputs to be cleared")
+	}
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xschemadev/xschema/cache"
+	"github.com/xschemadev/xschema/generator"
+	"github.com/xschemadev/xschema/lockfile"
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+)
+
+var (
+	cacheDir string
+	cacheTTL time.Duration
+	noCache  bool
+	offline  bool
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the on-disk schema and output cache",
+}
+
+var cacheLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List cached URL schemas",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheLs,
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every cached schema and output",
+	Args:  cobra.NoArgs,
+	RunE:  runCacheClear,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached schemas and outputs older than --cache-ttl and unreferenced data",
+	Args:  cobra.NoArgs,
+	RunE:  runCachePrune,
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheLsCmd, cacheClearCmd, cachePruneCmd)
+
+	cacheCmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "", "schema cache directory (default: user cache dir, e.g. ~/.cache/xschema)")
+	cachePruneCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", retriever.DefaultOptions().CacheTTL, "remove entries not fetched or revalidated within this duration")
+
+	addCacheFlags(generateCmd)
+	addCacheFlags(checkCmd)
+
+	for _, cmd := range []*cobra.Command{generateCmd, checkCmd} {
+		cmd.Flags().BoolVar(&offline, "offline", false, "never access the network; serve URL schemas from the cache or "+lockfile.FileName+" only")
+	}
+}
+
+// addCacheFlags registers the flags that control the on-disk schema cache
+func addCacheFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "schema cache directory, relative to the project root (default: user cache dir, e.g. ~/.cache/xschema)")
+	cmd.Flags().DurationVar(&cacheTTL, "cache-ttl", retriever.DefaultOptions().CacheTTL, "how long cached URL schemas are used before revalidating (0 always revalidates)")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "bypass the schema and output caches: fetch and generate everything")
+}
+
+// resolveCacheDir returns the cache directory from --cache-dir, relative to root
+func resolveCacheDir(root string) (string, error) {
+	if cacheDir == "" {
+		return cache.DefaultDir()
+	}
+	if filepath.IsAbs(cacheDir) {
+		return cacheDir, nil
+	}
+	return filepath.Join(root, cacheDir), nil
+}
+
+// retrieverOptions builds retriever options from the command line flags
+func retrieverOptions(root string) (retriever.Options, error) {
+	opts := retriever.DefaultOptions()
+	opts.NoCache = noCache
+	opts.CacheTTL = cacheTTL
+	opts.Offline = offline
+
+	refs, err := retriever.ParseRefMode(refMode)
+	if err != nil {
+		return opts, err
+	}
+	opts.Refs = refs
+
+	if offline && noCache {
+		return opts, fmt.Errorf("--offline cannot be combined with --no-cache")
+	}
+
+	if !noCache {
+		dir, err := resolveCacheDir(root)
+		if err != nil {
+			return opts, err
+		}
+		opts.CacheDir = dir
+	}
+
+	if offline {
+		// Locked digests let offline runs reproduce exactly what was pinned
+		lock, err := lockfile.Load(filepath.Join(root, lockfile.FileName))
+		if err != nil {
+			return opts, err
+		}
+		opts.Pinned = make(map[string]string, len(lock.Schemas))
+		for key, entry := range lock.Schemas {
+			opts.Pinned[key] = entry.SHA256
+		}
+	}
+	return opts, nil
+}
+
+// outputCache opens the cache of adapter outputs, kept in the schema cache
+// directory. Returns nil (cache nothing) with --no-cache.
+func outputCache(opts retriever.Options) (*generator.OutputCache, error) {
+	if opts.CacheDir == "" {
+		return nil, nil
+	}
+	store, err := cache.Open(opts.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	return generator.NewOutputCache(store), nil
+}
+
+// fetchHints suggests how to recover from a retrieval error
+func fetchHints(err error) []string {
+	var offlineErr *retriever.OfflineError
+	if errors.As(err, &offlineErr) {
+		return []string{"run once without --offline to populate the cache, or `xschema lock update` to pin URL schemas"}
+	}
+	return nil
+}
+
+// openCache opens the store selected by --cache-dir for the cache subcommands
+func openCache() (*cache.Store, error) {
+	root, _, err := resolveDirs()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := resolveCacheDir(root)
+	if err != nil {
+		return nil, err
+	}
+	return cache.Open(dir)
+}
+
+func runCacheLs(cmd *cobra.Command, args []string) error {
+	store, err := openCache()
+	if err != nil {
+		return err
+	}
+
+	entries, err := store.Entries()
+	if err != nil {
+		return err
+	}
+
+	outputs, outputBytes, err := store.OutputStats()
+	if err != nil {
+		return err
+	}
+
+	ui.Printf("  Cache: %s\n", ui.Primary.Render(store.Dir()))
+	ui.Println()
+
+	if len(entries) == 0 && outputs == 0 {
+		ui.Println(ui.Dim.Render("  (empty)"))
+		return nil
+	}
+
+	total := 0
+	for _, e := range entries {
+		total += e.Size
+		ui.Printf("  %s\n", e.URL)
+		details := fmt.Sprintf("%s, fetched %s, sha256:%s", ui.FormatBytes(e.Size),
+			e.FetchedAt.Local().Format(time.DateTime), e.Digest[:12])
+		if e.ETag != "" {
+			details += ", etag " + e.ETag
+		}
+		ui.Printf("    %s\n", ui.Dim.Render(details))
+	}
+	ui.Println()
+	ui.Printf("  %d entries, %s\n", len(entries), ui.FormatBytes(total))
+	ui.Printf("  %d generated outputs, %s\n", outputs, ui.FormatBytes(outputBytes))
+	return nil
+}
+
+func runCacheClear(cmd *cobra.Command, args []string) error {
+	store, err := openCache()
+	if err != nil {
+		return err
+	}
+	if err := store.Clear(); err != nil {
+		ui.ErrorMsg("Failed to clear cache", err)
+		return err
+	}
+	ui.SuccessMsg(fmt.Sprintf("Cleared %s", store.Dir()))
+	return nil
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	store, err := openCache()
+	if err != nil {
+		return err
+	}
+	result, err := store.Prune(cacheTTL, time.Now())
+	if err != nil {
+		ui.ErrorMsg("Failed to prune cache", err)
+		return err
+	}
+	ui.SuccessMsg(fmt.Sprintf("Pruned %d entries, %d blobs and %d outputs (%s)",
+		result.Entries, result.Blobs, result.Outputs, ui.FormatBytes(result.Bytes)))
+	return nil
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	"github.com/xschemadev/xschema/generator"
+	"github.com/xschemadev/xschema/injector"
+	"github.com/xschemadev/xschema/lockfile"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+)
+
+// errStale is returned when the generated output does not match what generate would write
+var errStale = errors.New("generated output is out of date")
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Verify generated validators are up to date without writing anything",
+	Long: `Runs the full generate pipeline in memory and compares the result with the
+generated file of each language. Exits non-zero and prints a unified
+diff when they differ, so it can be used as a CI gate.`,
+	RunE:         runCheck,
+	SilenceUsage: true,
+}
+
+func init() {
+	rootCmd.AddCommand(checkCmd)
+
+	checkCmd.Flags().StringVarP(&projectDir, "project", "p", "", "project root directory (default: current directory)")
+	checkCmd.Flags().StringVarP(&outputDir, "output", "o", "", outputFlagUsage)
+	checkCmd.Flags().StringVar(&langFilter, "lang", "", "only check this language's configs")
+	checkCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	checkCmd.Flags().StringVar(&outputLayout, "layout", string(injector.LayoutSingle), layoutFlagUsage)
+	checkCmd.Flags().StringVar(&refMode, "refs", string(retriever.RefsDefs), "how $refs are bundled: \"defs\" embeds referenced schemas under $defs, \"inline\" copies them in place")
+	addAdapterFlags(checkCmd)
+}
+
+func runCheck(cmd *cobra.Command, args []string) error {
+	start := time.Now()
+
+	ui.SetVerbose(verbose)
+
+	ctx := cmd.Context()
+
+	root, outDir, err := resolveDirs()
+	if err != nil {
+		return err
+	}
+	if _, err := injector.ParseLayout(outputLayout); err != nil {
+		return err
+	}
+
+	retrieverOpts, err := retrieverOptions(root)
+	if err != nil {
+		return err
+	}
+
+	// Step 1: Parse config files
+	ui.Step(1, 4, "Scanning for xschema config files")
+	result, err := parser.Parse(ctx, root, langFilter, retriever.DocumentLoader(retrieverOpts))
+	if err != nil {
+		ui.ErrorMsg("Failed to parse config files", err)
+		return err
+	}
+	ui.Detail(fmt.Sprintf("Found %d config files, %d schemas (%s)",
+		len(result.Configs), len(result.Declarations), languageNames(result)))
+
+	if len(result.Declarations) == 0 {
+		// Files generated for declarations since deleted are still out of date
+		stale := false
+		for _, run := range languageRuns(result, nil, root, outDir) {
+			ok, err := checkStaleFiles(root, run.injectInput(), nil, "Nothing generates it any more; delete it and commit the result")
+			if err != nil {
+				return err
+			}
+			stale = stale || !ok
+		}
+		if stale {
+			return errStale
+		}
+		ui.WarnMsg("No schema declarations found")
+		return nil
+	}
+	overrides, err := adapterOverrides(result)
+	if err != nil {
+		ui.ErrorMsg("Invalid adapter override", err)
+		return err
+	}
+
+	// Step 2: Fetch schemas
+	ui.Step(2, 4, "Fetching schemas")
+	var schemas []retriever.RetrievedSchema
+	err = ui.RunWithSpinner("Fetching schemas...", func() error {
+		var fetchErr error
+		schemas, fetchErr = retriever.Retrieve(ctx, result.Declarations, retrieverOpts)
+		return fetchErr
+	})
+	if err != nil {
+		ui.ErrorMsg("Failed to fetch schemas", err, fetchHints(err)...)
+		return err
+	}
+
+	// The lockfile must already pin exactly what was fetched
+	_, lockRes, err := reconcileLock(root, result.Declarations, schemas, nil)
+	if err != nil {
+		ui.ErrorMsg("Failed to read lockfile", err)
+		return err
+	}
+	if len(lockRes.Drift) > 0 {
+		err := driftError(lockRes.Drift)
+		ui.ErrorMsg("Locked schemas changed upstream", err, "Review the upstream changes, then run `xschema lock update`")
+		return err
+	}
+	if lockRes.Changed() {
+		var keys []string
+		keys = append(keys, lockRes.Added...)
+		keys = append(keys, lockRes.Removed...)
+		keys = append(keys, lockRes.Moved...)
+		ui.ErrorMsg(fmt.Sprintf("%s is out of date", lockfile.FileName), fmt.Errorf("entries to add or remove: %s", strings.Join(keys, ", ")),
+			"Run `xschema generate` and commit the result")
+		return errStale
+	}
+
+	// Step 3: Generate
+	ui.Step(3, 4, "Generating validators")
+	outCache, err := outputCache(retrieverOpts)
+	if err != nil {
+		ui.ErrorMsg("Failed to open output cache", err)
+		return err
+	}
+	runs := languageRuns(result, schemas, root, outDir)
+	for i := range runs {
+		run := &runs[i]
+		if err := preflight(ctx, run.schemas, run.lang.Name, outCache, overrides); err != nil {
+			return err
+		}
+		err = ui.RunWithSpinner(fmt.Sprintf("Running %s adapters...", run.lang.Name), func() error {
+			var genErr error
+			run.outputs, genErr = generator.GenerateAll(ctx, run.schemas, run.lang.Name, generator.Options{
+				Cache:     outCache,
+				Timeout:   adapterTimeout,
+				MaxOutput: maxAdapterOutput,
+				Overrides: overrides,
+			})
+			return genErr
+		})
+		if err != nil {
+			ui.ErrorMsg("Generation failed", err, "Make sure the adapter is installed")
+			return err
+		}
+		printWarnings(*run)
+	}
+
+	// Step 4: Render in memory and compare
+	ui.Step(4, 4, "Comparing with generated output")
+	var upToDate []string
+	stale := false
+	for _, run := range runs {
+		displayPaths, ok, err := compareOutput(root, run.injectInput())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			stale = true
+			continue
+		}
+		upToDate = append(upToDate, displayPaths...)
+	}
+	if stale {
+		return errStale
+	}
+	verb := "is"
+	if len(upToDate) > 1 {
+		verb = "are"
+	}
+	ui.SuccessMsg(fmt.Sprintf("%s %s up to date (%s)", strings.Join(upToDate, ", "), verb, ui.FormatDuration(time.Since(start))))
+	return nil
+}
+
+// compareOutput renders one language's output in memory and compares it with
+// the generated files, printing a diff for each that differs and naming the
+// files a generate would remove. It returns the files' paths relative to root
+// for display, and whether all are up to date.
+func compareOutput(root string, input injector.InjectInput) ([]string, bool, error) {
+	files, err := injector.RenderFiles(input)
+	if err != nil {
+		ui.ErrorMsg("Failed to render output", err)
+		return nil, false, err
+	}
+	var displayPaths []string
+	upToDate := true
+	for _, file := range files {
+		displayPath, ok, err := compareFile(root, file)
+		if err != nil {
+			return nil, false, err
+		}
+		displayPaths = append(displayPaths, displayPath)
+		upToDate = upToDate && ok
+	}
+
+	// Files a generate would remove, e.g. the module of a removed namespace
+	ok, err := checkStaleFiles(root, input, files, "Run `xschema generate` and commit the result")
+	if err != nil {
+		return nil, false, err
+	}
+	return displayPaths, upToDate && ok, nil
+}
+
+// checkStaleFiles reports the files of the output manifest that the rendered
+// files no longer include, printing hint for each, and whether there are none
+func checkStaleFiles(root string, input injector.InjectInput, files []injector.File, hint string) (bool, error) {
+	stale, err := injector.StaleFiles(input, files)
+	if err != nil {
+		ui.ErrorMsg("Failed to read output manifest", err)
+		return false, err
+	}
+	for _, path := range stale {
+		displayPath := path
+		if rel, err := filepath.Rel(root, path); err == nil {
+			displayPath = rel
+		}
+		ui.ErrorMsg(fmt.Sprintf("%s is no longer generated", displayPath), nil, hint)
+	}
+	return len(stale) == 0, nil
+}
+
+// compareFile compares a rendered file with the one on disk, printing a diff
+// when they differ
+func compareFile(root string, file injector.File) (string, bool, error) {
+	outPath, want := file.Path, file.Content
+	displayPath := outPath
+	if rel, err := filepath.Rel(root, outPath); err == nil {
+		displayPath = rel
+	}
+
+	got, err := os.ReadFile(outPath)
+	if errors.Is(err, os.ErrNotExist) {
+		ui.ErrorMsg(fmt.Sprintf("%s does not exist", displayPath), nil, "Run `xschema generate` and commit the result")
+		return displayPath, false, nil
+	}
+	if err != nil {
+		ui.ErrorMsg("Failed to read generated output", err)
+		return "", false, err
+	}
+
+	if string(got) == string(want) {
+		return displayPath, true, nil
+	}
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(got)),
+		B:        difflib.SplitLines(string(want)),
+		FromFile: displayPath,
+		ToFile:   displayPath + " (expected)",
+		Context:  3,
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("failed to diff %s: %w", displayPath, err)
+	}
+
+	ui.ErrorMsg(fmt.Sprintf("%s is out of date", displayPath), nil, "Run `xschema generate` and commit the result")
+	ui.Println()
+	ui.PrintDiff(diff)
+	return displayPath, false, nil
+}
@@ -1,27 +1,40 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/xschemadev/xschema/generator"
 	"github.com/xschemadev/xschema/injector"
+	"github.com/xschemadev/xschema/language"
 	"github.com/xschemadev/xschema/parser"
 	"github.com/xschemadev/xschema/retriever"
 	"github.com/xschemadev/xschema/ui"
 )
 
 var (
-	projectDir string
-	outputDir  string
-	langFilter string
-	verbose    bool
-	dryRun     bool
-	//TODO
-	watch bool
+	projectDir   string
+	outputDir    string
+	outputLayout string
+	langFilter   string
+	verbose      bool
+	dryRun       bool
+	watch        bool
+	refMode      string
+	keepGoing    bool
+	noWorkers    bool
+
+	adapterTimeout   time.Duration
+	maxAdapterOutput int
+	adapterFlags     []string
 )
 
 var generateCmd = &cobra.Command{
@@ -34,11 +47,88 @@ func init() {
 	rootCmd.AddCommand(generateCmd)
 
 	generateCmd.Flags().StringVarP(&projectDir, "project", "p", "", "project root directory (default: current directory)")
-	generateCmd.Flags().StringVarP(&outputDir, "output", "o", ".xschema", "output directory for generated files")
-	generateCmd.Flags().StringVar(&langFilter, "lang", "", "filter to specific language if multiple detected")
+	generateCmd.Flags().StringVarP(&outputDir, "output", "o", "", outputFlagUsage)
+	generateCmd.Flags().StringVar(&outputLayout, "layout", string(injector.LayoutSingle), layoutFlagUsage)
+	generateCmd.Flags().StringVar(&langFilter, "lang", "", "only generate for this language's configs")
 	generateCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
 	generateCmd.Flags().BoolVar(&dryRun, "dry-run", false, "show what would be generated without writing")
 	generateCmd.Flags().BoolVarP(&watch, "watch", "w", false, "watch for changes and regenerate")
+	generateCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "write the schemas that generated successfully and report the ones that failed")
+	generateCmd.Flags().BoolVar(&noWorkers, "no-workers", false, "with --watch, start adapters once per cycle even if they support long-lived workers")
+	generateCmd.Flags().StringVar(&refMode, "refs", string(retriever.RefsDefs), "how $refs are bundled: \"defs\" embeds referenced schemas under $defs, \"inline\" copies them in place")
+	addAdapterFlags(generateCmd)
+}
+
+// addAdapterFlags registers the flags that start and limit adapter processes
+func addAdapterFlags(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&adapterTimeout, "adapter-timeout", generator.DefaultTimeout, "kill an adapter that runs longer than this (0 disables)")
+	cmd.Flags().IntVar(&maxAdapterOutput, "max-adapter-output", generator.DefaultMaxOutput, "kill an adapter that writes more than this many bytes (0 disables)")
+	cmd.Flags().StringArrayVar(&adapterFlags, "adapter", nil, "start an adapter with a command or local path instead of the package runner, e.g. zod=./adapters/zod or \"zod=node dist/cli.js\" (repeatable)")
+}
+
+// adapterEnvPrefix starts the environment variables overriding an adapter,
+// e.g. XSCHEMA_ADAPTER_ZOD for zod
+const adapterEnvPrefix = "XSCHEMA_ADAPTER_"
+
+// adapterEnvName returns the environment variable overriding an adapter:
+// its name upper-cased, with anything but letters and digits replaced by "_"
+func adapterEnvName(adapter string) string {
+	return adapterEnvPrefix + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, adapter)
+}
+
+// adapterOverrides returns how to start the project's adapters: --adapter
+// flags win over XSCHEMA_ADAPTER_<NAME> variables, which win over the
+// "adapters" of the config files
+func adapterOverrides(result *parser.ParseResult) (map[string]parser.AdapterConfig, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := maps.Clone(result.Adapters)
+	if overrides == nil {
+		overrides = make(map[string]parser.AdapterConfig)
+	}
+	for _, adapter := range slices.Sorted(maps.Keys(result.DeclarationsByAdapter())) {
+		name := adapterEnvName(adapter)
+		if value, ok := os.LookupEnv(name); ok && strings.TrimSpace(value) != "" {
+			overrides[adapter] = parseAdapterOverride(value, cwd, "$"+name)
+		}
+	}
+	for _, flag := range adapterFlags {
+		adapter, value, ok := strings.Cut(flag, "=")
+		if !ok || adapter == "" || strings.TrimSpace(value) == "" {
+			return nil, fmt.Errorf("invalid --adapter %q: expected name=command or name=path", flag)
+		}
+		overrides[adapter] = parseAdapterOverride(value, cwd, "--adapter "+adapter)
+	}
+
+	for adapter, o := range overrides {
+		ui.Verbosef("adapter override: %s (from %s)", adapter, o.Origin)
+	}
+	return overrides, nil
+}
+
+// parseAdapterOverride reads an override given on the command line or in the
+// environment. A single word that looks like a path ("./zod", "../adapters/zod")
+// is a local adapter; anything else is the command to run.
+func parseAdapterOverride(value, dir, origin string) parser.AdapterConfig {
+	o := parser.AdapterConfig{Dir: dir, Origin: origin}
+	fields := strings.Fields(value)
+	if len(fields) == 1 && (strings.HasPrefix(fields[0], ".") || strings.ContainsRune(fields[0], '/') || strings.ContainsRune(fields[0], filepath.Separator)) {
+		o.Path = fields[0]
+	} else {
+		o.Command = fields
+	}
+	return o
 }
 
 func runGenerate(cmd *cobra.Command, args []string) error {
@@ -49,40 +139,48 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 
 	ctx := cmd.Context()
 
-	// Determine project root
-	root := projectDir
-	if root == "" {
-		var err error
-		root, err = os.Getwd()
-		if err != nil {
-			return fmt.Errorf("failed to get current directory: %w", err)
+	root, outDir, err := resolveDirs()
+	if err != nil {
+		return err
+	}
+	if _, err := injector.ParseLayout(outputLayout); err != nil {
+		return err
+	}
+
+	if watch {
+		if dryRun {
+			return fmt.Errorf("--watch cannot be combined with --dry-run")
 		}
+		return runWatch(ctx, root, outDir)
 	}
 
-	// Make output directory absolute relative to project root
-	outDir := outputDir
-	if !filepath.IsAbs(outDir) {
-		outDir = filepath.Join(root, outDir)
+	retrieverOpts, err := retrieverOptions(root)
+	if err != nil {
+		return err
 	}
 
 	// Step 1: Parse config files
 	ui.Step(1, 4, "Scanning for xschema config files")
-	result, err := parser.Parse(ctx, root, langFilter)
+	result, err := parser.Parse(ctx, root, langFilter, retriever.DocumentLoader(retrieverOpts))
 	if err != nil {
 		ui.ErrorMsg("Failed to parse config files", err)
 		return err
 	}
 	ui.Detail(fmt.Sprintf("Found %d config files, %d schemas (%s)",
-		len(result.Configs), len(result.Declarations), result.Language.Name))
+		len(result.Configs), len(result.Declarations), languageNames(result)))
 
 	if len(result.Declarations) == 0 {
 		ui.WarnMsg("No schema declarations found")
 		return nil
 	}
+	overrides, err := adapterOverrides(result)
+	if err != nil {
+		ui.ErrorMsg("Invalid adapter override", err)
+		return err
+	}
 
 	// Step 2: Fetch schemas (with spinner)
 	ui.Step(2, 4, "Fetching schemas")
-	retrieverOpts := retriever.DefaultOptions()
 
 	var schemas []retriever.RetrievedSchema
 	err = ui.RunWithSpinner("Fetching schemas...", func() error {
@@ -91,7 +189,7 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 		return fetchErr
 	})
 	if err != nil {
-		ui.ErrorMsg("Failed to fetch schemas", err)
+		ui.ErrorMsg("Failed to fetch schemas", err, fetchHints(err)...)
 		return err
 	}
 
@@ -101,6 +199,19 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 	}
 	ui.SuccessMsg(fmt.Sprintf("Fetched %d schemas", len(schemas)))
 
+	// Verify URL schemas against the lockfile
+	lock, lockRes, err := reconcileLock(root, result.Declarations, schemas, func(string) bool { return updateLock })
+	if err != nil {
+		ui.ErrorMsg("Failed to read lockfile", err)
+		return err
+	}
+	if len(lockRes.Drift) > 0 {
+		err := driftError(lockRes.Drift)
+		ui.ErrorMsg("Locked schemas changed upstream", err,
+			"Review the upstream changes, then rerun with --update-lock or run `xschema lock update`")
+		return err
+	}
+
 	// Handle dry-run mode
 	if dryRun {
 		ui.Println()
@@ -110,39 +221,180 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	// Step 3: Generate (with spinner per adapter)
+	// Step 3: Generate (with spinner per language)
 	ui.Step(3, 4, "Generating validators")
-	var outputs []generator.GenerateOutput
-	err = ui.RunWithSpinner("Running adapters...", func() error {
-		var genErr error
-		outputs, genErr = generator.GenerateAll(ctx, schemas, result.Language.Name)
-		return genErr
-	})
+	outCache, err := outputCache(retrieverOpts)
 	if err != nil {
-		ui.ErrorMsg("Generation failed", err, "Make sure the adapter is installed")
+		ui.ErrorMsg("Failed to open output cache", err)
 		return err
 	}
+	runs := languageRuns(result, schemas, root, outDir)
+	var failures []generator.Failure
+	for i := range runs {
+		run := &runs[i]
+		if err := preflight(ctx, run.schemas, run.lang.Name, outCache, overrides); err != nil {
+			return err
+		}
+		err = ui.RunWithSpinner(fmt.Sprintf("Running %s adapters...", run.lang.Name), func() error {
+			var genErr error
+			run.outputs, genErr = generator.GenerateAll(ctx, run.schemas, run.lang.Name, generator.Options{
+				KeepGoing: keepGoing,
+				Cache:     outCache,
+				Timeout:   adapterTimeout,
+				MaxOutput: maxAdapterOutput,
+				Overrides: overrides,
+			})
+			return genErr
+		})
+		var failed *generator.FailedError
+		if err != nil && !(keepGoing && errors.As(err, &failed)) {
+			ui.ErrorMsg("Generation failed", err, generateHints(err)...)
+			return err
+		}
+		if failed != nil {
+			failures = append(failures, failed.Failures...)
+		}
+		printWarnings(*run)
+	}
 
 	// Step 4: Inject
 	ui.Step(4, 4, "Writing output files")
-	err = injector.Inject(injector.InjectInput{
-		Language: result.Language.Name,
-		Outputs:  outputs,
-		OutDir:   outDir,
-	})
-	if err != nil {
-		ui.ErrorMsg("Failed to write output", err)
+	var generatedFiles []string
+	written := 0
+	for _, run := range runs {
+		files, err := injector.Inject(run.injectInput())
+		if err != nil {
+			ui.ErrorMsg("Failed to write output", err)
+			return err
+		}
+		generatedFiles = append(generatedFiles, files...)
+		written += len(run.outputs)
+	}
+	if err := saveLock(root, lock, lockRes); err != nil {
+		ui.ErrorMsg("Failed to write lockfile", err)
 		return err
 	}
 
+	if len(failures) > 0 {
+		failed := &generator.FailedError{Failures: failures}
+		ui.ErrorMsg(fmt.Sprintf("Wrote %d schemas, %d failed", written, len(failures)), failed)
+		return failed
+	}
+
 	// Summary
-	generatedFile := filepath.Join(outDir, result.Language.OutputFile)
-	printSummary(schemas, outDir, generatedFile, time.Since(start))
+	printSummary(schemas, generatedFiles, time.Since(start))
 
 	return nil
 }
 
-func printSummary(schemas []retriever.RetrievedSchema, outDir string, generatedFile string, duration time.Duration) {
+// outputFlagUsage describes --output, which is shared by the commands that
+// write or compare generated files
+const outputFlagUsage = "output directory for generated files (default: .xschema, xschema for go); with several languages, relative to each language's configs"
+
+// layoutFlagUsage describes --layout, shared like --output
+const layoutFlagUsage = "how generated code is split into files: \"single\" writes one file, \"namespace\" a module per namespace plus an index importing them"
+
+// languageRun is one language's share of a run: its schemas, the outputs
+// generated for them and where and how they are written
+type languageRun struct {
+	lang     *language.Language
+	schemas  []retriever.RetrievedSchema
+	outputs  []generator.GenerateOutput
+	outDir   string
+	template string   // the project's output template, "" for the built-in one
+	renamed  []string // schemas whose variable name was changed to keep names distinct
+}
+
+// injectInput returns what the injector writes for the run
+func (r languageRun) injectInput() injector.InjectInput {
+	return injector.InjectInput{
+		Language: r.lang.Name,
+		Outputs:  r.outputs,
+		OutDir:   r.outDir,
+		Layout:   injector.Layout(outputLayout),
+		Template: r.template,
+	}
+}
+
+// languageRuns splits the retrieved schemas by the language of their configs,
+// in the order of result.Languages
+func languageRuns(result *parser.ParseResult, schemas []retriever.RetrievedSchema, root, outDir string) []languageRun {
+	runs := make([]languageRun, len(result.Languages))
+	for i, lang := range result.Languages {
+		runs[i] = languageRun{lang: lang, outDir: languageOutDir(result, lang, root, outDir), template: result.Templates[lang.Name]}
+		for _, s := range schemas {
+			if s.Language == lang.Name {
+				runs[i].schemas = append(runs[i].schemas, s)
+			}
+		}
+
+		// Names are assigned over every schema of the language, so they are
+		// the same whichever of them a watch cycle regenerates
+		entries := make([]language.SchemaEntry, len(runs[i].schemas))
+		for j, s := range runs[i].schemas {
+			entries[j] = language.SchemaEntry{Namespace: s.Namespace, ID: s.ID}
+		}
+		runs[i].renamed = lang.AssignVarNames(entries)
+		for j := range runs[i].schemas {
+			runs[i].schemas[j].VarName = entries[j].VarName
+		}
+	}
+	return runs
+}
+
+// languageOutDir returns where a language's output is written. A project with
+// one language writes to outDir, or to the language's default directory in
+// root without --output. With several, each language writes next to its own
+// configs, e.g. apps/web/.xschema and services/api/.xschema, or to a
+// subdirectory per language when --output is absolute; --lang does not
+// change where.
+func languageOutDir(result *parser.ParseResult, lang *language.Language, root, outDir string) string {
+	dir := outputDir
+	if dir == "" {
+		dir = lang.OutputDir
+	}
+	switch {
+	case len(result.Detected) > 1 && filepath.IsAbs(dir):
+		return filepath.Join(dir, lang.Name)
+	case len(result.Detected) > 1:
+		return filepath.Join(result.ConfigDir(lang.Name), dir)
+	case outDir != "":
+		return outDir
+	default:
+		return filepath.Join(root, dir)
+	}
+}
+
+// languageNames lists the languages of a parse result for display
+func languageNames(result *parser.ParseResult) string {
+	names := make([]string, len(result.Languages))
+	for i, lang := range result.Languages {
+		names[i] = lang.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+// resolveDirs returns the project root (default: current directory) and the
+// output directory resolved against it, "" without --output: each language
+// then has its own default
+func resolveDirs() (root string, outDir string, err error) {
+	root = projectDir
+	if root == "" {
+		root, err = os.Getwd()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to get current directory: %w", err)
+		}
+	}
+
+	// Make output directory absolute relative to project root
+	outDir = outputDir
+	if outDir != "" && !filepath.IsAbs(outDir) {
+		outDir = filepath.Join(root, outDir)
+	}
+	return root, outDir, nil
+}
+
+func printSummary(schemas []retriever.RetrievedSchema, generatedFiles []string, duration time.Duration) {
 	ui.Println()
 	ui.SuccessMsg(fmt.Sprintf("Generation complete (%s)", ui.FormatDuration(duration)))
 	ui.Println()
@@ -162,10 +414,56 @@ func printSummary(schemas []retriever.RetrievedSchema, outDir string, generatedF
 	}
 	ui.Println()
 
-	ui.Printf("  Output: %s\n", ui.Primary.Render(generatedFile))
+	for _, file := range generatedFiles {
+		ui.Printf("  Output: %s\n", ui.Primary.Render(file))
+	}
 	ui.Println()
 
-	ui.Printf("  %s Check the generated file to verify the output\n", ui.Dim.Render("Tip:"))
+	ui.Printf("  %s Check the generated files to verify the output\n", ui.Dim.Render("Tip:"))
+}
+
+// preflight asks every adapter for its capabilities, failing on incompatible
+// adapters and warning about schemas they cannot fully convert. Answers cached
+// for the installed adapter version are reused.
+func preflight(ctx context.Context, schemas []retriever.RetrievedSchema, langName string, outCache *generator.OutputCache, overrides map[string]parser.AdapterConfig) error {
+	var res *generator.PreflightResult
+	err := ui.RunWithSpinner("Checking adapters...", func() error {
+		var checkErr error
+		known := outCache.Capabilities(langName, schemas, overrides)
+		res, checkErr = generator.Preflight(ctx, schemas, langName, known, overrides)
+		return checkErr
+	})
+	if err != nil {
+		ui.ErrorMsg("Incompatible adapter", err)
+		return err
+	}
+	outCache.PutCapabilities(langName, res.Capabilities, overrides)
+	for _, w := range res.Warnings {
+		ui.WarnMsg(w)
+	}
+	return nil
+}
+
+// generateHints suggests how to recover from a generation error
+func generateHints(err error) []string {
+	var failed *generator.FailedError
+	if errors.As(err, &failed) {
+		return []string{"Rerun with --keep-going to write the schemas that succeeded"}
+	}
+	return []string{"Make sure the adapter is installed"}
+}
+
+// printWarnings shows the renamed variables of a run and the adapters'
+// non-fatal notes about each schema
+func printWarnings(run languageRun) {
+	for _, note := range run.renamed {
+		ui.WarnMsg(note)
+	}
+	for _, o := range run.outputs {
+		for _, w := range o.Warnings {
+			ui.WarnMsg(fmt.Sprintf("%s: %s", o.Key(), w))
+		}
+	}
 }
 
 func printDryRunSchemas(schemas []retriever.RetrievedSchema) {
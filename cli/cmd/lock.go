@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/xschemadev/xschema/lockfile"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+)
+
+var updateLock bool
+
+var lockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Manage " + lockfile.FileName + ", which pins the content of URL schemas",
+}
+
+var lockUpdateCmd = &cobra.Command{
+	Use:   "update [namespace:id...]",
+	Short: "Refetch URL schemas and re-pin them in " + lockfile.FileName + " (all if none given)",
+	RunE:  runLockUpdate,
+}
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+	lockCmd.AddCommand(lockUpdateCmd)
+
+	lockUpdateCmd.Flags().StringVarP(&projectDir, "project", "p", "", "project root directory (default: current directory)")
+	lockUpdateCmd.Flags().StringVar(&langFilter, "lang", "", "only update this language's configs")
+	lockUpdateCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "show verbose output")
+	addCacheFlags(lockUpdateCmd)
+
+	generateCmd.Flags().BoolVar(&updateLock, "update-lock", false, "accept upstream changes to URL schemas and update "+lockfile.FileName)
+}
+
+// reconcileLock checks fetched URL schemas against the project lockfile
+// Drifted entries are re-pinned when update returns true for their key, and
+// the entries of languages --lang leaves out are kept.
+func reconcileLock(root string, decls []parser.Declaration, schemas []retriever.RetrievedSchema, update func(key string) bool) (*lockfile.Lockfile, lockfile.Result, error) {
+	lock, err := lockfile.Load(filepath.Join(root, lockfile.FileName))
+	if err != nil {
+		return nil, lockfile.Result{}, err
+	}
+	return lock, lock.Reconcile(decls, schemas, langFilter, update, time.Now()), nil
+}
+
+// saveLock writes the lockfile if reconciliation changed it
+func saveLock(root string, lock *lockfile.Lockfile, res lockfile.Result) error {
+	if !res.Changed() {
+		return nil
+	}
+	if err := lock.Save(filepath.Join(root, lockfile.FileName)); err != nil {
+		return err
+	}
+	ui.Verbosef("updated lockfile: added=%d, updated=%d, removed=%d", len(res.Added), len(res.Updated), len(res.Removed))
+	return nil
+}
+
+// driftError formats drifted entries as a single error
+func driftError(drift []lockfile.Drift) error {
+	lines := make([]string, len(drift))
+	for i, d := range drift {
+		lines[i] = "  " + d.String()
+	}
+	return fmt.Errorf("%d URL schema(s) changed upstream since they were locked:\n%s", len(drift), strings.Join(lines, "\n"))
+}
+
+func runLockUpdate(cmd *cobra.Command, args []string) error {
+	ui.SetVerbose(verbose)
+
+	ctx := cmd.Context()
+
+	root, _, err := resolveDirs()
+	if err != nil {
+		return err
+	}
+
+	// Always revalidate so the lock reflects what upstream serves right now
+	opts, err := retrieverOptions(root)
+	if err != nil {
+		return err
+	}
+	opts.CacheTTL = 0
+
+	result, err := parser.Parse(ctx, root, langFilter, retriever.DocumentLoader(opts))
+	if err != nil {
+		ui.ErrorMsg("Failed to parse config files", err)
+		return err
+	}
+
+	// Select URL declarations to refresh: a "namespace:id" argument selects
+	// the key in every language, a "language/namespace:id" one in that language
+	var selected []parser.Declaration
+	selectedKeys := make(map[string]bool)
+	for _, d := range result.Declarations {
+		if d.SourceType == parser.SourceURL && (len(args) == 0 || slices.Contains(args, d.Key()) || slices.Contains(args, d.QualifiedKey())) {
+			selected = append(selected, d)
+			selectedKeys[d.QualifiedKey()] = true
+		}
+	}
+	for _, key := range args {
+		if !slices.ContainsFunc(selected, func(d parser.Declaration) bool { return key == d.Key() || key == d.QualifiedKey() }) {
+			return fmt.Errorf("%s is not a URL-sourced schema declaration", key)
+		}
+	}
+
+	if len(selected) == 0 {
+		ui.WarnMsg("No URL-sourced schemas to lock")
+	}
+
+	var schemas []retriever.RetrievedSchema
+	err = ui.RunWithSpinner(fmt.Sprintf("Fetching %d schemas...", len(selected)), func() error {
+		var fetchErr error
+		schemas, fetchErr = retriever.Retrieve(ctx, selected, opts)
+		return fetchErr
+	})
+	if err != nil {
+		ui.ErrorMsg("Failed to fetch schemas", err)
+		return err
+	}
+
+	lock, res, err := reconcileLock(root, result.Declarations, schemas, func(key string) bool {
+		return selectedKeys[key]
+	})
+	if err != nil {
+		return err
+	}
+	if err := saveLock(root, lock, res); err != nil {
+		ui.ErrorMsg("Failed to write lockfile", err)
+		return err
+	}
+
+	for _, key := range res.Updated {
+		ui.Detail(fmt.Sprintf("%s %s", ui.Primary.Render(key), ui.Dim.Render("updated")))
+	}
+	for _, key := range res.Added {
+		ui.Detail(fmt.Sprintf("%s %s", ui.Primary.Render(key), ui.Dim.Render("added")))
+	}
+	for _, key := range res.Removed {
+		ui.Detail(fmt.Sprintf("%s %s", ui.Primary.Render(key), ui.Dim.Render("removed")))
+	}
+	for _, key := range res.Moved {
+		ui.Detail(fmt.Sprintf("%s %s", ui.Primary.Render(key), ui.Dim.Render("moved from a version 1 key")))
+	}
+
+	if !res.Changed() {
+		ui.SuccessMsg(fmt.Sprintf("%s is up to date", lockfile.FileName))
+		return nil
+	}
+	ui.SuccessMsg(fmt.Sprintf("Updated %s (%d updated, %d added, %d removed)",
+		lockfile.FileName, len(res.Updated), len(res.Added), len(res.Removed)))
+	return nil
+}
@@ -0,0 +1,506 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xschemadev/xschema/generator"
+	"github.com/xschemadev/xschema/injector"
+	"github.com/xschemadev/xschema/lockfile"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+	"github.com/xschemadev/xschema/watcher"
+)
+
+// watchSession keeps the results of previous cycles so a change only re-runs
+// the pipeline stages it affects:
+//   - config file changed: parse, retrieve everything, regenerate changed adapters
+//   - schema file changed: retrieve affected declarations, regenerate changed adapters
+//   - adapter failed: retried on the next cycle even if nothing changed
+//   - output template changed: rewrite the output without regenerating
+type watchSession struct {
+	root   string
+	outDir string
+
+	result       *parser.ParseResult
+	schemas      []retriever.RetrievedSchema
+	configPaths  map[string]bool                                             // every config file seen so far
+	fingerprints map[string]string                                           // "language/adapter" -> hash of its schemas
+	outputs      map[string]generator.GenerateOutput                         // qualified schema key -> last generated output
+	failed       map[string]bool                                             // "language/adapter" of generations that failed last
+	capabilities map[string]map[generator.AdapterDir]*generator.Capabilities // language -> adapter and package root -> handshake answer, asked once per session
+	workers      *generator.WorkerPool                                       // long-lived adapter processes; nil with --no-workers
+	cache        *generator.OutputCache                                      // outputs of earlier runs; nil with --no-cache
+	overrides    map[string]parser.AdapterConfig                             // adapter -> how to start it, from the last parse
+	templates    map[string]string                                           // language -> output template of its last write
+}
+
+// cycleReport summarizes one watch cycle for display
+type cycleReport struct {
+	changed   []string
+	parsed    bool
+	retrieved int
+	adapters  []string
+	generated int
+	wrote     bool
+	err       error
+	errStage  string
+	duration  time.Duration
+}
+
+func runWatch(ctx context.Context, root, outDir string) error {
+	// Watcher events carry absolute paths, so compare against absolute config paths
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve project root: %w", err)
+	}
+
+	w, err := watcher.New(watcher.DefaultDebounce)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	s := &watchSession{
+		root:         root,
+		outDir:       outDir,
+		configPaths:  make(map[string]bool),
+		fingerprints: make(map[string]string),
+		outputs:      make(map[string]generator.GenerateOutput),
+		failed:       make(map[string]bool),
+		capabilities: make(map[string]map[generator.AdapterDir]*generator.Capabilities),
+		templates:    make(map[string]string),
+	}
+	if opts, err := retrieverOptions(root); err == nil {
+		// An invalid flag combination is reported by the first cycle
+		if s.cache, err = outputCache(opts); err != nil {
+			ui.Verbosef("output cache disabled: %v", err)
+		}
+	}
+	if !noWorkers {
+		s.workers = generator.NewWorkerPool(ctx)
+		defer s.workers.Close()
+	}
+
+	// Initial cycle: a project that can't be parsed has nothing to watch
+	report := s.cycle(ctx, nil)
+	if s.result == nil {
+		ui.ErrorMsg("Failed to parse config files", report.err)
+		return report.err
+	}
+	printCycleReport(report, root)
+
+	if err := w.SetFiles(s.watchedFiles()); err != nil {
+		return err
+	}
+	if err := w.SetCreated(s.globDirs(), s.matchesGlob); err != nil {
+		return err
+	}
+	ui.Println()
+	ui.Printf("%s Watching %d files for changes %s\n",
+		ui.Primary.Render("●"), len(w.Files()), ui.Dim.Render("(press Ctrl+C to stop)"))
+
+	err = w.Run(ctx, func(changed []string) {
+		report := s.cycle(ctx, changed)
+		if ctx.Err() != nil {
+			return
+		}
+		printCycleReport(report, root)
+		if err := w.SetFiles(s.watchedFiles()); err != nil {
+			ui.Verbosef("failed to update watched files: %v", err)
+		}
+		if err := w.SetCreated(s.globDirs(), s.matchesGlob); err != nil {
+			ui.Verbosef("failed to update watched directories: %v", err)
+		}
+	})
+
+	ui.Println()
+	ui.Println(ui.Dim.Render("Stopped watching"))
+	return err
+}
+
+// cycle runs the pipeline stages affected by the changed paths
+// A nil changed list means this is the initial (full) cycle
+func (s *watchSession) cycle(ctx context.Context, changed []string) (report cycleReport) {
+	start := time.Now()
+	report.changed = changed
+	defer func() { report.duration = time.Since(start) }()
+
+	var lock *lockfile.Lockfile
+	var lockRes lockfile.Result
+
+	retrieverOpts, err := retrieverOptions(s.root)
+	if err != nil {
+		report.err, report.errStage = err, "retrieve"
+		return report
+	}
+
+	if s.result == nil || s.schemas == nil || s.touchesConfig(changed) {
+		// Stage 1+2: parse and retrieve everything (also after a failed retrieval,
+		// since nothing is known to be good yet)
+		report.parsed = true
+		result, err := parser.Parse(ctx, s.root, langFilter, retriever.DocumentLoader(retrieverOpts))
+		if err != nil {
+			report.err, report.errStage = err, "parse"
+			return report
+		}
+		overrides, err := adapterOverrides(result)
+		if err != nil {
+			report.err, report.errStage = err, "parse"
+			return report
+		}
+		s.result = result
+		for _, c := range result.Configs {
+			s.configPaths[c.Path] = true
+		}
+		// An adapter started differently must be asked and run again
+		for key := range s.fingerprints {
+			langName, adapter, _ := strings.Cut(key, "/")
+			if !reflect.DeepEqual(overrides[adapter], s.overrides[adapter]) {
+				delete(s.fingerprints, key)
+				maps.DeleteFunc(s.capabilities[langName], func(k generator.AdapterDir, _ *generator.Capabilities) bool {
+					return k.Adapter == adapter
+				})
+			}
+		}
+		s.overrides = overrides
+
+		schemas, err := retriever.Retrieve(ctx, result.Declarations, retrieverOpts)
+		if err != nil {
+			// Keep the new parse result so the schema files it points to are watched
+			s.schemas = nil
+			report.err, report.errStage = err, "retrieve"
+			return report
+		}
+		s.schemas = schemas
+		report.retrieved = len(schemas)
+
+		// URL schemas are only fetched on full cycles, so that is where drift can appear
+		lock, lockRes, err = reconcileLock(s.root, result.Declarations, schemas, func(string) bool { return updateLock })
+		if err == nil && len(lockRes.Drift) > 0 {
+			err = driftError(lockRes.Drift)
+		}
+		if err != nil {
+			s.schemas = nil
+			report.err, report.errStage = err, "lock"
+			return report
+		}
+	} else {
+		// Stage 2: retrieve only the declarations whose schema file changed
+		var idxs []int
+		var decls []parser.Declaration
+		for i, d := range s.result.Declarations {
+			if path, err := d.FilePath(); err == nil && slices.Contains(changed, path) {
+				idxs = append(idxs, i)
+				decls = append(decls, d)
+			}
+		}
+		refetched, err := retriever.Retrieve(ctx, decls, retrieverOpts)
+		if err != nil {
+			report.err, report.errStage = err, "retrieve"
+			return report
+		}
+		for j, i := range idxs {
+			s.schemas[i] = refetched[j]
+		}
+		report.retrieved = len(refetched)
+	}
+
+	// Stage 3 and 4, language by language
+	var failures []generator.Failure
+	for _, run := range languageRuns(s.result, s.schemas, s.root, s.outDir) {
+		failed, err := s.generate(ctx, run, &report)
+		if err != nil {
+			return report
+		}
+		failures = append(failures, failed...)
+	}
+	if !report.wrote {
+		return report
+	}
+	if lock != nil {
+		if err := saveLock(s.root, lock, lockRes); err != nil {
+			report.err, report.errStage = err, "lock"
+			return report
+		}
+	}
+	if len(failures) > 0 {
+		// The rest was written; still surface what is missing
+		report.err, report.errStage = &generator.FailedError{Failures: failures}, "generate"
+	}
+
+	return report
+}
+
+// generate regenerates the adapters of one language whose schemas changed (or
+// failed last time) and rewrites the language's output. It returns the schemas
+// that failed with --keep-going; other errors are recorded in the report.
+func (s *watchSession) generate(ctx context.Context, run languageRun, report *cycleReport) ([]generator.Failure, error) {
+	langName := run.lang.Name
+	groups := retriever.GroupByAdapter(run.schemas)
+	var dirty []retriever.RetrievedSchema
+	var adapters []string
+	for _, adapter := range retriever.SortedAdapters(groups) {
+		fp := fingerprint(groups[adapter])
+		if key := langName + "/" + adapter; s.fingerprints[key] == fp && !s.failed[key] {
+			continue
+		}
+		adapters = append(adapters, adapter)
+		dirty = append(dirty, groups[adapter]...)
+	}
+	report.adapters = append(report.adapters, adapters...)
+	removed := false
+	for key := range s.fingerprints {
+		if l, adapter, _ := strings.Cut(key, "/"); l == langName {
+			if _, ok := groups[adapter]; !ok {
+				// Adapter no longer used; output needs rewriting without it
+				delete(s.fingerprints, key)
+				removed = true
+			}
+		}
+	}
+
+	// A different or edited template only needs the output rewritten
+	template, ok := s.templates[langName]
+	retemplate := !ok || template != run.template || (run.template != "" && slices.Contains(report.changed, run.template))
+
+	if len(dirty) == 0 && !removed && !retemplate {
+		return nil, nil
+	}
+	fail := func(err error) error {
+		for _, adapter := range adapters {
+			s.failed[langName+"/"+adapter] = true
+		}
+		report.err, report.errStage = err, "generate"
+		return err
+	}
+
+	var failed *generator.FailedError
+	if len(dirty) > 0 {
+		if s.capabilities[langName] == nil {
+			s.capabilities[langName] = make(map[generator.AdapterDir]*generator.Capabilities)
+		}
+		known := s.capabilities[langName]
+		for key, caps := range s.cache.Capabilities(langName, dirty, s.overrides) {
+			if _, ok := known[key]; !ok {
+				known[key] = caps
+			}
+		}
+		pre, err := generator.Preflight(ctx, dirty, langName, known, s.overrides)
+		if err != nil {
+			return nil, fail(err)
+		}
+		maps.Copy(known, pre.Capabilities)
+		s.cache.PutCapabilities(langName, pre.Capabilities, s.overrides)
+		for _, w := range pre.Warnings {
+			ui.WarnMsg(w)
+		}
+
+		outputs, err := generator.GenerateAll(ctx, dirty, langName, generator.Options{
+			KeepGoing:    keepGoing,
+			Workers:      s.workers,
+			Capabilities: known,
+			Cache:        s.cache,
+			Timeout:      adapterTimeout,
+			MaxOutput:    maxAdapterOutput,
+			Overrides:    s.overrides,
+		})
+		if err != nil && !(keepGoing && errors.As(err, &failed)) {
+			return nil, fail(err)
+		}
+		for _, out := range outputs {
+			s.outputs[langName+"/"+out.Key()] = out
+		}
+		for _, adapter := range adapters {
+			s.fingerprints[langName+"/"+adapter] = fingerprint(groups[adapter])
+			delete(s.failed, langName+"/"+adapter)
+		}
+		if failed != nil {
+			// Drop stale output for the failed schemas and retry their adapters
+			// on the next cycle
+			for _, f := range failed.Failures {
+				delete(s.outputs, langName+"/"+f.Key())
+				s.failed[langName+"/"+f.Adapter] = true
+			}
+		}
+		report.generated += len(outputs)
+	}
+
+	// Write outputs in the same order a one-shot generate would
+	var ordered []generator.GenerateOutput
+	for _, adapter := range retriever.SortedAdapters(groups) {
+		for _, schema := range groups[adapter] {
+			if out, ok := s.outputs[schema.QualifiedKey()]; ok {
+				ordered = append(ordered, out)
+			}
+		}
+	}
+	run.outputs = ordered
+	if _, err := injector.Inject(run.injectInput()); err != nil {
+		report.err, report.errStage = err, "write"
+		return nil, err
+	}
+	s.templates[langName] = run.template
+	report.wrote = true
+	if failed != nil {
+		return failed.Failures, nil
+	}
+	return nil, nil
+}
+
+// touchesConfig reports whether any changed path is a known config file, a
+// file whose edits can add, remove or rename declarations, or a file or
+// directory a glob entry gains or loses. Edits to other files a glob entry
+// matched are schema changes.
+func (s *watchSession) touchesConfig(changed []string) bool {
+	for _, p := range changed {
+		if s.configPaths[p] {
+			return true
+		}
+	}
+	if s.result == nil {
+		return false
+	}
+	declared := make(map[string]bool)
+	for _, d := range s.result.Declarations {
+		path, err := d.FilePath()
+		if err != nil {
+			continue
+		}
+		if d.FileDefinesIDs && slices.Contains(changed, path) {
+			return true
+		}
+		declared[path] = true
+	}
+	for _, p := range changed {
+		info, err := os.Stat(p)
+		if err == nil && info.IsDir() {
+			// A new directory below a glob's search root
+			return true
+		}
+		if s.matchesGlob(p) && (!declared[p] || err != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesGlob reports whether a glob entry of the last parse matches path
+func (s *watchSession) matchesGlob(path string) bool {
+	if s.result == nil {
+		return false
+	}
+	return slices.ContainsFunc(s.result.Globs, func(g parser.Glob) bool { return g.Match(path) })
+}
+
+// globDirs returns the directories glob entries searched, where new files
+// may add declarations
+func (s *watchSession) globDirs() []string {
+	var dirs []string
+	if s.result != nil {
+		for _, g := range s.result.Globs {
+			dirs = append(dirs, g.Dirs...)
+		}
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// watchedFiles returns every config file plus every file-sourced schema and
+// output template. Configs that fail to parse mid-edit stay watched so fixing
+// them triggers a cycle.
+func (s *watchSession) watchedFiles() []string {
+	var files []string
+	for p := range s.configPaths {
+		if _, err := os.Stat(p); err != nil {
+			delete(s.configPaths, p)
+			continue
+		}
+		files = append(files, p)
+	}
+	if s.result != nil {
+		for _, d := range s.result.Declarations {
+			if path, err := d.FilePath(); err == nil {
+				files = append(files, path)
+			}
+		}
+		for _, path := range s.result.Templates {
+			files = append(files, path)
+		}
+	}
+	slices.Sort(files)
+	return slices.Compact(files)
+}
+
+// fingerprint hashes the keys, variable names, schema contents and adapter
+// options of an adapter group, so editing any of them regenerates the group
+func fingerprint(schemas []retriever.RetrievedSchema) string {
+	h := sha256.New()
+	for _, s := range schemas {
+		h.Write([]byte(s.Key()))
+		h.Write([]byte{0})
+		h.Write([]byte(s.VarName))
+		h.Write([]byte{0})
+		h.Write(s.Schema)
+		h.Write([]byte{0})
+		options, _ := json.Marshal(s.Options) // map keys are sorted
+		h.Write(options)
+		h.Write([]byte{0})
+		h.Write([]byte(s.Dir))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func printCycleReport(r cycleReport, root string) {
+	stamp := ui.Dim.Render(time.Now().Format("15:04:05"))
+
+	var trigger string
+	if len(r.changed) > 0 {
+		names := make([]string, len(r.changed))
+		for i, p := range r.changed {
+			if rel, err := filepath.Rel(root, p); err == nil {
+				p = rel
+			}
+			names[i] = p
+		}
+		trigger = ui.Dim.Render(" (" + strings.Join(names, ", ") + ")")
+	}
+
+	if r.err != nil {
+		ui.ErrorMsg(fmt.Sprintf("%s %s failed%s", stamp, r.errStage, trigger), r.err)
+		return
+	}
+
+	if !r.wrote {
+		ui.Printf("%s %s no changes%s\n", ui.Dim.Render("•"), stamp, trigger)
+		return
+	}
+
+	var parts []string
+	if r.parsed {
+		parts = append(parts, "parsed")
+	}
+	if r.retrieved > 0 {
+		parts = append(parts, fmt.Sprintf("fetched %d", r.retrieved))
+	}
+	if r.generated > 0 {
+		parts = append(parts, fmt.Sprintf("generated %d (%s)", r.generated, strings.Join(r.adapters, ", ")))
+	}
+	parts = append(parts, "wrote output")
+
+	ui.SuccessMsg(fmt.Sprintf("%s %s in %s%s", stamp, strings.Join(parts, ", "),
+		ui.FormatDuration(r.duration), trigger))
+}
@@ -0,0 +1,199 @@
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/xschemadev/xschema/cache"
+	"github.com/xschemadev/xschema/language"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+)
+
+// OutputCache keeps adapter outputs and handshake answers in the on-disk
+// cache, keyed by everything that decides them: the schema, its key and
+// options, the adapter and its installed version, and the protocol version.
+// Adapters whose version cannot be resolved are never cached, nor are
+// overridden ones, since their source may change without a new version.
+// Native adapters are not cached either: they are as fast as a cache hit.
+// A nil *OutputCache caches nothing.
+type OutputCache struct {
+	store *cache.Store
+
+	mu       sync.Mutex
+	versions map[string]string // "language/adapter" plus package root -> resolved version, "" if unknown
+}
+
+// NewOutputCache returns a cache backed by store
+func NewOutputCache(store *cache.Store) *OutputCache {
+	return &OutputCache{store: store, versions: make(map[string]string)}
+}
+
+// version resolves the version of an adapter installed for a package root
+// once per cache
+func (c *OutputCache) version(langName, adapter, dir string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := langName + "/" + adapter + "\x00" + dir
+	if v, ok := c.versions[key]; ok {
+		return v
+	}
+	if native(langName, adapter, nil) != nil {
+		c.versions[key] = ""
+		return ""
+	}
+	var v string
+	if lang := language.ByName(langName); lang != nil && lang.AdapterVersion != nil {
+		v = lang.AdapterVersion(dir, lang.AdapterBinPrefix+adapter)
+	}
+	if v == "" {
+		ui.Verbosef("cannot resolve the installed version of adapter %s, not caching its outputs", adapter)
+	} else {
+		ui.Verbosef("resolved adapter version: %s (%s)", adapter, v)
+	}
+	c.versions[key] = v
+	return v
+}
+
+// hashKey digests the parts of a cache key, each terminated by a zero byte
+func hashKey(parts ...[]byte) string {
+	h := sha256.New()
+	h.Write([]byte(strconv.Itoa(ProtocolVersion)))
+	h.Write([]byte{0})
+	for _, p := range parts {
+		h.Write(p)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// outputKey is the cache key of one schema's output
+// Whitespace in the schema does not change the key; key order does, since
+// adapters may preserve it (e.g. object property order). So does the name
+// the code is declared as.
+func outputKey(langName, adapter, version string, s retriever.RetrievedSchema) string {
+	var schema bytes.Buffer
+	if err := json.Compact(&schema, s.Schema); err != nil {
+		schema.Reset()
+		schema.Write(s.Schema)
+	}
+	options, _ := json.Marshal(s.Options) // map keys are sorted
+	return hashKey([]byte("output"), []byte(langName), []byte(adapter), []byte(version),
+		[]byte(s.Key()), []byte(s.VarName), options, schema.Bytes())
+}
+
+// lookup splits an adapter's schemas into cached outputs and the schemas the
+// adapter still has to convert
+func (c *OutputCache) lookup(langName, adapter, dir string, override *parser.AdapterConfig, schemas []retriever.RetrievedSchema) ([]GenerateOutput, []retriever.RetrievedSchema) {
+	if c == nil || override != nil {
+		return nil, schemas
+	}
+	version := c.version(langName, adapter, dir)
+	if version == "" {
+		return nil, schemas
+	}
+
+	var hits []GenerateOutput
+	var misses []retriever.RetrievedSchema
+	for _, s := range schemas {
+		data, ok := c.store.Output(outputKey(langName, adapter, version, s))
+		var out GenerateOutput
+		if ok && json.Unmarshal(data, &out) == nil && out.Key() == s.Key() && out.Error == "" {
+			hits = append(hits, out)
+			continue
+		}
+		misses = append(misses, s)
+	}
+	ui.Verbosef("adapter output cache: %s (hits: %d, misses: %d)", adapter, len(hits), len(misses))
+	return hits, misses
+}
+
+// put stores the outputs an adapter generated for schemas
+// Failed outputs are not stored, so they are retried on the next run.
+func (c *OutputCache) put(langName, adapter, dir string, override *parser.AdapterConfig, schemas []retriever.RetrievedSchema, outputs []GenerateOutput) {
+	if c == nil || override != nil {
+		return
+	}
+	version := c.version(langName, adapter, dir)
+	if version == "" {
+		return
+	}
+
+	byKey := make(map[string]retriever.RetrievedSchema, len(schemas))
+	for _, s := range schemas {
+		byKey[s.Key()] = s
+	}
+	for _, out := range outputs {
+		s, ok := byKey[out.Key()]
+		if !ok || out.Error != "" {
+			continue
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			continue
+		}
+		if err := c.store.PutOutput(outputKey(langName, adapter, version, s), data); err != nil {
+			ui.Verbosef("failed to cache output for %s: %v", out.Key(), err)
+		}
+	}
+}
+
+func capabilitiesKey(langName, adapter, version string) string {
+	return hashKey([]byte("capabilities"), []byte(langName), []byte(adapter), []byte(version))
+}
+
+// Capabilities returns the cached handshake answers of the adapters used by
+// schemas, by package root, for Preflight to reuse. Adapters without the
+// handshake are cached as nil like Preflight reports them. Overridden
+// adapters are always asked.
+func (c *OutputCache) Capabilities(langName string, schemas []retriever.RetrievedSchema, overrides map[string]parser.AdapterConfig) map[AdapterDir]*Capabilities {
+	if c == nil {
+		return nil
+	}
+	known := make(map[AdapterDir]*Capabilities)
+	for _, run := range adapterRuns(langName, schemas, overrides) {
+		if _, ok := overrides[run.adapter]; ok {
+			continue
+		}
+		version := c.version(langName, run.adapter, run.dir)
+		if version == "" {
+			continue
+		}
+		data, ok := c.store.Output(capabilitiesKey(langName, run.adapter, version))
+		var caps *Capabilities
+		if ok && json.Unmarshal(data, &caps) == nil && (caps == nil || caps.Protocol == ProtocolVersion) {
+			known[run.key()] = caps
+		}
+	}
+	return known
+}
+
+// PutCapabilities stores the handshake answers Preflight returned, except
+// those of overridden adapters
+func (c *OutputCache) PutCapabilities(langName string, capabilities map[AdapterDir]*Capabilities, overrides map[string]parser.AdapterConfig) {
+	if c == nil {
+		return
+	}
+	for key, caps := range capabilities {
+		if _, ok := overrides[key.Adapter]; ok {
+			continue
+		}
+		version := c.version(langName, key.Adapter, key.Dir)
+		if version == "" {
+			continue
+		}
+		data, err := json.Marshal(caps)
+		if err != nil {
+			continue
+		}
+		if err := c.store.PutOutput(capabilitiesKey(langName, key.Adapter, version), data); err != nil {
+			ui.Verbosef("failed to cache capabilities of %s: %v", key.Adapter, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xschemadev/xschema/cache"
+	"github.com/xschemadev/xschema/retriever"
+)
+
+// installAdapter makes the working directory a project with the count adapter
+// installed at version, so its outputs can be cached
+func installAdapter(t *testing.T, project, version string) {
+	t.Helper()
+	pkg := filepath.Join(project, "node_modules", "xschema-count")
+	if err := os.MkdirAll(filepath.Join(pkg, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"name": "xschema-count", "version": "` + version + `"}`
+	if err := os.WriteFile(filepath.Join(pkg, "package.json"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkg, "bin", "cli.js"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(project, "node_modules", ".bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(bin, "xschema-count"))
+	if err := os.Symlink(filepath.Join(pkg, "bin", "cli.js"), filepath.Join(bin, "xschema-count")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateAllCachesOutputs(t *testing.T) {
+	dir := fakeRunner(t)
+	project := t.TempDir()
+	t.Chdir(project)
+	installAdapter(t, project, "1.0.0")
+
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "C1", Schema: json.RawMessage(`{"type": "string"}`), Adapter: "count"},
+		{Namespace: "ns", ID: "C2", Schema: json.RawMessage(`{"type": "number"}`), Adapter: "count"},
+	}
+	runs := func() int {
+		data, _ := os.ReadFile(filepath.Join(dir, "count-runs"))
+		return strings.Count(string(data), "run")
+	}
+	generate := func(c *OutputCache, schemas []retriever.RetrievedSchema) string {
+		t.Helper()
+		outputs, err := GenerateAll(context.Background(), schemas, "typescript", Options{Cache: c})
+		if err != nil {
+			t.Fatalf("GenerateAll failed: %v", err)
+		}
+		var ids []string
+		for _, o := range outputs {
+			ids = append(ids, o.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	c := NewOutputCache(store)
+	if got := generate(c, schemas); got != "C1,C2" || runs() != 1 {
+		t.Fatalf("cold run: outputs %s, runs %d", got, runs())
+	}
+
+	// Warm: nothing is sent to the adapter, whitespace does not matter
+	warm := append([]retriever.RetrievedSchema(nil), schemas...)
+	warm[0].Schema = json.RawMessage(`{ "type" : "string" }`)
+	if got := generate(NewOutputCache(store), warm); got != "C1,C2" || runs() != 1 {
+		t.Fatalf("warm run: outputs %s, runs %d", got, runs())
+	}
+
+	// Changing options only regenerates that schema
+	changed := append([]retriever.RetrievedSchema(nil), schemas...)
+	changed[1].Options = map[string]json.RawMessage{"strict": json.RawMessage(`true`)}
+	if got := generate(NewOutputCache(store), changed); got != "C1,C2" || runs() != 2 {
+		t.Fatalf("options changed: outputs %s, runs %d", got, runs())
+	}
+
+	// A new adapter version invalidates everything
+	installAdapter(t, project, "2.0.0")
+	if got := generate(NewOutputCache(store), schemas); got != "C1,C2" || runs() != 3 {
+		t.Fatalf("version changed: outputs %s, runs %d", got, runs())
+	}
+}
+
+func TestOutputCacheSkipsUnresolvedVersions(t *testing.T) {
+	dir := fakeRunner(t)
+	t.Chdir(t.TempDir())
+
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "C1", Schema: json.RawMessage(`{}`), Adapter: "count"},
+	}
+	for range 2 {
+		if _, err := GenerateAll(context.Background(), schemas, "typescript", Options{Cache: NewOutputCache(store)}); err != nil {
+			t.Fatalf("GenerateAll failed: %v", err)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "count-runs"))
+	if n := strings.Count(string(data), "run"); n != 2 {
+		t.Errorf("expected the adapter to run every time without a known version, ran %d times", n)
+	}
+}
+
+func TestOutputCacheCapabilities(t *testing.T) {
+	project := t.TempDir()
+	t.Chdir(project)
+	installAdapter(t, project, "1.0.0")
+
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := []retriever.RetrievedSchema{{Namespace: "ns", ID: "C1", Adapter: "count"}}
+
+	c := NewOutputCache(store)
+	if known := c.Capabilities("typescript", schemas, nil); len(known) != 0 {
+		t.Fatalf("expected no cached capabilities, got %v", known)
+	}
+	c.PutCapabilities("typescript", map[AdapterDir]*Capabilities{{Adapter: "count"}: {Protocol: ProtocolVersion, Worker: true}}, nil)
+
+	known := NewOutputCache(store).Capabilities("typescript", schemas, nil)
+	if caps := known[AdapterDir{Adapter: "count"}]; caps == nil || !caps.Worker {
+		t.Errorf("expected cached capabilities, got %v", known)
+	}
+}
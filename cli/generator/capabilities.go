@@ -0,0 +1,257 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+	"golang.org/x/sync/errgroup"
+)
+
+// ProtocolVersion is the adapter protocol this CLI speaks
+// Adapters report theirs in response to CapabilitiesFlag.
+const ProtocolVersion = 1
+
+// CapabilitiesFlag asks an adapter binary to describe itself instead of converting
+const CapabilitiesFlag = "--xschema-capabilities"
+
+// Capabilities is an adapter's answer to the handshake
+type Capabilities struct {
+	Protocol int      `json:"protocol"`
+	Drafts   []string `json:"drafts"`   // JSON Schema drafts, e.g. "draft-07", "2020-12"; empty means not declared
+	Keywords []string `json:"keywords"` // keywords the adapter converts; empty means not declared
+	Options  []string `json:"options"`  // adapter options it accepts; missing means not declared, [] none
+	Worker   bool     `json:"worker"`   // can run as a long-lived worker (WorkerFlag)
+}
+
+// ProtocolError reports an adapter speaking a protocol version this CLI cannot use
+type ProtocolError struct {
+	Adapter  string
+	Protocol int
+}
+
+func (e *ProtocolError) Error() string {
+	if e.Protocol > ProtocolVersion {
+		return fmt.Sprintf("adapter %s speaks protocol %d, but this xschema CLI only supports protocol %d: upgrade the CLI",
+			e.Adapter, e.Protocol, ProtocolVersion)
+	}
+	return fmt.Sprintf("adapter %s speaks protocol %d, but this xschema CLI requires protocol %d: upgrade the adapter",
+		e.Adapter, e.Protocol, ProtocolVersion)
+}
+
+// Handshake asks an adapter for its capabilities
+// Adapters predating the handshake fail or answer with something other than
+// JSON; they are reported as (nil, nil) so callers can still run them.
+// Native adapters answer without starting a process.
+func Handshake(ctx context.Context, langName, adapter, dir string, override *parser.AdapterConfig) (*Capabilities, error) {
+	if n := native(langName, adapter, override); n != nil {
+		caps := n.capabilities
+		return &caps, nil
+	}
+	cmd, binName, err := adapterCommand(ctx, langName, adapter, dir, override, CapabilitiesFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		ui.Verbosef("adapter has no capabilities handshake: %s - %v %s", binName, err, stderr.String())
+		return nil, nil
+	}
+
+	var caps Capabilities
+	if err := json.Unmarshal(stdout.Bytes(), &caps); err != nil {
+		ui.Verbosef("adapter has no capabilities handshake: %s - invalid output: %s", binName, stdout.String())
+		return nil, nil
+	}
+	if caps.Protocol != ProtocolVersion {
+		return nil, &ProtocolError{Adapter: binName, Protocol: caps.Protocol}
+	}
+
+	ui.Verbosef("adapter capabilities: %s (protocol: %d, drafts: %v, keywords: %d, options: %v, worker: %t)",
+		binName, caps.Protocol, caps.Drafts, len(caps.Keywords), caps.Options, caps.Worker)
+	return &caps, nil
+}
+
+// PreflightResult is what Preflight learned about the adapters of a run
+type PreflightResult struct {
+	// Capabilities by adapter and package root; nil for adapters without the handshake
+	Capabilities map[AdapterDir]*Capabilities
+	// Warnings about schemas using drafts or keywords their adapter does not support
+	Warnings []string
+}
+
+// Preflight performs the handshake with every adapter used by schemas,
+// concurrently, and checks each schema against its adapter's capabilities.
+// An adapter is asked once in every package root it runs in, the way
+// GenerateAll runs it, unless known already has the answer. Fails if an
+// adapter is incompatible, so nothing is generated with it.
+func Preflight(ctx context.Context, schemas []retriever.RetrievedSchema, langName string, known map[AdapterDir]*Capabilities, overrides map[string]parser.AdapterConfig) (*PreflightResult, error) {
+	runs := adapterRuns(langName, schemas, overrides)
+
+	result := &PreflightResult{Capabilities: make(map[AdapterDir]*Capabilities, len(runs))}
+	var mu sync.Mutex
+	var legacy []string
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelAdapters)
+	for _, run := range runs {
+		if caps, ok := known[run.key()]; ok {
+			result.Capabilities[run.key()] = caps
+			continue
+		}
+		g.Go(func() error {
+			caps, err := Handshake(gctx, langName, run.adapter, run.dir, overrideFor(overrides, run.adapter))
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			result.Capabilities[run.key()] = caps
+			if caps == nil && !slices.Contains(legacy, run.adapter) {
+				legacy = append(legacy, run.adapter)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	slices.Sort(legacy)
+	for _, adapter := range legacy {
+		result.Warnings = append(result.Warnings, fmt.Sprintf(
+			"adapter %s does not report its capabilities; its schemas are not checked for unsupported keywords", adapter))
+	}
+	for _, run := range runs {
+		if caps := result.Capabilities[run.key()]; caps != nil {
+			for _, s := range run.schemas {
+				result.Warnings = append(result.Warnings, checkSchema(s, run.adapter, caps)...)
+			}
+		}
+	}
+	return result, nil
+}
+
+// checkSchema warns about the parts of a schema an adapter declared it cannot
+// handle, and about options it does not accept
+func checkSchema(s retriever.RetrievedSchema, adapter string, caps *Capabilities) []string {
+	var warnings []string
+	var unknown []string
+	for name := range s.Options {
+		if caps.Options != nil && !slices.Contains(caps.Options, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		slices.Sort(unknown)
+		warnings = append(warnings, fmt.Sprintf("%s sets options %s does not accept: %s",
+			s.Key(), adapter, strings.Join(unknown, ", ")))
+	}
+
+	var root any
+	if err := json.Unmarshal(s.Schema, &root); err != nil {
+		return warnings
+	}
+
+	if obj, ok := root.(map[string]any); ok && len(caps.Drafts) > 0 {
+		if uri, ok := obj["$schema"].(string); ok {
+			if draft := draftName(uri); draft != "" && !slices.Contains(caps.Drafts, draft) {
+				warnings = append(warnings, fmt.Sprintf("%s uses JSON Schema %s, which %s does not support (supported: %s)",
+					s.Key(), draft, adapter, strings.Join(caps.Drafts, ", ")))
+			}
+		}
+	}
+
+	if len(caps.Keywords) > 0 {
+		used := make(map[string]bool)
+		collectKeywords(root, used)
+		var unsupported []string
+		for kw := range used {
+			if !slices.Contains(caps.Keywords, kw) {
+				unsupported = append(unsupported, kw)
+			}
+		}
+		if len(unsupported) > 0 {
+			slices.Sort(unsupported)
+			warnings = append(warnings, fmt.Sprintf("%s uses keywords %s does not support: %s",
+				s.Key(), adapter, strings.Join(unsupported, ", ")))
+		}
+	}
+	return warnings
+}
+
+// draftName maps a $schema URI to the draft name adapters declare
+func draftName(uri string) string {
+	uri = strings.TrimSuffix(strings.TrimSuffix(uri, "#"), "/schema")
+	for _, draft := range []string{"draft-03", "draft-04", "draft-06", "draft-07", "2019-09", "2020-12"} {
+		if strings.HasSuffix(uri, "/"+draft) || strings.HasSuffix(uri, "/draft/"+draft) {
+			return draft
+		}
+	}
+	return ""
+}
+
+// ignoredKeywords never affect generated code, so adapters need not list them
+var ignoredKeywords = map[string]bool{
+	"$schema": true, "$id": true, "$anchor": true, "$comment": true,
+	"$defs": true, "definitions": true,
+	"title": true, "description": true, "examples": true, "default": true,
+	"deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// Keywords whose values are subschemas, by shape
+var (
+	subschemaKeywords = []string{"not", "if", "then", "else", "items", "additionalItems", "contains",
+		"additionalProperties", "unevaluatedItems", "unevaluatedProperties", "propertyNames", "contentSchema"}
+	subschemaListKeywords = []string{"allOf", "anyOf", "oneOf", "prefixItems", "items"}
+	subschemaMapKeywords  = []string{"properties", "patternProperties", "dependentSchemas", "$defs", "definitions"}
+)
+
+// collectKeywords adds the keywords used anywhere in a schema to used
+// Vendor extensions ("x-...") are skipped.
+func collectKeywords(schema any, used map[string]bool) {
+	obj, ok := schema.(map[string]any)
+	if !ok {
+		return
+	}
+	for kw, value := range obj {
+		if !ignoredKeywords[kw] && !strings.HasPrefix(kw, "x-") {
+			used[kw] = true
+		}
+		switch {
+		case slices.Contains(subschemaKeywords, kw) && isObject(value):
+			collectKeywords(value, used)
+		case slices.Contains(subschemaListKeywords, kw):
+			if list, ok := value.([]any); ok {
+				for _, v := range list {
+					collectKeywords(v, used)
+				}
+			}
+		case slices.Contains(subschemaMapKeywords, kw):
+			if m, ok := value.(map[string]any); ok {
+				for _, v := range m {
+					collectKeywords(v, used)
+				}
+			}
+		}
+	}
+}
+
+func isObject(v any) bool {
+	_, ok := v.(map[string]any)
+	return ok
+}
@@ -0,0 +1,125 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xschemadev/xschema/retriever"
+)
+
+func TestPreflight(t *testing.T) {
+	fakeRunner(t)
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "A", Adapter: "a", Schema: json.RawMessage(`{
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"title": "A",
+			"type": "object",
+			"properties": {"if": {"type": "string", "format": "email"}},
+			"x-internal": true
+		}`)},
+		{Namespace: "ns", ID: "B", Adapter: "b", Schema: json.RawMessage(`{"type": "string"}`)},
+		{Namespace: "ns", ID: "C", Adapter: "a", Schema: json.RawMessage(`{"type": "string"}`),
+			Options: map[string]json.RawMessage{"strict": json.RawMessage(`true`), "coerce": json.RawMessage(`true`)}},
+	}
+
+	res, err := Preflight(context.Background(), schemas, "typescript", nil, nil)
+	if err != nil {
+		t.Fatalf("Preflight failed: %v", err)
+	}
+	if res.Capabilities[AdapterDir{Adapter: "a"}] == nil || res.Capabilities[AdapterDir{Adapter: "a"}].Protocol != ProtocolVersion {
+		t.Errorf("expected capabilities for a, got %+v", res.Capabilities[AdapterDir{Adapter: "a"}])
+	}
+	if caps, ok := res.Capabilities[AdapterDir{Adapter: "b"}]; !ok || caps != nil {
+		t.Errorf("expected b to be recorded without capabilities, got %+v", caps)
+	}
+
+	want := []string{
+		"adapter b does not report its capabilities",
+		"ns:A uses JSON Schema 2020-12, which a does not support",
+		"ns:A uses keywords a does not support: format",
+		"ns:C sets options a does not accept: coerce, strict",
+	}
+	if len(res.Warnings) != len(want) {
+		t.Fatalf("expected %d warnings, got %q", len(want), res.Warnings)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(res.Warnings[i], w) {
+			t.Errorf("warning %d = %q, want prefix %q", i, res.Warnings[i], w)
+		}
+	}
+
+	// Known adapters are not asked again, and what they leave undeclared,
+	// options included, is not checked
+	known := map[AdapterDir]*Capabilities{{Adapter: "a"}: {Protocol: ProtocolVersion}}
+	res, err = Preflight(context.Background(), []retriever.RetrievedSchema{schemas[0], schemas[2]}, "typescript", known, nil)
+	if err != nil {
+		t.Fatalf("Preflight failed: %v", err)
+	}
+	if a := (AdapterDir{Adapter: "a"}); res.Capabilities[a] != known[a] || len(res.Warnings) != 0 {
+		t.Errorf("expected the known capabilities to be reused, got %+v, %q", res.Capabilities[a], res.Warnings)
+	}
+}
+
+func TestPreflightPerPackageRoot(t *testing.T) {
+	fakeRunner(t)
+	dir := t.TempDir()
+	for _, pkg := range []string{"web", "api"} {
+		if err := os.Mkdir(filepath.Join(dir, pkg), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// xschema-pwd accepts the option named after the package it runs in
+	strict := map[string]json.RawMessage{"web": json.RawMessage(`true`)}
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "Web", Schema: json.RawMessage(`{}`), Adapter: "pwd", Dir: filepath.Join(dir, "web"), Options: strict},
+		{Namespace: "ns", ID: "Api", Schema: json.RawMessage(`{}`), Adapter: "pwd", Dir: filepath.Join(dir, "api"), Options: strict},
+	}
+	res, err := Preflight(context.Background(), schemas, "typescript", nil, nil)
+	if err != nil {
+		t.Fatalf("Preflight failed: %v", err)
+	}
+	if len(res.Capabilities) != 2 {
+		t.Errorf("expected one handshake per package root, got %v", res.Capabilities)
+	}
+	if len(res.Warnings) != 1 || !strings.HasPrefix(res.Warnings[0], "ns:Api sets options pwd does not accept: web") {
+		t.Errorf("expected each schema checked against its own package's adapter, got %q", res.Warnings)
+	}
+}
+
+func TestPreflightRejectsIncompatibleProtocol(t *testing.T) {
+	fakeRunner(t)
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "F", Adapter: "future", Schema: json.RawMessage(`{}`)},
+	}
+	_, err := Preflight(context.Background(), schemas, "typescript", nil, nil)
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.Protocol != 2 {
+		t.Fatalf("expected *ProtocolError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "upgrade the CLI") {
+		t.Errorf("expected advice to upgrade the CLI, got %v", err)
+	}
+}
+
+func TestDraftName(t *testing.T) {
+	tests := map[string]string{
+		"http://json-schema.org/draft-07/schema#":        "draft-07",
+		"http://json-schema.org/draft-04/schema":         "draft-04",
+		"https://json-schema.org/draft/2020-12/schema":   "2020-12",
+		"https://json-schema.org/draft/2019-09/schema#":  "2019-09",
+		"https://spec.openapis.org/oas/3.1/dialect/base": "",
+	}
+	for uri, want := range tests {
+		if got := draftName(uri); got != want {
+			t.Errorf("draftName(%q) = %q, want %q", uri, got, want)
+		}
+	}
+}
@@ -4,28 +4,41 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/xschemadev/xschema/language"
+	"github.com/xschemadev/xschema/parser"
 	"github.com/xschemadev/xschema/retriever"
 	"github.com/xschemadev/xschema/ui"
+	"golang.org/x/sync/errgroup"
 )
 
 // GenerateInput is sent to the adapter CLI
 type GenerateInput struct {
-	Namespace string          `json:"namespace"`
-	ID        string          `json:"id"`
-	Schema    json.RawMessage `json:"schema"`
+	Namespace string                     `json:"namespace"`
+	ID        string                     `json:"id"`
+	Schema    json.RawMessage            `json:"schema"`
+	Options   map[string]json.RawMessage `json:"options,omitempty"` // adapter options set in the config
+	VarName   string                     `json:"varName,omitempty"` // identifier to declare the code as, e.g. "user_User"
 }
 
 // GenerateOutput is received from the adapter CLI
 type GenerateOutput struct {
 	Namespace string   `json:"namespace"`
 	ID        string   `json:"id"`
-	Schema    string   `json:"schema"`  // generated code expression
-	Type      string   `json:"type"`    // type expression
-	Imports   []string `json:"imports"` // required imports
+	Schema    string   `json:"schema"`             // generated code expression
+	Type      string   `json:"type"`               // type expression
+	Imports   []string `json:"imports"`            // required imports
+	Error     string   `json:"error,omitempty"`    // set when the adapter could not convert this schema
+	Warnings  []string `json:"warnings,omitempty"` // non-fatal notes about the conversion
+	VarName   string   `json:"varName,omitempty"`  // the input's VarName, set by the CLI rather than adapters
 }
 
 // Key returns the full namespaced key like "namespace:id"
@@ -33,99 +46,463 @@ func (o GenerateOutput) Key() string {
 	return o.Namespace + ":" + o.ID
 }
 
+// Options configures GenerateAll
+type Options struct {
+	// KeepGoing runs every adapter to completion instead of cancelling on the
+	// first failure, and returns the outputs that succeeded with the error
+	KeepGoing bool
+	// Workers, when set, runs the adapters whose Capabilities report worker
+	// support in long-lived processes; the others still get one process per batch
+	Workers *WorkerPool
+	// Capabilities by adapter and package root, as returned by Preflight
+	Capabilities map[AdapterDir]*Capabilities
+	// Cache, when set, serves unchanged schemas from earlier runs; only
+	// the rest are sent to their adapter
+	Cache *OutputCache
+	// Timeout and MaxOutput limit each adapter run, see GenerateBatchInput
+	Timeout   time.Duration
+	MaxOutput int
+	// Overrides start the adapters they name with their own command instead
+	// of through the package runner
+	Overrides map[string]parser.AdapterConfig
+}
+
+// Failure is a schema that could not be generated
+type Failure struct {
+	Namespace string
+	ID        string
+	Adapter   string
+	Message   string
+}
+
+// Key returns the full namespaced key like "namespace:id"
+func (f Failure) Key() string {
+	return f.Namespace + ":" + f.ID
+}
+
+// FailedError lists the schemas that failed to generate, grouped by adapter
+// and message in its text. With Options.KeepGoing, GenerateAll returns it
+// alongside the outputs of every schema that succeeded.
+type FailedError struct {
+	Failures []Failure
+}
+
+func (e *FailedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d schema(s) failed to generate:", len(e.Failures))
+
+	byAdapter := make(map[string][]Failure)
+	var adapters []string
+	for _, f := range e.Failures {
+		if _, ok := byAdapter[f.Adapter]; !ok {
+			adapters = append(adapters, f.Adapter)
+		}
+		byAdapter[f.Adapter] = append(byAdapter[f.Adapter], f)
+	}
+	slices.Sort(adapters)
+
+	for _, adapter := range adapters {
+		fmt.Fprintf(&b, "\n  %s", adapter)
+		// Schemas sharing a message, e.g. a crashed adapter, are listed together
+		var messages []string
+		keys := make(map[string][]string)
+		for _, f := range byAdapter[adapter] {
+			if _, ok := keys[f.Message]; !ok {
+				messages = append(messages, f.Message)
+			}
+			keys[f.Message] = append(keys[f.Message], f.Key())
+		}
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "\n    %s: %s", strings.Join(keys[msg], ", "),
+				strings.ReplaceAll(strings.TrimSpace(msg), "\n", "\n      "))
+		}
+	}
+	return b.String()
+}
+
 // GenerateBatchInput groups schemas by adapter for batch processing
 type GenerateBatchInput struct {
 	Adapter  string // adapter package e.g., "zod"
 	Language string // language name e.g., "typescript"
+	Dir      string // package root to run the adapter in; "" for the current directory
 	Schemas  []retriever.RetrievedSchema
+
+	Timeout   time.Duration         // kill the adapter after this long; 0 means no limit
+	MaxOutput int                   // kill the adapter once it writes more bytes to stdout; 0 means no limit
+	Override  *parser.AdapterConfig // start the adapter with this instead of the package runner
+
+	// Reserved are the names the language's other schemas are declared as,
+	// which native adapters keep the names they choose clear of
+	Reserved []string
 }
 
-// Generate calls the adapter to convert schemas to native code
-func Generate(ctx context.Context, input GenerateBatchInput) ([]GenerateOutput, error) {
-	lang := language.ByName(input.Language)
-	if lang == nil {
-		return nil, fmt.Errorf("unsupported language: %s", input.Language)
+// overrideFor returns the override of an adapter, or nil
+func overrideFor(overrides map[string]parser.AdapterConfig, adapter string) *parser.AdapterConfig {
+	if o, ok := overrides[adapter]; ok {
+		return &o
 	}
+	return nil
+}
 
-	runner, args, err := lang.DetectRunner()
-	if err != nil {
-		return nil, err
+// adapterCommand builds the command that runs an adapter binary in dir through
+// the package runner detected for dir, e.g. "npx xschema-zod", or through its
+// override, which runs in its own directory
+func adapterCommand(ctx context.Context, langName, adapter, dir string, override *parser.AdapterConfig, extraArgs ...string) (*exec.Cmd, string, error) {
+	lang := language.ByName(langName)
+	if lang == nil {
+		return nil, "", fmt.Errorf("unsupported language: %s", langName)
 	}
 
 	// Construct bin name: "zod" -> "xschema-zod"
-	binName := lang.AdapterBinPrefix + input.Adapter
+	binName := lang.AdapterBinPrefix + adapter
 
-	ui.Verbosef("running adapter: %s (language: %s, runner: %s, schemas: %d)", binName, input.Language, runner, len(input.Schemas))
+	var runner string
+	var args []string
+	if override != nil {
+		cmdLine, err := overrideCommand(lang, binName, *override)
+		if err != nil {
+			return nil, "", err
+		}
+		runner, args, dir = cmdLine[0], cmdLine[1:], override.Dir
+		ui.Verbosef("using adapter override from %s: %s", override.Origin, strings.Join(cmdLine, " "))
+	} else {
+		var err error
+		runner, args, err = lang.DetectRunner(dir)
+		if err != nil {
+			return nil, "", err
+		}
+		args = append(args, binName)
+	}
 
 	// Check runner exists
 	if _, err := exec.LookPath(runner); err != nil {
 		ui.Verbosef("runner not found: %s", runner)
-		return nil, fmt.Errorf("%s not found: %w", runner, err)
+		return nil, "", fmt.Errorf("%s not found: %w", runner, err)
 	}
 
-	// Build input for adapter
-	adapterInput := make([]GenerateInput, len(input.Schemas))
-	for i, s := range input.Schemas {
-		adapterInput[i] = GenerateInput{
-			Namespace: s.Namespace,
-			ID:        s.ID,
-			Schema:    s.Schema,
+	cmdArgs := append(args, extraArgs...)
+	ui.Verbosef("executing adapter command: %s %v", runner, cmdArgs)
+	cmd := exec.CommandContext(ctx, runner, cmdArgs...)
+	cmd.Dir = dir
+	setProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	return cmd, binName, nil
+}
+
+// overrideCommand returns the command line an override starts an adapter
+// with. A relative program or path resolves against the override's directory;
+// a path is run with the language's script runner, and a package directory
+// with the script its manifest declares for binName.
+func overrideCommand(lang *language.Language, binName string, o parser.AdapterConfig) ([]string, error) {
+	if len(o.Command) > 0 {
+		cmdLine := slices.Clone(o.Command)
+		if strings.ContainsRune(cmdLine[0], '/') || strings.ContainsRune(cmdLine[0], filepath.Separator) {
+			cmdLine[0] = resolvePath(o.Dir, cmdLine[0])
 		}
+		return cmdLine, nil
 	}
 
-	cmdArgs := append(args, binName)
-	cmd := exec.CommandContext(ctx, runner, cmdArgs...)
+	path := resolvePath(o.Dir, o.Path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("adapter %s from %s: %w", binName, o.Origin, err)
+	}
+	if info.IsDir() && lang.PackageBin != nil {
+		if path, err = lang.PackageBin(path, binName); err != nil {
+			return nil, fmt.Errorf("adapter %s from %s: %w", binName, o.Origin, err)
+		}
+	}
+	if len(lang.ScriptRunner) == 0 {
+		return nil, fmt.Errorf("adapter %s from %s: %s adapters cannot be run from a path, set a command instead", binName, o.Origin, lang.Name)
+	}
+	return append(slices.Clone(lang.ScriptRunner), path), nil
+}
+
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Generate calls the adapter to convert schemas to native code
+// The adapter's process group is killed when it runs longer than
+// input.Timeout or writes more than input.MaxOutput bytes.
+// Native adapters convert the batch in-process instead.
+func Generate(ctx context.Context, input GenerateBatchInput) ([]GenerateOutput, error) {
+	if n := native(input.Language, input.Adapter, input.Override); n != nil {
+		return n.run(input), nil
+	}
+
+	ctx, kill := context.WithCancelCause(ctx)
+	defer kill(nil)
+	if input.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, input.Timeout, timeoutError(input.Timeout))
+		defer cancel()
+	}
+
+	cmd, binName, err := adapterCommand(ctx, input.Language, input.Adapter, input.Dir, input.Override)
+	if err != nil {
+		return nil, err
+	}
+
+	ui.Verbosef("running adapter: %s (language: %s, schemas: %d)", binName, input.Language, len(input.Schemas))
 
 	// Pipe schemas to stdin
-	stdinData, err := json.Marshal(adapterInput)
+	stdinData, err := json.Marshal(adapterInputs(input.Schemas))
 	if err != nil {
 		ui.Verbosef("failed to marshal schemas for adapter %s", binName)
 		return nil, fmt.Errorf("failed to marshal schemas: %w", err)
 	}
 	cmd.Stdin = bytes.NewReader(stdinData)
 
-	ui.Verbosef("executing adapter command: %s %v", runner, cmdArgs)
-
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	stdout := &limitWriter{max: input.MaxOutput, exceeded: func() { kill(outputLimitError(input.MaxOutput)) }}
+	stderr := newStderrWriter(binName)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 
-	if err := cmd.Run(); err != nil {
-		ui.Verbosef("adapter execution failed: %s - %s", binName, stderr.String())
+	err = cmd.Run()
+	stderr.flush()
+	var limit *limitError
+	if stdout.over || errors.As(context.Cause(ctx), &limit) {
+		if limit == nil {
+			limit = outputLimitError(input.MaxOutput)
+		}
+		ui.Verbosef("adapter killed: %s - %v", binName, limit)
+		return nil, killedError(binName, limit, input.Schemas)
+	}
+	if err != nil {
+		ui.Verbosef("adapter execution failed: %s - %v", binName, err)
 		return nil, fmt.Errorf("adapter %s failed: %w\n%s", binName, err, stderr.String())
 	}
 
 	var outputs []GenerateOutput
-	if err := json.Unmarshal(stdout.Bytes(), &outputs); err != nil {
-		ui.Verbosef("invalid adapter output from %s: %s", binName, stdout.String())
-		return nil, fmt.Errorf("invalid output from %s: %w\noutput: %s", binName, err, stdout.String())
+	if err := json.Unmarshal(stdout.buf.Bytes(), &outputs); err != nil {
+		ui.Verbosef("invalid adapter output from %s: %s", binName, stdout.buf.String())
+		return nil, fmt.Errorf("invalid output from %s: %w\noutput: %s", binName, err, stdout.buf.String())
 	}
 
 	ui.Verbosef("adapter execution successful: %s (outputs: %d)", binName, len(outputs))
 	return outputs, nil
 }
 
+// adapterInputs builds the input the adapter receives for a batch of schemas
+func adapterInputs(schemas []retriever.RetrievedSchema) []GenerateInput {
+	inputs := make([]GenerateInput, len(schemas))
+	for i, s := range schemas {
+		inputs[i] = GenerateInput{
+			Namespace: s.Namespace,
+			ID:        s.ID,
+			Schema:    s.Schema,
+			Options:   s.Options,
+			VarName:   s.VarName,
+		}
+	}
+	return inputs
+}
+
+// maxParallelAdapters bounds how many adapter processes run at once
+const maxParallelAdapters = 4
+
+// adapterRun is the share of GenerateAll one adapter process gets: the
+// adapter's schemas from one package root
+type adapterRun struct {
+	adapter string
+	dir     string
+	schemas []retriever.RetrievedSchema
+}
+
+// AdapterDir names an adapter as installed in one package root; Dir is empty
+// for adapters that do not run in one (native and overridden adapters)
+type AdapterDir struct {
+	Adapter string
+	Dir     string
+}
+
+func (r adapterRun) key() AdapterDir {
+	return AdapterDir{Adapter: r.adapter, Dir: r.dir}
+}
+
+// adapterRuns splits each adapter's schemas by the package root they run in,
+// so every package uses the adapter version it installed. Native adapters
+// need no package and overridden ones start where their override says, so
+// each of those gets one run with all of its schemas.
+func adapterRuns(langName string, schemas []retriever.RetrievedSchema, overrides map[string]parser.AdapterConfig) []adapterRun {
+	groups := retriever.GroupByAdapter(schemas)
+	var runs []adapterRun
+	for _, adapter := range retriever.SortedAdapters(groups) {
+		first := len(runs)
+		override := overrideFor(overrides, adapter)
+		whole := override != nil || native(langName, adapter, override) != nil
+		for _, s := range groups[adapter] {
+			dir := s.Dir
+			if whole {
+				dir = ""
+			}
+			i := slices.IndexFunc(runs[first:], func(r adapterRun) bool { return r.dir == dir })
+			if i < 0 {
+				runs = append(runs, adapterRun{adapter: adapter, dir: dir})
+				i = len(runs) - 1 - first
+			}
+			runs[first+i].schemas = append(runs[first+i].schemas, s)
+		}
+	}
+	return runs
+}
+
 // GenerateAll runs generation for all adapter groups and returns all outputs
-func GenerateAll(ctx context.Context, schemas []retriever.RetrievedSchema, langName string) ([]GenerateOutput, error) {
+// Adapters run concurrently, once per package root their schemas are in;
+// outputs are ordered by adapter, then declaration.
+// With opts.Cache, adapters only get the schemas it has no output for, and
+// are not run at all when it has every one; overridden adapters always run.
+// Schemas the adapters report as failed are returned in a *FailedError.
+// Otherwise the first adapter failure cancels adapters still running or
+// waiting, and the returned error joins the failures of every adapter that
+// failed on its own; with opts.KeepGoing it fails just that adapter's schemas.
+func GenerateAll(ctx context.Context, schemas []retriever.RetrievedSchema, langName string, opts Options) ([]GenerateOutput, error) {
 	groups := retriever.GroupByAdapter(schemas)
-	adapters := retriever.SortedAdapters(groups)
+	runs := adapterRuns(langName, schemas, opts.Overrides)
+	reserved := make([]string, len(schemas))
+	for i, s := range schemas {
+		reserved[i] = s.VarName
+	}
 
-	var allOutputs []GenerateOutput
+	results := make([][]GenerateOutput, len(runs))
+	failures := make([][]Failure, len(runs))
+	errs := make([]error, len(runs))
 
-	for _, adapter := range adapters {
-		batch := GenerateBatchInput{
-			Adapter:  adapter,
-			Language: langName,
-			Schemas:  groups[adapter],
-		}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(maxParallelAdapters)
 
-		outputs, err := Generate(ctx, batch)
-		if err != nil {
-			return nil, err
-		}
+	for i, run := range runs {
+		adapter := run.adapter
+		g.Go(func() error {
+			if gctx.Err() != nil {
+				return nil
+			}
+			batch := GenerateBatchInput{
+				Adapter:   adapter,
+				Language:  langName,
+				Dir:       run.dir,
+				Timeout:   opts.Timeout,
+				MaxOutput: opts.MaxOutput,
+				Override:  overrideFor(opts.Overrides, adapter),
+				Reserved:  reserved,
+			}
+			var cached []GenerateOutput
+			cached, batch.Schemas = opts.Cache.lookup(langName, adapter, run.dir, batch.Override, run.schemas)
+			results[i] = cached
+			if len(batch.Schemas) == 0 {
+				return nil
+			}
+
+			generate := Generate
+			if caps := opts.Capabilities[run.key()]; opts.Workers != nil && caps != nil && caps.Worker {
+				generate = opts.Workers.Generate
+			}
+			outputs, err := generate(gctx, batch)
+			if err != nil {
+				if gctx.Err() != nil {
+					// Killed because another adapter failed (or the caller gave up)
+					ui.Verbosef("adapter cancelled: %s", adapter)
+					return nil
+				}
+				if opts.KeepGoing {
+					for _, s := range batch.Schemas {
+						failures[i] = append(failures[i], Failure{Namespace: s.Namespace, ID: s.ID, Adapter: adapter, Message: err.Error()})
+					}
+					return nil
+				}
+				errs[i] = err
+				return err
+			}
+			generated, failed := splitOutputs(orderOutputs(outputs, batch.Schemas), batch)
+			setVarNames(generated, batch.Schemas)
+			opts.Cache.put(langName, adapter, run.dir, batch.Override, batch.Schemas, generated)
+			results[i] = append(cached, generated...)
+			failures[i] = failed
+			return nil
+		})
+	}
+	g.Wait()
 
-		allOutputs = append(allOutputs, outputs...)
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	// Nothing failed on its own, so any cancellation came from the caller
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
+	var allOutputs []GenerateOutput
+	for start := 0; start < len(runs); {
+		end := start + 1
+		for end < len(runs) && runs[end].adapter == runs[start].adapter {
+			end++
+		}
+		allOutputs = append(allOutputs, orderOutputs(slices.Concat(results[start:end]...), groups[runs[start].adapter])...)
+		start = end
+	}
+	if failed := slices.Concat(failures...); len(failed) > 0 {
+		err := &FailedError{Failures: failed}
+		if opts.KeepGoing {
+			return allOutputs, err
+		}
+		return nil, err
+	}
 	return allOutputs, nil
 }
+
+// setVarNames records on each output the name its schema's code was declared
+// as, so the output file uses it too
+func setVarNames(outputs []GenerateOutput, schemas []retriever.RetrievedSchema) {
+	names := make(map[string]string, len(schemas))
+	for _, s := range schemas {
+		names[s.Key()] = s.VarName
+	}
+	for i := range outputs {
+		outputs[i].VarName = names[outputs[i].Key()]
+	}
+}
+
+// splitOutputs separates an adapter's outputs from the schemas it failed,
+// counting schemas it returned nothing for as failed
+func splitOutputs(outputs []GenerateOutput, batch GenerateBatchInput) ([]GenerateOutput, []Failure) {
+	var ok []GenerateOutput
+	var failed []Failure
+	seen := make(map[string]bool, len(outputs))
+	for _, o := range outputs {
+		seen[o.Key()] = true
+		if o.Error != "" {
+			failed = append(failed, Failure{Namespace: o.Namespace, ID: o.ID, Adapter: batch.Adapter, Message: o.Error})
+			continue
+		}
+		ok = append(ok, o)
+	}
+	for _, s := range batch.Schemas {
+		if !seen[s.Key()] {
+			failed = append(failed, Failure{Namespace: s.Namespace, ID: s.ID, Adapter: batch.Adapter, Message: "adapter returned no output for this schema"})
+		}
+	}
+	return ok, failed
+}
+
+// orderOutputs sorts an adapter's outputs into the order of its input schemas
+// Outputs the adapter added for keys it was not given keep their place at the end.
+func orderOutputs(outputs []GenerateOutput, schemas []retriever.RetrievedSchema) []GenerateOutput {
+	position := make(map[string]int, len(schemas))
+	for i, s := range schemas {
+		position[s.Key()] = i
+	}
+	rank := func(o GenerateOutput) int {
+		if i, ok := position[o.Key()]; ok {
+			return i
+		}
+		return len(schemas)
+	}
+	slices.SortStableFunc(outputs, func(a, b GenerateOutput) int {
+		return rank(a) - rank(b)
+	})
+	return outputs
+}
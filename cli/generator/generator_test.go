@@ -3,9 +3,16 @@ package generator
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/xschemadev/xschema/language"
+	"github.com/xschemadev/xschema/parser"
 	"github.com/xschemadev/xschema/retriever"
 )
 
@@ -77,7 +84,7 @@ func TestGenerateContextCancellation(t *testing.T) {
 }
 
 func TestGenerateAllEmptySchemas(t *testing.T) {
-	outputs, err := GenerateAll(context.Background(), []retriever.RetrievedSchema{}, "typescript")
+	outputs, err := GenerateAll(context.Background(), []retriever.RetrievedSchema{}, "typescript", Options{})
 	if err != nil {
 		t.Fatalf("GenerateAll failed: %v", err)
 	}
@@ -108,3 +115,331 @@ func TestGenerateInputJSON(t *testing.T) {
 		t.Errorf("round-trip failed: %+v", decoded)
 	}
 }
+
+// fakeRunner puts a "bunx" on PATH that answers for the adapters used in
+// tests, and moves into a project without a package manager preference
+func fakeRunner(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake runner is a shell script")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+# "bunx xschema-<adapter>": a and b only finish if they run at the same time
+if [ "$2" = "--xschema-capabilities" ]; then
+	case "$1" in
+	xschema-a) echo '{"protocol":1,"drafts":["draft-07"],"keywords":["type","properties"],"options":[]}' ;;
+	xschema-future) echo '{"protocol":2}' ;;
+	xschema-pwd) echo "{\"protocol\":1,\"options\":[\"$(basename "$PWD")\"]}" ;;
+	*) echo "unknown option $2" >&2; exit 1 ;;
+	esac
+	exit 0
+fi
+if [ "$2" = "--xschema-worker" ]; then
+	# Answers one request per line; crashes on the first schema containing "crash"
+	echo started >> "` + dir + `/worker-starts"
+	while IFS= read -r line; do
+		id=$(echo "$line" | sed 's/^{"id":\([0-9]*\).*/\1/')
+		case "$line" in
+		*'"method":"ping"'*) echo "{\"id\":$id}" ;;
+		*'"hang"'*) sleep 30 ;;
+		*'"crash"'*) if [ ! -e "` + dir + `/crashed" ]; then touch "` + dir + `/crashed"; echo "worker crashed" >&2; exit 1; fi ;;
+		esac
+		case "$line" in
+		*'"method":"convert"'*) echo "{\"id\":$id,\"outputs\":[{\"namespace\":\"ns\",\"id\":\"W\",\"schema\":\"w\",\"type\":\"t\",\"imports\":[]}]}" ;;
+		esac
+	done
+	exit 0
+fi
+if [ "$1" = "xschema-count" ]; then
+	# Converts exactly the schemas it is sent, counting its runs
+	echo run >> "` + dir + `/count-runs"
+	input=$(cat)
+	sep=""
+	printf '['
+	for id in C1 C2; do
+		case "$input" in *"\"id\":\"$id\""*)
+			printf '%s{"namespace":"ns","id":"%s","schema":"%s","type":"t","imports":[]}' "$sep" "$id" "$id"; sep="," ;;
+		esac
+	done
+	echo ']'
+	exit 0
+fi
+cat > /dev/null
+wait_for() {
+	for i in $(seq 50); do [ -e "` + dir + `/$1" ] && return 0; sleep 0.1; done
+	echo "timed out waiting for $1" >&2; exit 1
+}
+case "$1" in
+xschema-a)
+	touch "` + dir + `/a"; wait_for b
+	echo '[{"namespace":"ns","id":"A2","schema":"a2","type":"t","imports":[]},{"namespace":"ns","id":"A1","schema":"a1","type":"t","imports":[]}]' ;;
+xschema-b)
+	touch "` + dir + `/b"; wait_for a
+	echo '[{"namespace":"ns","id":"B1","schema":"b1","type":"t","imports":[]}]' ;;
+xschema-fail)
+	echo "boom" >&2; exit 1 ;;
+xschema-partial)
+	echo '[{"namespace":"ns","id":"Good","schema":"g","type":"t","imports":[],"warnings":["dropped format"]},{"namespace":"ns","id":"Bad","schema":"","type":"","imports":[],"error":"unsupported keyword"}]' ;;
+xschema-slow)
+	exec sleep 10 ;;
+xschema-hang)
+	sleep 30 & echo $! > "` + dir + `/hang-child"; wait ;;
+xschema-flood)
+	exec yes ;;
+xschema-pwd)
+	echo "[{\"namespace\":\"ns\",\"id\":\"$(basename "$PWD")\",\"schema\":\"s\",\"type\":\"t\",\"imports\":[]}]" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "bunx"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Chdir("testdata/typescript")
+	return dir
+}
+
+func TestGenerateAllParallel(t *testing.T) {
+	fakeRunner(t)
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "B1", Schema: json.RawMessage(`{}`), Adapter: "b"},
+		{Namespace: "ns", ID: "A1", Schema: json.RawMessage(`{}`), Adapter: "a"},
+		{Namespace: "ns", ID: "A2", Schema: json.RawMessage(`{}`), Adapter: "a"},
+	}
+	outputs, err := GenerateAll(context.Background(), schemas, "typescript", Options{})
+	if err != nil {
+		t.Fatalf("GenerateAll failed: %v", err)
+	}
+
+	var keys []string
+	for _, o := range outputs {
+		keys = append(keys, o.ID)
+	}
+	if got := strings.Join(keys, ","); got != "A1,A2,B1" {
+		t.Errorf("expected outputs sorted by adapter, then declaration, got %s", got)
+	}
+}
+
+func TestGenerateAllPackageRoots(t *testing.T) {
+	fakeRunner(t)
+	dir := t.TempDir()
+	for _, pkg := range []string{"web", "api"} {
+		if err := os.Mkdir(filepath.Join(dir, pkg), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each package's schemas are converted by a run in that package
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "web", Schema: json.RawMessage(`{}`), Adapter: "pwd", Dir: filepath.Join(dir, "web")},
+		{Namespace: "ns", ID: "api", Schema: json.RawMessage(`{}`), Adapter: "pwd", Dir: filepath.Join(dir, "api")},
+	}
+	outputs, err := GenerateAll(context.Background(), schemas, "typescript", Options{})
+	if err != nil {
+		t.Fatalf("GenerateAll failed: %v", err)
+	}
+	if len(outputs) != 2 || outputs[0].ID != "web" || outputs[1].ID != "api" {
+		t.Errorf("expected one run per package root in declaration order, got %+v", outputs)
+	}
+}
+
+func TestGenerateAllFailureCancelsOthers(t *testing.T) {
+	fakeRunner(t)
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "S", Schema: json.RawMessage(`{}`), Adapter: "slow"},
+		{Namespace: "ns", ID: "F", Schema: json.RawMessage(`{}`), Adapter: "fail"},
+	}
+	start := time.Now()
+	_, err := GenerateAll(context.Background(), schemas, "typescript", Options{})
+	if err == nil {
+		t.Fatal("expected error from failing adapter")
+	}
+	if !strings.Contains(err.Error(), "xschema-fail") || strings.Contains(err.Error(), "xschema-slow") {
+		t.Errorf("expected only the failing adapter's error, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("slow adapter was not cancelled (took %s)", elapsed)
+	}
+}
+
+func TestGenerateAllItemErrors(t *testing.T) {
+	fakeRunner(t)
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "Good", Schema: json.RawMessage(`{}`), Adapter: "partial"},
+		{Namespace: "ns", ID: "Bad", Schema: json.RawMessage(`{}`), Adapter: "partial"},
+		{Namespace: "ns", ID: "Missing", Schema: json.RawMessage(`{}`), Adapter: "partial"},
+	}
+
+	outputs, err := GenerateAll(context.Background(), schemas, "typescript", Options{})
+	var failed *FailedError
+	if !errors.As(err, &failed) || outputs != nil {
+		t.Fatalf("expected *FailedError and no outputs, got %v, %v", outputs, err)
+	}
+
+	outputs, err = GenerateAll(context.Background(), schemas, "typescript", Options{KeepGoing: true})
+	if !errors.As(err, &failed) {
+		t.Fatalf("expected *FailedError, got %v", err)
+	}
+	if len(outputs) != 1 || outputs[0].ID != "Good" || len(outputs[0].Warnings) != 1 {
+		t.Errorf("expected only the good schema with its warning, got %+v", outputs)
+	}
+	if len(failed.Failures) != 2 || failed.Failures[0].Key() != "ns:Bad" || failed.Failures[1].Key() != "ns:Missing" {
+		t.Errorf("unexpected failures: %+v", failed.Failures)
+	}
+}
+
+func TestGenerateAllKeepGoing(t *testing.T) {
+	fakeRunner(t)
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "F1", Schema: json.RawMessage(`{}`), Adapter: "fail"},
+		{Namespace: "ns", ID: "F2", Schema: json.RawMessage(`{}`), Adapter: "fail"},
+		{Namespace: "ns", ID: "Good", Schema: json.RawMessage(`{}`), Adapter: "partial"},
+	}
+	outputs, err := GenerateAll(context.Background(), schemas, "typescript", Options{KeepGoing: true})
+	var failed *FailedError
+	if !errors.As(err, &failed) {
+		t.Fatalf("expected *FailedError, got %v", err)
+	}
+	if len(outputs) != 1 || outputs[0].ID != "Good" {
+		t.Errorf("expected the other adapter's output, got %+v", outputs)
+	}
+	if len(failed.Failures) != 3 {
+		t.Errorf("expected every schema of the crashed adapter plus the item error, got %+v", failed.Failures)
+	}
+}
+
+func TestFailedErrorGroupsByAdapterAndMessage(t *testing.T) {
+	err := &FailedError{Failures: []Failure{
+		{Namespace: "ns", ID: "B", Adapter: "zod", Message: "adapter crashed\nstack"},
+		{Namespace: "ns", ID: "A", Adapter: "arktype", Message: "bad"},
+		{Namespace: "ns", ID: "C", Adapter: "zod", Message: "adapter crashed\nstack"},
+	}}
+	want := `3 schema(s) failed to generate:
+  arktype
+    ns:A: bad
+  zod
+    ns:B, ns:C: adapter crashed
+      stack`
+	if err.Error() != want {
+		t.Errorf("unexpected report:\n%s\nwant:\n%s", err.Error(), want)
+	}
+}
+
+func TestGenerateOverride(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("adapter is a shell script")
+	}
+	// No package runner is needed, and none is on PATH
+	t.Setenv("PATH", "/bin:/usr/bin")
+	dir := t.TempDir()
+	script := `cat > /dev/null; echo "[{\"namespace\":\"ns\",\"id\":\"L\",\"schema\":\"$1\",\"type\":\"t\",\"imports\":[]}]"`
+	if err := os.MkdirAll(filepath.Join(dir, "tools"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tools", "adapter.sh"), []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	schemas := []retriever.RetrievedSchema{{Namespace: "ns", ID: "L", Schema: json.RawMessage(`{}`), Adapter: "local"}}
+	outputs, err := GenerateAll(context.Background(), schemas, "typescript", Options{
+		Overrides: map[string]parser.AdapterConfig{
+			"local": {Command: []string{"sh", "./tools/adapter.sh", "from-override"}, Dir: dir, Origin: "test"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("GenerateAll failed: %v", err)
+	}
+	if len(outputs) != 1 || outputs[0].Schema != "from-override" {
+		t.Errorf("expected the override's output, got %+v", outputs)
+	}
+}
+
+func TestGenerateAllNative(t *testing.T) {
+	// Native adapters run in-process, with no runner on PATH
+	t.Setenv("PATH", "")
+
+	caps, err := Handshake(context.Background(), "go", "structs", "", nil)
+	if err != nil || caps == nil || caps.Protocol != ProtocolVersion || len(caps.Keywords) == 0 {
+		t.Fatalf("expected the native adapter's capabilities, got %+v, %v", caps, err)
+	}
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "user", ID: "profile", Schema: json.RawMessage(`{"type":"object","properties":{"name":{"type":"string"}}}`), Adapter: "structs"},
+		{Namespace: "user", ID: "bad", Schema: json.RawMessage(`"not a schema`), Adapter: "structs"},
+	}
+	outputs, err := GenerateAll(context.Background(), schemas, "go", Options{KeepGoing: true})
+	var failed *FailedError
+	if !errors.As(err, &failed) || len(failed.Failures) != 1 || failed.Failures[0].Key() != "user:bad" {
+		t.Fatalf("expected user:bad to fail, got %v", err)
+	}
+	if len(outputs) != 1 || outputs[0].Type != "UserProfile" || !strings.Contains(outputs[0].Schema, "type UserProfile struct") {
+		t.Errorf("expected the UserProfile struct, got %+v", outputs)
+	}
+
+	// An assigned name is what the code is declared as, and is passed on to the output
+	schemas[0].VarName = "UserProfile_2"
+	outputs, err = GenerateAll(context.Background(), schemas[:1], "go", Options{})
+	if err != nil || len(outputs) != 1 || outputs[0].Type != "UserProfile_2" || outputs[0].VarName != "UserProfile_2" {
+		t.Errorf("expected the assigned name, got %+v, %v", outputs, err)
+	}
+
+	// Nested types keep clear of every schema's name, across package roots
+	schemas = []retriever.RetrievedSchema{
+		{Namespace: "user", ID: "profile", VarName: "UserProfile", Dir: "a", Adapter: "structs",
+			Schema: json.RawMessage(`{"type":"object","properties":{"address":{"type":"object","properties":{"street":{"type":"string"}}}}}`)},
+		{Namespace: "user", ID: "profileAddress", VarName: "UserProfileAddress", Dir: "b", Adapter: "structs",
+			Schema: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`)},
+	}
+	outputs, err = GenerateAll(context.Background(), schemas, "go", Options{})
+	if err != nil || len(outputs) != 2 {
+		t.Fatalf("GenerateAll: %+v, %v", outputs, err)
+	}
+	if !strings.Contains(outputs[0].Schema, "type UserProfileAddress2 struct") || outputs[1].Type != "UserProfileAddress" {
+		t.Errorf("expected the nested type to be renamed, got:\n%s", outputs[0].Schema)
+	}
+}
+
+func TestOverrideCommand(t *testing.T) {
+	lang := language.ByName("typescript")
+	dir := t.TempDir()
+	pkg := filepath.Join(dir, "zod")
+	if err := os.MkdirAll(pkg, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pkg, "package.json"), []byte(`{"bin": {"xschema-zod": "dist/cli.js", "other": "x.js"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cli.js"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		override parser.AdapterConfig
+		want     string
+	}{
+		{"command on PATH", parser.AdapterConfig{Command: []string{"node", "cli.js"}, Dir: dir}, "node cli.js"},
+		{"relative program", parser.AdapterConfig{Command: []string{"./bin/zod"}, Dir: dir}, filepath.Join(dir, "bin", "zod")},
+		{"script", parser.AdapterConfig{Path: "cli.js", Dir: dir}, "node " + filepath.Join(dir, "cli.js")},
+		{"package directory", parser.AdapterConfig{Path: "./zod", Dir: dir}, "node " + filepath.Join(pkg, "dist", "cli.js")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmdLine, err := overrideCommand(lang, "xschema-zod", tt.override)
+			if err != nil {
+				t.Fatalf("overrideCommand: %v", err)
+			}
+			if got := strings.Join(cmdLine, " "); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := overrideCommand(lang, "xschema-zod", parser.AdapterConfig{Path: "missing", Dir: dir, Origin: "xschema.jsonc"}); err == nil || !strings.Contains(err.Error(), "xschema.jsonc") {
+		t.Errorf("expected a missing path to fail naming its origin, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package generator
+
+import (
+	"github.com/xschemadev/xschema/gostruct"
+	"github.com/xschemadev/xschema/language"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/ui"
+)
+
+// nativeAdapter converts schemas inside the CLI, so its language needs no
+// runtime or package installed to generate code
+type nativeAdapter struct {
+	capabilities Capabilities
+	// generate converts a batch, keeping clear of the reserved names that the
+	// rest of the output declares
+	generate func(inputs []GenerateInput, reserved []string) []GenerateOutput
+}
+
+// nativeAdapters by language, then adapter name
+var nativeAdapters = map[string]map[string]nativeAdapter{
+	"go": {
+		"structs": {
+			capabilities: Capabilities{
+				Protocol: ProtocolVersion,
+				Drafts:   gostruct.Drafts,
+				Keywords: gostruct.Keywords,
+				Options:  []string{},
+			},
+			generate: generateGoStructs,
+		},
+	},
+}
+
+// native returns the built-in adapter a batch runs with, or nil when it needs
+// an adapter process. Overrides win, so a fork of a native adapter can be tried.
+func native(langName, adapter string, override *parser.AdapterConfig) *nativeAdapter {
+	if override != nil {
+		return nil
+	}
+	if n, ok := nativeAdapters[langName][adapter]; ok {
+		return &n
+	}
+	return nil
+}
+
+// run converts a batch the way an adapter process would; failures are
+// reported per schema
+func (n *nativeAdapter) run(input GenerateBatchInput) []GenerateOutput {
+	ui.Verbosef("running native adapter: %s (language: %s, schemas: %d)", input.Adapter, input.Language, len(input.Schemas))
+	return n.generate(adapterInputs(input.Schemas), input.Reserved)
+}
+
+// generateGoStructs declares a struct type with a Validate method for each
+// schema, named like its registry variable, e.g. "user", "Profile" -> UserProfile
+// The batch's schemas share one package, so the types declared for their
+// objects and $defs are named apart from each other and from the schemas.
+func generateGoStructs(inputs []GenerateInput, reserved []string) []GenerateOutput {
+	names := make(gostruct.Names)
+	typeNames := make([]string, len(inputs))
+	for _, name := range reserved {
+		names[name] = true
+	}
+	for i, in := range inputs {
+		typeNames[i] = in.VarName
+		if typeNames[i] == "" {
+			typeNames[i] = language.GoName(in.Namespace, in.ID)
+		}
+		names[typeNames[i]] = true
+	}
+
+	outputs := make([]GenerateOutput, len(inputs))
+	for i, in := range inputs {
+		out := GenerateOutput{Namespace: in.Namespace, ID: in.ID}
+		res, err := gostruct.Generate(typeNames[i], in.Schema, names)
+		if err != nil {
+			out.Error = err.Error()
+		} else {
+			out.Schema = res.Code
+			out.Type = res.Type
+			out.Imports = res.Imports
+			out.Warnings = res.Warnings
+		}
+		outputs[i] = out
+	}
+	return outputs
+}
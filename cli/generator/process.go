@@ -0,0 +1,145 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+)
+
+// Defaults for Options.Timeout and Options.MaxOutput
+const (
+	DefaultTimeout   = 2 * time.Minute
+	DefaultMaxOutput = 64 << 20
+)
+
+const (
+	// stderrLimit is how much of an adapter's stderr is kept for errors
+	stderrLimit = 8 << 10
+	// waitDelay bounds how long a killed adapter's pipes are drained, in case
+	// a process outside its group still holds them
+	waitDelay = 2 * time.Second
+)
+
+// limitError is the cause of an adapter being killed for exceeding a limit
+type limitError struct {
+	reason string // e.g. "timed out after 2m0s"
+}
+
+func (e *limitError) Error() string {
+	return e.reason
+}
+
+func timeoutError(d time.Duration) *limitError {
+	return &limitError{reason: fmt.Sprintf("timed out after %s", d)}
+}
+
+func outputLimitError(max int) *limitError {
+	return &limitError{reason: fmt.Sprintf("wrote more than %s of output", ui.FormatBytes(max))}
+}
+
+// killedError reports an adapter killed for exceeding a limit, naming the
+// schemas it was converting
+func killedError(binName string, limit *limitError, schemas []retriever.RetrievedSchema) error {
+	keys := make([]string, len(schemas))
+	for i, s := range schemas {
+		keys[i] = s.Key()
+	}
+	return fmt.Errorf("adapter %s %s and was killed\nschemas in the batch: %s", binName, limit, strings.Join(keys, ", "))
+}
+
+// limitWriter buffers an adapter's stdout up to max bytes (0 means no limit)
+// and calls exceeded once when it writes more
+type limitWriter struct {
+	buf      bytes.Buffer
+	max      int
+	exceeded func()
+	over     bool
+}
+
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.over {
+		return len(p), nil
+	}
+	if w.max > 0 && w.buf.Len()+len(p) > w.max {
+		w.over = true
+		w.exceeded()
+		return len(p), nil
+	}
+	return w.buf.Write(p)
+}
+
+// stderrWriter keeps the tail of an adapter's stderr for error messages and,
+// in verbose mode, prints each line as it arrives, prefixed with the adapter
+type stderrWriter struct {
+	binName string
+	tail    tailBuffer
+
+	mu      sync.Mutex
+	partial []byte // last line, until its newline arrives
+}
+
+func newStderrWriter(binName string) *stderrWriter {
+	return &stderrWriter{binName: binName, tail: tailBuffer{limit: stderrLimit}}
+}
+
+func (w *stderrWriter) Write(p []byte) (int, error) {
+	w.tail.Write(p)
+	if !ui.IsVerbose() {
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		ui.Verbosef("[%s] %s", w.binName, bytes.TrimRight(w.partial[:i], "\r"))
+		w.partial = w.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush prints a last line that did not end with a newline
+func (w *stderrWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		ui.Verbosef("[%s] %s", w.binName, w.partial)
+		w.partial = nil
+	}
+}
+
+func (w *stderrWriter) String() string {
+	return w.tail.String()
+}
+
+// tailBuffer keeps the last limit bytes written to it
+type tailBuffer struct {
+	mu    sync.Mutex
+	buf   []byte
+	limit int
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if over := len(b.buf) - b.limit; over > 0 {
+		b.buf = b.buf[over:]
+	}
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
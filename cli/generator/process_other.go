@@ -0,0 +1,17 @@
+//go:build !unix
+
+package generator
+
+import "os/exec"
+
+// setProcessGroup is a no-op without Unix process groups; cancelling the
+// context kills the runner process only
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills a started command
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
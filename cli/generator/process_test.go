@@ -0,0 +1,38 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xschemadev/xschema/retriever"
+)
+
+func TestGenerateMaxOutput(t *testing.T) {
+	fakeRunner(t)
+
+	input := GenerateBatchInput{
+		Adapter:  "flood",
+		Language: "typescript",
+		Schemas: []retriever.RetrievedSchema{
+			{Namespace: "ns", ID: "F", Schema: json.RawMessage(`{}`), Adapter: "flood"},
+		},
+		MaxOutput: 1 << 10,
+	}
+	_, err := Generate(context.Background(), input)
+	if err == nil || !strings.Contains(err.Error(), "wrote more than 1.0KB of output") || !strings.Contains(err.Error(), "ns:F") {
+		t.Errorf("expected output limit error naming the batch, got: %v", err)
+	}
+}
+
+func TestStderrWriterKeepsTail(t *testing.T) {
+	w := newStderrWriter("xschema-test")
+	w.tail.limit = 8
+	w.Write([]byte("first line\n"))
+	w.Write([]byte("second"))
+	w.flush()
+	if got := w.String(); got != "e\nsecond" {
+		t.Errorf("expected the last 8 bytes, got %q", got)
+	}
+}
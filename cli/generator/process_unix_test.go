@@ -0,0 +1,57 @@
+//go:build unix
+
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xschemadev/xschema/retriever"
+)
+
+func TestGenerateTimeoutKillsProcessGroup(t *testing.T) {
+	dir := fakeRunner(t)
+
+	input := GenerateBatchInput{
+		Adapter:  "hang",
+		Language: "typescript",
+		Schemas: []retriever.RetrievedSchema{
+			{Namespace: "ns", ID: "H1", Schema: json.RawMessage(`{}`), Adapter: "hang"},
+			{Namespace: "ns", ID: "H2", Schema: json.RawMessage(`{}`), Adapter: "hang"},
+		},
+		Timeout: 500 * time.Millisecond,
+	}
+	start := time.Now()
+	_, err := Generate(context.Background(), input)
+	if err == nil {
+		t.Fatal("expected timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the adapter to be killed promptly, took %s", elapsed)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "timed out after 500ms") || !strings.Contains(msg, "ns:H1, ns:H2") {
+		t.Errorf("expected the timeout and the batch's schemas in the error, got: %v", err)
+	}
+
+	// The adapter's own child was killed with it
+	data, err := os.ReadFile(filepath.Join(dir, "hang-child"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			syscall.Kill(pid, syscall.SIGKILL)
+			t.Fatalf("child process %d outlived the adapter", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,399 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xschemadev/xschema/ui"
+)
+
+// WorkerFlag starts an adapter as a long-lived worker instead of converting
+// one batch. The worker reads one JSON request per line on stdin and writes
+// one JSON response per line on stdout, carrying the ID of its request.
+const WorkerFlag = "--xschema-worker"
+
+const (
+	// workerStartTimeout bounds the first ping, which includes the runner
+	// installing the adapter package
+	workerStartTimeout = 60 * time.Second
+	// workerHealthTimeout bounds the ping before a worker is reused, and how
+	// long a closed worker gets to exit before it is killed
+	workerHealthTimeout = 5 * time.Second
+)
+
+// errWorkerExited marks errors from a worker process that is gone
+var errWorkerExited = errors.New("worker exited")
+
+// workerRequest is one line sent to a worker
+type workerRequest struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"` // "convert" or "ping"
+	Inputs []GenerateInput `json:"inputs,omitempty"`
+}
+
+// workerResponse is one line received from a worker
+type workerResponse struct {
+	ID      uint64           `json:"id"`
+	Outputs []GenerateOutput `json:"outputs,omitempty"`
+	Error   string           `json:"error,omitempty"` // the whole request failed
+}
+
+// worker is a running adapter process in worker mode
+// Requests may be sent concurrently; responses are matched to them by ID.
+type worker struct {
+	binName   string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	stderr    *stderrWriter
+	maxOutput int // longest response line accepted; 0 means no limit
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan workerResponse
+
+	done    chan struct{} // closed once the process has exited
+	exitErr error
+	killErr *limitError // why the worker was killed, if it exceeded a limit
+}
+
+// startWorker starts an adapter in worker mode and waits for it to answer a
+// ping. The process lives until procCtx is cancelled or the worker is closed;
+// ctx only bounds the startup.
+func startWorker(procCtx, ctx context.Context, input GenerateBatchInput) (*worker, error) {
+	cmd, binName, err := adapterCommand(procCtx, input.Language, input.Adapter, input.Dir, input.Override, WorkerFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &worker{
+		binName:   binName,
+		cmd:       cmd,
+		stderr:    newStderrWriter(binName),
+		maxOutput: input.MaxOutput,
+		pending:   make(map[uint64]chan workerResponse),
+		done:      make(chan struct{}),
+	}
+	cmd.Stderr = w.stderr
+	if w.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("failed to start adapter %s: %w", binName, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start adapter %s: %w", binName, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start adapter %s: %w", binName, err)
+	}
+	go w.read(stdout)
+
+	startCtx, cancel := context.WithTimeout(ctx, workerStartTimeout)
+	defer cancel()
+	if err := w.ping(startCtx); err != nil {
+		w.close()
+		return nil, fmt.Errorf("adapter %s did not start as a worker: %w", binName, err)
+	}
+
+	ui.Verbosef("adapter worker started: %s (pid: %d)", binName, cmd.Process.Pid)
+	return w, nil
+}
+
+// read dispatches response lines to their requests until the process exits
+// A line longer than maxOutput gets the worker killed.
+func (w *worker) read(stdout io.Reader) {
+	r := bufio.NewReader(stdout)
+	for {
+		line, err := readLine(r, w.maxOutput)
+		if errors.Is(err, errLineTooLong) {
+			w.kill(outputLimitError(w.maxOutput))
+			continue
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var resp workerResponse
+			if jsonErr := json.Unmarshal(line, &resp); jsonErr != nil {
+				ui.Verbosef("ignoring non-protocol output from %s: %s", w.binName, bytes.TrimSpace(line))
+			} else {
+				w.mu.Lock()
+				ch, ok := w.pending[resp.ID]
+				delete(w.pending, resp.ID)
+				w.mu.Unlock()
+				if ok {
+					ch <- resp
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	w.exitErr = w.cmd.Wait()
+	w.stderr.flush()
+	close(w.done)
+}
+
+// errLineTooLong is returned by readLine for lines over the limit
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads up to and including the next newline, discarding the line
+// and returning errLineTooLong once it grows past max bytes (0 means no limit)
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if max > 0 && len(line) > max {
+				tooLong, line = true, nil
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if tooLong {
+			return nil, errLineTooLong
+		}
+		return line, err
+	}
+}
+
+// kill kills the worker's process group for exceeding a limit; requests
+// waiting on it fail with the reason
+func (w *worker) kill(limit *limitError) {
+	w.mu.Lock()
+	if w.killErr == nil {
+		w.killErr = limit
+	}
+	w.mu.Unlock()
+	ui.Verbosef("adapter worker killed: %s - %v", w.binName, limit)
+	killProcessGroup(w.cmd)
+}
+
+// call sends a request and waits for its response
+func (w *worker) call(ctx context.Context, req workerRequest) (workerResponse, error) {
+	ch := make(chan workerResponse, 1)
+	w.mu.Lock()
+	w.nextID++
+	req.ID = w.nextID
+	w.pending[req.ID] = ch
+	w.mu.Unlock()
+	defer func() {
+		w.mu.Lock()
+		delete(w.pending, req.ID)
+		w.mu.Unlock()
+	}()
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return workerResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	w.writeMu.Lock()
+	_, err = w.stdin.Write(append(line, '\n'))
+	w.writeMu.Unlock()
+	if err != nil && w.alive() {
+		return workerResponse{}, fmt.Errorf("failed to write to adapter %s: %w", w.binName, err)
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-w.done:
+		// The response may have been read just before the process exited
+		select {
+		case resp := <-ch:
+			return resp, nil
+		default:
+		}
+		w.mu.Lock()
+		limit := w.killErr
+		w.mu.Unlock()
+		if limit != nil {
+			return workerResponse{}, limit
+		}
+		return workerResponse{}, fmt.Errorf("adapter %s %w: %v\n%s", w.binName, errWorkerExited, w.exitErr, w.stderr.String())
+	case <-ctx.Done():
+		return workerResponse{}, ctx.Err()
+	}
+}
+
+// ping checks that the worker is answering requests
+func (w *worker) ping(ctx context.Context) error {
+	resp, err := w.call(ctx, workerRequest{Method: "ping"})
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	return nil
+}
+
+// convert sends a batch of schemas to the worker
+func (w *worker) convert(ctx context.Context, inputs []GenerateInput) ([]GenerateOutput, error) {
+	resp, err := w.call(ctx, workerRequest{Method: "convert", Inputs: inputs})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("adapter %s failed: %s", w.binName, resp.Error)
+	}
+	return resp.Outputs, nil
+}
+
+func (w *worker) alive() bool {
+	select {
+	case <-w.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// close asks the worker to exit by closing its stdin, killing it if it does not
+func (w *worker) close() {
+	w.stdin.Close()
+	select {
+	case <-w.done:
+	case <-time.After(workerHealthTimeout):
+		ui.Verbosef("adapter worker did not exit, killing it: %s", w.binName)
+		killProcessGroup(w.cmd)
+		<-w.done
+	}
+}
+
+// WorkerPool keeps one long-lived worker per language, adapter and package
+// root, started on
+// first use, health-checked before each reuse and restarted when it crashes.
+// Only adapters whose Capabilities report worker support should use it.
+type WorkerPool struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	entries map[string]*poolEntry // "language/adapter" plus package root and override -> worker; nil once closed
+}
+
+type poolEntry struct {
+	mu sync.Mutex // held while the worker is (re)started
+	w  *worker
+}
+
+// NewWorkerPool creates a pool whose workers are killed when ctx is cancelled
+func NewWorkerPool(ctx context.Context) *WorkerPool {
+	return &WorkerPool{ctx: ctx, entries: make(map[string]*poolEntry)}
+}
+
+// Generate converts a batch with the adapter's worker, like Generate does with
+// a one-shot process. A worker that crashes mid-batch is restarted and the
+// batch retried once; one that exceeds input.Timeout or input.MaxOutput is
+// killed, and replaced on the next batch.
+func (p *WorkerPool) Generate(ctx context.Context, input GenerateBatchInput) ([]GenerateOutput, error) {
+	inputs := adapterInputs(input.Schemas)
+	for attempt := 0; ; attempt++ {
+		w, err := p.get(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+
+		ui.Verbosef("running adapter worker: %s (language: %s, schemas: %d)", w.binName, input.Language, len(inputs))
+		callCtx, cancel := ctx, context.CancelFunc(func() {})
+		if input.Timeout > 0 {
+			callCtx, cancel = context.WithTimeoutCause(ctx, input.Timeout, timeoutError(input.Timeout))
+		}
+		outputs, err := w.convert(callCtx, inputs)
+		cancel()
+
+		var limit *limitError
+		if err != nil && (errors.As(err, &limit) || (ctx.Err() == nil && errors.As(context.Cause(callCtx), &limit))) {
+			w.kill(limit)
+			return nil, killedError(w.binName, limit, input.Schemas)
+		}
+		if errors.Is(err, errWorkerExited) && attempt == 0 && ctx.Err() == nil {
+			ui.Verbosef("adapter worker crashed, restarting: %v", err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		ui.Verbosef("adapter execution successful: %s (outputs: %d)", w.binName, len(outputs))
+		return outputs, nil
+	}
+}
+
+// poolKey identifies the worker a batch runs in: the same adapter started the
+// same way from the same package root
+func poolKey(input GenerateBatchInput) string {
+	key := input.Language + "/" + input.Adapter + "\x00" + input.Dir
+	if o := input.Override; o != nil {
+		key += "\x00" + strings.Join(o.Command, "\x00") + "\x00" + o.Path + "\x00" + o.Dir
+	}
+	return key
+}
+
+// get returns a healthy worker for the adapter, starting or replacing it as needed
+func (p *WorkerPool) get(ctx context.Context, input GenerateBatchInput) (*worker, error) {
+	key := poolKey(input)
+	p.mu.Lock()
+	if p.entries == nil {
+		p.mu.Unlock()
+		return nil, errors.New("worker pool is closed")
+	}
+	e, ok := p.entries[key]
+	if !ok {
+		e = &poolEntry{}
+		p.entries[key] = e
+	}
+	p.mu.Unlock()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.w != nil {
+		if e.w.alive() {
+			healthCtx, cancel := context.WithTimeout(ctx, workerHealthTimeout)
+			err := e.w.ping(healthCtx)
+			cancel()
+			if err == nil {
+				return e.w, nil
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			ui.Verbosef("adapter worker failed health check, restarting: %s - %v", e.w.binName, err)
+		}
+		e.w.close()
+		e.w = nil
+	}
+
+	w, err := startWorker(p.ctx, ctx, input)
+	if err != nil {
+		return nil, err
+	}
+	e.w = w
+	return w, nil
+}
+
+// Close stops every worker; the pool cannot be used afterwards
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	entries := p.entries
+	p.entries = nil
+	p.mu.Unlock()
+
+	for _, e := range entries {
+		e.mu.Lock()
+		if e.w != nil {
+			e.w.close()
+			e.w = nil
+		}
+		e.mu.Unlock()
+	}
+}
@@ -0,0 +1,128 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xschemadev/xschema/retriever"
+)
+
+// workerStarts counts the worker processes the fake runner has started
+func workerStarts(t *testing.T, dir string) int {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "worker-starts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "started")
+}
+
+func workerBatch(schema string) GenerateBatchInput {
+	return GenerateBatchInput{
+		Adapter:  "w",
+		Language: "typescript",
+		Schemas: []retriever.RetrievedSchema{
+			{Namespace: "ns", ID: "W", Schema: json.RawMessage(schema), Adapter: "w"},
+		},
+	}
+}
+
+func TestWorkerPoolReusesWorker(t *testing.T) {
+	dir := fakeRunner(t)
+	pool := NewWorkerPool(context.Background())
+	defer pool.Close()
+
+	for range 3 {
+		outputs, err := pool.Generate(context.Background(), workerBatch(`{}`))
+		if err != nil {
+			t.Fatalf("Generate failed: %v", err)
+		}
+		if len(outputs) != 1 || outputs[0].Key() != "ns:W" {
+			t.Fatalf("unexpected outputs: %+v", outputs)
+		}
+	}
+	if n := workerStarts(t, dir); n != 1 {
+		t.Errorf("expected the worker to start once, started %d times", n)
+	}
+}
+
+func TestWorkerPoolRestartsCrashedWorker(t *testing.T) {
+	dir := fakeRunner(t)
+	pool := NewWorkerPool(context.Background())
+	defer pool.Close()
+
+	outputs, err := pool.Generate(context.Background(), workerBatch(`{"crash": true}`))
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if len(outputs) != 1 {
+		t.Fatalf("unexpected outputs: %+v", outputs)
+	}
+	if n := workerStarts(t, dir); n != 2 {
+		t.Errorf("expected the worker to be restarted once, started %d times", n)
+	}
+
+	// A worker that died between batches is replaced too
+	w := pool.entries[poolKey(workerBatch(`{}`))].w
+	w.cmd.Process.Kill()
+	<-w.done
+	if _, err := pool.Generate(context.Background(), workerBatch(`{}`)); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if n := workerStarts(t, dir); n != 3 {
+		t.Errorf("expected a new worker after the old one died, started %d times", n)
+	}
+}
+
+func TestGenerateAllUsesWorkersWhenSupported(t *testing.T) {
+	dir := fakeRunner(t)
+	pool := NewWorkerPool(context.Background())
+	defer pool.Close()
+
+	schemas := []retriever.RetrievedSchema{
+		{Namespace: "ns", ID: "W", Schema: json.RawMessage(`{}`), Adapter: "w"},
+		{Namespace: "ns", ID: "Good", Schema: json.RawMessage(`{}`), Adapter: "partial"},
+	}
+	opts := Options{
+		KeepGoing:    true,
+		Workers:      pool,
+		Capabilities: map[AdapterDir]*Capabilities{{Adapter: "w"}: {Protocol: ProtocolVersion, Worker: true}},
+	}
+	outputs, _ := GenerateAll(context.Background(), schemas, "typescript", opts)
+
+	var ids []string
+	for _, o := range outputs {
+		ids = append(ids, o.ID)
+	}
+	if got := strings.Join(ids, ","); got != "Good,W" {
+		t.Errorf("expected outputs from the one-shot and worker adapters, got %s", got)
+	}
+	if n := workerStarts(t, dir); n != 1 {
+		t.Errorf("expected one worker, started %d times", n)
+	}
+}
+
+func TestWorkerPoolTimeoutReplacesWorker(t *testing.T) {
+	dir := fakeRunner(t)
+	pool := NewWorkerPool(context.Background())
+	defer pool.Close()
+
+	batch := workerBatch(`{"hang": true}`)
+	batch.Timeout = 500 * time.Millisecond
+	_, err := pool.Generate(context.Background(), batch)
+	if err == nil || !strings.Contains(err.Error(), "timed out") || !strings.Contains(err.Error(), "ns:W") {
+		t.Fatalf("expected timeout error naming the batch, got: %v", err)
+	}
+
+	if _, err := pool.Generate(context.Background(), workerBatch(`{}`)); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if n := workerStarts(t, dir); n != 2 {
+		t.Errorf("expected the hung worker to be replaced, started %d times", n)
+	}
+}
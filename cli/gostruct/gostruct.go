@@ -0,0 +1,759 @@
+// Package gostruct converts JSON Schema into Go types with json tags and
+// Validate methods. It is the built-in adapter of the go language, run in the
+// CLI's process, so Go projects need neither Node nor Python.
+package gostruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/xschemadev/xschema/language"
+)
+
+// Result is the Go code generated for one schema
+type Result struct {
+	Code     string   // type declarations, their Validate methods and the variables they use
+	Type     string   // name of the schema's type
+	Imports  []string // standard library packages the code uses
+	Warnings []string // parts of the schema that are not enforced
+}
+
+// Keywords are the JSON Schema keywords Generate understands
+// anyOf and oneOf are only understood as a way to make a schema nullable.
+var Keywords = []string{
+	"$ref", "additionalProperties", "allOf", "anyOf", "const", "enum", "exclusiveMaximum",
+	"exclusiveMinimum", "format", "items", "maxItems", "maxLength", "maxProperties", "maximum",
+	"minItems", "minLength", "minProperties", "minimum", "multipleOf", "nullable", "oneOf",
+	"pattern", "properties", "required", "type",
+}
+
+// methodNames are the methods generated types declare, which their fields
+// cannot be named
+var methodNames = []string{"MarshalJSON", "UnmarshalJSON", "Validate"}
+
+// Drafts are the JSON Schema drafts Generate understands
+var Drafts = []string{"draft-04", "draft-06", "draft-07", "2019-09", "2020-12"}
+
+// Names are the type and variable names declared in one Go package. Generate
+// calls sharing it declare distinct names, so their code can go in one file.
+type Names map[string]bool
+
+// Generate converts a schema into Go types; the schema's own type is named
+// typeName and types for its objects and $defs are named after it
+// The names Generate declares are added to names, and the others avoid the
+// names it already holds; typeName may be one of them. names may be nil.
+func Generate(typeName string, schema json.RawMessage, names Names) (Result, error) {
+	var root any
+	if err := json.Unmarshal(schema, &root); err != nil {
+		return Result{}, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	if names == nil {
+		names = make(Names)
+	}
+	g := &generator{
+		root:      root,
+		refTypes:  make(map[string]string),
+		declaring: make(map[string]bool),
+		names:     names,
+		imports:   make(map[string]bool),
+	}
+	names[typeName] = true
+	g.refTypes["#"] = typeName
+	g.declare(typeName, root, "")
+
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	return Result{
+		Code:     strings.Join(g.decls, "\n\n"),
+		Type:     g.refTypes["#"],
+		Imports:  imports,
+		Warnings: g.warnings,
+	}, nil
+}
+
+// generator holds the state of one Generate call
+type generator struct {
+	root      any
+	refTypes  map[string]string // "$ref" value -> name of the type declared for it
+	declaring map[string]bool   // types whose declaration is in progress
+	names     Names             // type and variable names in use, in this call or others
+	decls     []string          // declarations, in order
+	imports   map[string]bool
+	warnings  []string
+}
+
+// goType is the Go type chosen for a schema
+type goType struct {
+	expr   string         // type expression, e.g. "[]string"
+	kind   string         // "string", "integer", "number", "boolean", "array", "map", "named" or "any"
+	schema map[string]any // the schema, for its checks
+	elem   *goType        // element type of arrays and maps
+	ptr    bool           // expr is a pointer to the value
+	null   bool           // the schema accepts null
+}
+
+// reserve returns an unused type or variable name based on name
+func (g *generator) reserve(name string) string {
+	unique := name
+	for i := 2; g.names[unique]; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	g.names[unique] = true
+	return unique
+}
+
+func (g *generator) warn(at, format string, args ...any) {
+	if at == "" {
+		at = "/"
+	}
+	msg := at + ": " + fmt.Sprintf(format, args...)
+	if !slices.Contains(g.warnings, msg) {
+		g.warnings = append(g.warnings, msg)
+	}
+}
+
+// declare declares the named type name for a schema, with its Validate method
+// at is the JSON Pointer of the schema, for warnings.
+func (g *generator) declare(name string, schema any, at string) {
+	// Reserve the slot first so nested declarations follow this one
+	slot := len(g.decls)
+	g.decls = append(g.decls, "")
+	g.declaring[name] = true
+	defer delete(g.declaring, name)
+
+	m := g.normalize(schemaObject(schema), at)
+	var b strings.Builder
+	if desc, ok := m["description"].(string); ok {
+		writeComment(&b, name+" is "+lowerFirst(desc))
+	}
+
+	var checks strings.Builder
+	if isStruct(m) {
+		g.writeStruct(&b, &checks, name, m, at)
+	} else {
+		t := g.typeOf(m, name, at)
+		if t.ptr {
+			// Methods cannot be declared on pointer types; nulls decode to the zero value
+			t.expr, t.ptr = strings.TrimPrefix(t.expr, "*"), false
+		}
+		switch t.kind {
+		case "any":
+			// An interface cannot have methods, so keep the raw JSON
+			g.imports["encoding/json"] = true
+			fmt.Fprintf(&b, "type %s json.RawMessage\n\n", name)
+			fmt.Fprintf(&b, "func (v %s) MarshalJSON() ([]byte, error) { return json.RawMessage(v).MarshalJSON() }\n\n", name)
+			fmt.Fprintf(&b, "func (v *%s) UnmarshalJSON(data []byte) error { return (*json.RawMessage)(v).UnmarshalJSON(data) }\n\n", name)
+		case "named":
+			// A schema that is only a $ref; its type validates itself
+			fmt.Fprintf(&b, "type %s %s\n\n", name, t.expr)
+			fmt.Fprintf(&b, "// Validate reports every way the value violates its schema\nfunc (v %s) Validate() error {\n\treturn %s(v).Validate()\n}", name, t.expr)
+			g.decls[slot] = b.String()
+			return
+		default:
+			fmt.Fprintf(&b, "type %s %s\n\n", name, t.expr)
+		}
+		expr := "v"
+		if t.kind == "string" {
+			expr = "string(v)"
+		}
+		g.writeChecks(&checks, t, expr, "", 0, at)
+	}
+
+	if checks.Len() == 0 {
+		fmt.Fprintf(&b, "// Validate reports whether the value satisfies its schema\nfunc (v %s) Validate() error {\n\treturn nil\n}", name)
+	} else {
+		g.imports["errors"] = true
+		fmt.Fprintf(&b, "// Validate reports every way the value violates its schema\nfunc (v %s) Validate() error {\n\tvar errs []error\n%s\treturn errors.Join(errs...)\n}", name, checks.String())
+	}
+	g.decls[slot] = b.String()
+}
+
+// writeStruct writes a struct declaration for an object schema, and its field checks
+func (g *generator) writeStruct(b, checks *strings.Builder, name string, m map[string]any, at string) {
+	props, _ := m["properties"].(map[string]any)
+	required := make(map[string]bool)
+	if list, ok := m["required"].([]any); ok {
+		for _, r := range list {
+			s, ok := r.(string)
+			if !ok {
+				continue
+			}
+			required[s] = true
+			if _, ok := props[s]; !ok {
+				g.warn(at, "required property %q has no schema in properties and is not enforced", s)
+			}
+		}
+	}
+	if extra, ok := m["additionalProperties"]; ok && extra != true {
+		g.warn(at, "additionalProperties is not enforced on objects with properties")
+	}
+
+	keys := make([]string, 0, len(props))
+	for key := range props {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make(map[string]bool)
+	for _, method := range methodNames {
+		fields[method] = true
+	}
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, key := range keys {
+		propAt := at + "/properties/" + escapePointer(key)
+		if !validTag(key) {
+			g.warn(propAt, "property %q cannot be a json struct tag and is ignored", key)
+			continue
+		}
+		field := language.GoName(key)
+		for i := 2; fields[field]; i++ {
+			field = language.GoName(key) + strconv.Itoa(i)
+		}
+		fields[field] = true
+
+		// Every field can be nil, so a missing property is told apart from
+		// a zero value
+		t := g.typeOf(props[key], language.GoName(name, key), propAt)
+		if !t.ptr && t.kind != "array" && t.kind != "map" && t.kind != "any" {
+			t.expr, t.ptr = "*"+t.expr, true
+		}
+		tag := key
+		if !required[key] {
+			tag += ",omitempty"
+		}
+
+		if desc, ok := schemaObject(props[key])["description"].(string); ok {
+			writeComment(b, field+" is "+lowerFirst(desc))
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", field, t.expr, tag)
+		if !required[key] || t.null {
+			if required[key] {
+				// nil is also how null decodes
+				g.warn(propAt, "required is not enforced on properties that accept null")
+			}
+			g.writeChecks(checks, t, "v."+field, strconv.Quote(key), 0, propAt)
+			continue
+		}
+
+		// The value's checks only apply once it is present
+		expr := "v." + field
+		if t.ptr {
+			t.ptr, t.expr, expr = false, strings.TrimPrefix(t.expr, "*"), "(*v."+field+")"
+		}
+		var inner strings.Builder
+		g.writeChecks(&inner, t, expr, strconv.Quote(key), 0, propAt)
+		fmt.Fprintf(checks, "if v.%s == nil {\n%s}", field, g.failure(strconv.Quote(key), "is required"))
+		if inner.Len() > 0 {
+			fmt.Fprintf(checks, " else {\n%s}", inner.String())
+		}
+		checks.WriteString("\n")
+	}
+	b.WriteString("}\n\n")
+}
+
+// typeOf chooses the Go type of a schema, declaring the named types it needs
+// name is used for those declarations.
+func (g *generator) typeOf(schema any, name, at string) goType {
+	m := g.normalize(schemaObject(schema), at)
+	typ, nullable := schemaType(m)
+	if ref, ok := m["$ref"].(string); ok {
+		t := g.refType(ref, at)
+		if nullable && !t.ptr {
+			t.expr, t.ptr = "*"+t.expr, true
+		}
+		t.null = nullable
+		return t
+	}
+
+	t := goType{schema: m, null: nullable}
+	switch {
+	case isStruct(m):
+		t.kind, t.expr = "named", g.reserve(name)
+		g.declare(t.expr, m, at)
+	case typ == "string":
+		t.kind, t.expr = "string", "string"
+	case typ == "integer":
+		t.kind, t.expr = "integer", "int64"
+	case typ == "number":
+		t.kind, t.expr = "number", "float64"
+	case typ == "boolean":
+		t.kind, t.expr = "boolean", "bool"
+	case typ == "array":
+		if _, ok := m["items"].([]any); ok {
+			g.warn(at, "tuple items are not supported, items accept any value")
+		}
+		elem := g.typeOf(m["items"], name+"Item", at+"/items")
+		t.kind, t.expr, t.elem = "array", "[]"+elem.expr, &elem
+	case typ == "object":
+		elem := g.typeOf(m["additionalProperties"], name+"Value", at+"/additionalProperties")
+		t.kind, t.expr, t.elem = "map", "map[string]"+elem.expr, &elem
+	default:
+		t.kind, t.expr, t.null = "any", "any", true
+	}
+	if nullable && t.kind != "any" && t.kind != "array" && t.kind != "map" {
+		t.expr, t.ptr = "*"+t.expr, true
+	}
+	return t
+}
+
+// refType returns the type declared for a $ref into the schema, declaring it
+// on first use
+func (g *generator) refType(ref, at string) goType {
+	if name, ok := g.refTypes[ref]; ok {
+		if g.declaring[name] {
+			// A type containing itself: a pointer breaks the cycle
+			return goType{kind: "named", expr: "*" + name, ptr: true}
+		}
+		return goType{kind: "named", expr: name}
+	}
+	target, ok := resolvePointer(g.root, ref)
+	if !ok {
+		g.warn(at, "cannot resolve $ref %q, it accepts any value", ref)
+		return goType{kind: "any", expr: "any"}
+	}
+	parts := strings.Split(ref, "/")
+	name := g.reserve(language.GoName(g.refTypes["#"], parts[len(parts)-1]))
+	g.refTypes[ref] = name
+	g.declare(name, target, strings.TrimPrefix(ref, "#"))
+	return goType{kind: "named", expr: name}
+}
+
+// normalize folds allOf into the schema and turns nullable unions into
+// nullable types, warning about the combinators it cannot represent
+func (g *generator) normalize(m map[string]any, at string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+
+	for _, kw := range []string{"anyOf", "oneOf"} {
+		list, ok := out[kw].([]any)
+		if !ok {
+			continue
+		}
+		delete(out, kw)
+		var others []any
+		for _, sub := range list {
+			if typ, _ := schemaObject(sub)["type"].(string); typ != "null" {
+				others = append(others, sub)
+			}
+		}
+		if len(others) == 1 && len(others) < len(list) {
+			// {"anyOf": [T, {"type": "null"}]}
+			sub := g.normalize(schemaObject(others[0]), at+"/"+kw)
+			for k, v := range sub {
+				if _, ok := out[k]; !ok {
+					out[k] = v
+				}
+			}
+			out["nullable"] = true
+			continue
+		}
+		g.warn(at, "%s is not supported, the value is not checked against its alternatives", kw)
+		if _, ok := out["type"]; !ok {
+			out["type"] = "any"
+		}
+	}
+
+	if list, ok := out["allOf"].([]any); ok {
+		delete(out, "allOf")
+		for i, sub := range list {
+			sm := schemaObject(sub)
+			if len(list) > 1 {
+				// Only merged objects need the properties behind a $ref
+				sm = g.deref(sub)
+			}
+			sm = g.normalize(sm, fmt.Sprintf("%s/allOf/%d", at, i))
+			for k, v := range sm {
+				switch k {
+				case "properties":
+					props, _ := out["properties"].(map[string]any)
+					merged := make(map[string]any)
+					for pk, pv := range props {
+						merged[pk] = pv
+					}
+					for pk, pv := range v.(map[string]any) {
+						merged[pk] = pv
+					}
+					out["properties"] = merged
+				case "required":
+					existing, _ := out["required"].([]any)
+					out["required"] = append(slices.Clone(existing), v.([]any)...)
+				default:
+					if _, ok := out[k]; !ok {
+						out[k] = v
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// deref returns the schema a $ref points to, or the schema itself
+func (g *generator) deref(schema any) map[string]any {
+	m := schemaObject(schema)
+	if ref, ok := m["$ref"].(string); ok {
+		if target, ok := resolvePointer(g.root, ref); ok {
+			return schemaObject(target)
+		}
+	}
+	return m
+}
+
+// writeChecks writes the statements checking expr against t's schema, adding
+// failures to errs. label is a Go expression naming the value in messages, ""
+// for the value itself; depth numbers loop variables.
+func (g *generator) writeChecks(b *strings.Builder, t goType, expr, label string, depth int, at string) {
+	if t.ptr {
+		var inner strings.Builder
+		deref := t
+		deref.ptr, deref.expr = false, strings.TrimPrefix(t.expr, "*")
+		g.writeChecks(&inner, deref, "(*"+expr+")", label, depth, at)
+		if inner.Len() > 0 {
+			fmt.Fprintf(b, "if %s != nil {\n%s}\n", expr, inner.String())
+		}
+		return
+	}
+
+	m := t.schema
+	switch t.kind {
+	case "named":
+		// Validate joins its errors; they are added one by one so each
+		// gets the path prefix, not just the first line
+		wrapped := "err"
+		if label != "" {
+			g.imports["fmt"] = true
+			wrapped = fmt.Sprintf("fmt.Errorf(\"%%s: %%w\", %s, err)", label)
+		}
+		fmt.Fprintf(b, "if err := %s.Validate(); err != nil {\nnested := []error{err}\n"+
+			"if joined, ok := err.(interface{ Unwrap() []error }); ok {\nnested = joined.Unwrap()\n}\n"+
+			"for _, err := range nested {\nerrs = append(errs, %s)\n}\n}\n", expr, wrapped)
+		return
+	case "string":
+		if n, ok := count(m, "minLength"); ok {
+			g.imports["unicode/utf8"] = true
+			fmt.Fprintf(b, "if utf8.RuneCountInString(%s) < %d {\n", expr, n)
+			g.fail(b, label, fmt.Sprintf("must be at least %d characters long", n))
+		}
+		if n, ok := count(m, "maxLength"); ok {
+			g.imports["unicode/utf8"] = true
+			fmt.Fprintf(b, "if utf8.RuneCountInString(%s) > %d {\n", expr, n)
+			g.fail(b, label, fmt.Sprintf("must be at most %d characters long", n))
+		}
+		if pattern, ok := m["pattern"].(string); ok {
+			if _, err := regexp.Compile(pattern); err != nil {
+				g.warn(at, "pattern %q is not supported by Go's regexp package and is not enforced", pattern)
+			} else {
+				g.imports["regexp"] = true
+				v := g.reserve(lowerFirst(g.refTypes["#"]) + "Pattern")
+				g.decls = append(g.decls, fmt.Sprintf("var %s = regexp.MustCompile(%s)", v, strconv.Quote(pattern)))
+				fmt.Fprintf(b, "if !%s.MatchString(%s) {\n", v, expr)
+				g.fail(b, label, "must match the pattern "+pattern)
+			}
+		}
+	case "integer", "number":
+		g.writeBound(b, t, m, expr, label, "minimum", "<", "must be at least")
+		g.writeBound(b, t, m, expr, label, "maximum", ">", "must be at most")
+		g.writeBound(b, t, m, expr, label, "exclusiveMinimum", "<=", "must be greater than")
+		g.writeBound(b, t, m, expr, label, "exclusiveMaximum", ">=", "must be less than")
+		if f, ok := m["multipleOf"].(float64); ok && f > 0 {
+			if t.kind == "integer" && isInt(f) {
+				fmt.Fprintf(b, "if %s%%%s != 0 {\n", expr, formatNumber(f))
+			} else {
+				g.imports["math"] = true
+				fmt.Fprintf(b, "if math.Mod(float64(%s), %s) != 0 {\n", expr, formatNumber(f))
+			}
+			g.fail(b, label, "must be a multiple of "+formatNumber(f))
+		}
+	case "array":
+		if n, ok := count(m, "minItems"); ok {
+			fmt.Fprintf(b, "if len(%s) < %d {\n", expr, n)
+			g.fail(b, label, fmt.Sprintf("must have at least %d items", n))
+		}
+		if n, ok := count(m, "maxItems"); ok {
+			fmt.Fprintf(b, "if len(%s) > %d {\n", expr, n)
+			g.fail(b, label, fmt.Sprintf("must have at most %d items", n))
+		}
+		i := "i" + strconv.Itoa(depth)
+		itemLabel := fmt.Sprintf("fmt.Sprintf(\"%%s[%%d]\", %s, %s)", orEmpty(label), i)
+		var inner strings.Builder
+		g.writeChecks(&inner, *t.elem, expr+"["+i+"]", itemLabel, depth+1, at+"/items")
+		if inner.Len() > 0 {
+			g.imports["fmt"] = true
+			fmt.Fprintf(b, "for %s := range %s {\n%s}\n", i, expr, inner.String())
+		}
+	case "map":
+		if n, ok := count(m, "minProperties"); ok {
+			fmt.Fprintf(b, "if len(%s) < %d {\n", expr, n)
+			g.fail(b, label, fmt.Sprintf("must have at least %d properties", n))
+		}
+		if n, ok := count(m, "maxProperties"); ok {
+			fmt.Fprintf(b, "if len(%s) > %d {\n", expr, n)
+			g.fail(b, label, fmt.Sprintf("must have at most %d properties", n))
+		}
+		k := "k" + strconv.Itoa(depth)
+		keyLabel := k
+		if label != "" {
+			keyLabel = label + " + \".\" + " + k
+		}
+		var inner strings.Builder
+		g.writeChecks(&inner, *t.elem, expr+"["+k+"]", keyLabel, depth+1, at+"/additionalProperties")
+		if inner.Len() > 0 {
+			fmt.Fprintf(b, "for %s := range %s {\n%s}\n", k, expr, inner.String())
+		}
+	}
+
+	g.writeEnum(b, t, m, expr, label, at)
+}
+
+// writeBound checks a numeric bound, comparing as float64 when an integer is
+// bounded by a fraction
+func (g *generator) writeBound(b *strings.Builder, t goType, m map[string]any, expr, label, keyword, op, msg string) {
+	f, ok := m[keyword].(float64)
+	if !ok {
+		// Draft-04 exclusiveMinimum/exclusiveMaximum are booleans on minimum/maximum
+		return
+	}
+	if ex, _ := m["exclusive"+strings.ToUpper(keyword[:1])+keyword[1:]].(bool); ex {
+		op, msg = map[string]string{"<": "<=", ">": ">="}[op], map[string]string{"<": "must be greater than", ">": "must be less than"}[op]
+	}
+	if t.kind == "integer" && !isInt(f) {
+		expr = "float64(" + expr + ")"
+	}
+	fmt.Fprintf(b, "if %s %s %s {\n", expr, op, formatNumber(f))
+	g.fail(b, label, msg+" "+formatNumber(f))
+}
+
+// writeEnum checks enum and const, for the types whose values Go can compare
+func (g *generator) writeEnum(b *strings.Builder, t goType, m map[string]any, expr, label, at string) {
+	var values []any
+	if list, ok := m["enum"].([]any); ok {
+		values = list
+	}
+	if c, ok := m["const"]; ok {
+		values = []any{c}
+	}
+	if len(values) == 0 {
+		return
+	}
+
+	var literals []string
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			// null is allowed by the pointer, not the value
+		case string:
+			if t.kind == "string" {
+				literals = append(literals, strconv.Quote(v))
+				continue
+			}
+			literals = nil
+		case float64:
+			if t.kind == "number" || (t.kind == "integer" && isInt(v)) {
+				literals = append(literals, formatNumber(v))
+				continue
+			}
+			literals = nil
+		case bool:
+			if t.kind == "boolean" {
+				literals = append(literals, strconv.FormatBool(v))
+				continue
+			}
+			literals = nil
+		default:
+			literals = nil
+		}
+		if literals == nil && v != nil {
+			g.warn(at, "enum and const values of this type are not enforced")
+			return
+		}
+	}
+	if len(literals) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "switch %s {\ncase %s:\ndefault:\n", expr, strings.Join(literals, ", "))
+	g.fail(b, label, "must be one of "+strings.Join(literals, ", "))
+}
+
+// fail writes the statement adding a failure, closing the block opened before it
+func (g *generator) fail(b *strings.Builder, label, msg string) {
+	b.WriteString(g.failure(label, msg) + "}\n")
+}
+
+// failure returns the statement adding a failure to errs
+func (g *generator) failure(label, msg string) string {
+	if label == "" {
+		g.imports["errors"] = true
+		return fmt.Sprintf("errs = append(errs, errors.New(%s))\n", strconv.Quote(msg))
+	}
+	g.imports["fmt"] = true
+	return fmt.Sprintf("errs = append(errs, fmt.Errorf(%s, %s))\n", strconv.Quote("%s: "+strings.ReplaceAll(msg, "%", "%%")), label)
+}
+
+// schemaObject returns a schema as an object; true and {} accept anything
+func schemaObject(schema any) map[string]any {
+	m, _ := schema.(map[string]any)
+	if m == nil {
+		return map[string]any{}
+	}
+	return m
+}
+
+// schemaType returns the single JSON type of a schema, inferred from its
+// keywords when "type" is missing, and whether it may also be null
+func schemaType(m map[string]any) (string, bool) {
+	nullable, _ := m["nullable"].(bool) // OpenAPI 3.0
+	switch typ := m["type"].(type) {
+	case string:
+		return typ, nullable || typ == "null"
+	case []any:
+		var types []string
+		for _, t := range typ {
+			switch s, _ := t.(string); s {
+			case "null":
+				nullable = true
+			case "":
+			default:
+				types = append(types, s)
+			}
+		}
+		if len(types) == 1 {
+			return types[0], nullable
+		}
+		if slices.Contains(types, "integer") && slices.Contains(types, "number") && len(types) == 2 {
+			return "number", nullable
+		}
+		return "", nullable
+	}
+	switch {
+	case m["properties"] != nil || m["additionalProperties"] != nil:
+		return "object", nullable
+	case m["items"] != nil:
+		return "array", nullable
+	case m["pattern"] != nil || m["minLength"] != nil || m["maxLength"] != nil:
+		return "string", nullable
+	}
+	values, _ := m["enum"].([]any)
+	if c, ok := m["const"]; ok {
+		values = []any{c}
+	}
+	if len(values) > 0 {
+		for _, v := range values {
+			if _, ok := v.(string); !ok && v != nil {
+				return "", nullable
+			}
+		}
+		return "string", nullable
+	}
+	return "", nullable
+}
+
+// isStruct reports whether a schema becomes a struct: an object with properties
+func isStruct(m map[string]any) bool {
+	typ, _ := schemaType(m)
+	props, _ := m["properties"].(map[string]any)
+	return typ == "object" && len(props) > 0
+}
+
+// resolvePointer resolves a local $ref like "#/$defs/Address" in root
+func resolvePointer(root any, ref string) (any, bool) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, false
+	}
+	current := root
+	for _, token := range strings.Split(strings.TrimPrefix(ref, "#"), "/")[1:] {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := current.(type) {
+		case map[string]any:
+			next, ok := node[token]
+			if !ok {
+				return nil, false
+			}
+			current = next
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			current = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// validTag reports whether encoding/json accepts name in a struct tag
+func validTag(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", r):
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// count returns a non-negative integer keyword such as minLength
+func count(m map[string]any, keyword string) (int, bool) {
+	f, ok := m[keyword].(float64)
+	if !ok || f < 0 || !isInt(f) {
+		return 0, false
+	}
+	return int(f), true
+}
+
+// isInt reports whether f is a whole number that fits a Go integer constant
+func isInt(f float64) bool {
+	return f == math.Trunc(f) && math.Abs(f) < 1<<53
+}
+
+func formatNumber(f float64) string {
+	if isInt(f) {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// orEmpty returns label, or an empty string literal for the value itself
+func orEmpty(label string) string {
+	if label == "" {
+		return `""`
+	}
+	return label
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToLower(s[:1]) + s[1:]
+}
+
+// writeComment writes text as a doc comment, one line per line of text
+func writeComment(b *strings.Builder, text string) {
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		b.WriteString("// " + strings.TrimSpace(line) + "\n")
+	}
+}
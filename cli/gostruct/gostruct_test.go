@@ -0,0 +1,324 @@
+package gostruct
+
+import (
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// The tests share one importer, so each standard library package the
+// generated code imports is only type-checked once
+var (
+	fset           = token.NewFileSet()
+	sourceImporter = importer.ForCompiler(fset, "source", nil)
+)
+
+// typeCheck compiles the generated code as a package of its own, the way the
+// go template lays it out
+func typeCheck(t *testing.T, res Result) *types.Package {
+	t.Helper()
+	var src strings.Builder
+	src.WriteString("package gen\n\n")
+	for _, imp := range res.Imports {
+		src.WriteString("import \"" + imp + "\"\n")
+	}
+	src.WriteString("\n" + res.Code + "\n")
+
+	formatted, err := format.Source([]byte(src.String()))
+	if err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src.String())
+	}
+	file, err := parser.ParseFile(fset, "gen.go", formatted, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := types.Config{Importer: sourceImporter}
+	pkg, err := conf.Check("gen", fset, []*ast.File{file}, nil)
+	if err != nil {
+		t.Fatalf("generated code does not compile: %v\n%s", err, formatted)
+	}
+	return pkg
+}
+
+// fieldType returns the type of a struct field, as the package writes it
+func fieldType(t *testing.T, pkg *types.Package, typeName, field string) string {
+	t.Helper()
+	obj := pkg.Scope().Lookup(typeName)
+	if obj == nil {
+		t.Fatalf("type %s is not declared", typeName)
+	}
+	st, ok := obj.Type().Underlying().(*types.Struct)
+	if !ok {
+		t.Fatalf("type %s is %s, not a struct", typeName, obj.Type().Underlying())
+	}
+	for i := range st.NumFields() {
+		if f := st.Field(i); f.Name() == field {
+			return types.TypeString(f.Type(), types.RelativeTo(pkg))
+		}
+	}
+	t.Fatalf("type %s has no field %s", typeName, field)
+	return ""
+}
+
+func TestGenerateStruct(t *testing.T) {
+	res, err := Generate("UserProfile", []byte(`{
+		"type": "object",
+		"description": "A user of the platform",
+		"required": ["name", "age"],
+		"properties": {
+			"name": {"type": "string"},
+			"age": {"type": "integer"},
+			"score": {"type": "number"},
+			"active": {"type": "boolean"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"meta": {"type": "object", "additionalProperties": {"type": "integer"}},
+			"profile_url": {"type": ["string", "null"]},
+			"extra": {},
+			"address": {"type": "object", "properties": {"street": {"type": "string"}}}
+		}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Type != "UserProfile" {
+		t.Errorf("Type = %q, want UserProfile", res.Type)
+	}
+	if len(res.Warnings) > 0 {
+		t.Errorf("unexpected warnings: %v", res.Warnings)
+	}
+	pkg := typeCheck(t, res)
+
+	fields := map[string]string{
+		"Name":       "*string", // nil when missing, so required can be checked
+		"Age":        "*int64",
+		"Score":      "*float64",
+		"Active":     "*bool",
+		"Tags":       "[]string",
+		"Meta":       "map[string]int64",
+		"ProfileURL": "*string",
+		"Extra":      "any",
+		"Address":    "*UserProfileAddress",
+	}
+	for field, want := range fields {
+		if got := fieldType(t, pkg, "UserProfile", field); got != want {
+			t.Errorf("UserProfile.%s is %s, want %s", field, got, want)
+		}
+	}
+	fieldType(t, pkg, "UserProfileAddress", "Street")
+
+	for _, want := range []string{
+		"// UserProfile is a user of the platform",
+		"`json:\"name\"`",
+		"`json:\"profile_url,omitempty\"`",
+		"func (v UserProfile) Validate() error",
+		"if v.Name == nil {",
+		`fmt.Errorf("%s: is required", "age")`,
+	} {
+		if !strings.Contains(res.Code, want) {
+			t.Errorf("missing %q in\n%s", want, res.Code)
+		}
+	}
+}
+
+func TestGenerateFieldNames(t *testing.T) {
+	res, err := Generate("Task", []byte(`{
+		"type": "object",
+		"properties": {
+			"validate": {"type": "boolean"},
+			"user_id": {"type": "string"},
+			"user-id": {"type": "string"}
+		}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, res)
+
+	// Fields keep clear of the Validate method and of each other
+	for _, field := range []string{"Validate2", "UserID", "UserID2"} {
+		fieldType(t, pkg, "Task", field)
+	}
+}
+
+func TestGenerateRefs(t *testing.T) {
+	res, err := Generate("Tree", []byte(`{
+		"type": "object",
+		"required": ["root"],
+		"properties": {
+			"root": {"$ref": "#/$defs/Node"},
+			"home": {"$ref": "#/definitions/Address"},
+			"work": {"$ref": "#/definitions/Address"}
+		},
+		"$defs": {
+			"Node": {
+				"type": "object",
+				"properties": {
+					"value": {"type": "integer"},
+					"children": {"type": "array", "items": {"$ref": "#/$defs/Node"}},
+					"parent": {"$ref": "#/$defs/Node"}
+				}
+			}
+		},
+		"definitions": {
+			"Address": {"type": "object", "properties": {"street": {"type": "string"}}}
+		}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, res)
+
+	fields := []struct{ typ, field, want string }{
+		{"Tree", "Root", "*TreeNode"},
+		{"Tree", "Home", "*TreeAddress"},
+		{"Tree", "Work", "*TreeAddress"}, // the same $ref is declared once
+		{"TreeNode", "Children", "[]*TreeNode"},
+		{"TreeNode", "Parent", "*TreeNode"},
+	}
+	for _, f := range fields {
+		if got := fieldType(t, pkg, f.typ, f.field); got != f.want {
+			t.Errorf("%s.%s is %s, want %s", f.typ, f.field, got, f.want)
+		}
+	}
+}
+
+func TestGenerateNullable(t *testing.T) {
+	res, err := Generate("Account", []byte(`{
+		"type": "object",
+		"required": ["nickname", "owner", "legacy"],
+		"properties": {
+			"nickname": {"anyOf": [{"type": "string", "minLength": 2}, {"type": "null"}]},
+			"owner": {"oneOf": [{"$ref": "#/$defs/Owner"}, {"type": "null"}]},
+			"legacy": {"type": "integer", "nullable": true}
+		},
+		"$defs": {
+			"Owner": {"type": "object", "properties": {"name": {"type": "string"}}}
+		}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := typeCheck(t, res)
+
+	for field, want := range map[string]string{"Nickname": "*string", "Owner": "*AccountOwner", "Legacy": "*int64"} {
+		if got := fieldType(t, pkg, "Account", field); got != want {
+			t.Errorf("Account.%s is %s, want %s", field, got, want)
+		}
+	}
+	if !strings.Contains(res.Code, "utf8.RuneCountInString((*v.Nickname)) < 2") {
+		t.Errorf("nullable property is not checked when set:\n%s", res.Code)
+	}
+	// A nil pointer may be null, which these accept, so their presence is not checked
+	if strings.Contains(res.Code, "is required") || len(res.Warnings) != 3 {
+		t.Errorf("expected required to be left to warnings, got %v:\n%s", res.Warnings, res.Code)
+	}
+}
+
+func TestGenerateChecks(t *testing.T) {
+	res, err := Generate("Order", []byte(`{
+		"type": "object",
+		"properties": {
+			"code": {"type": "string", "minLength": 3, "maxLength": 8, "pattern": "^[A-Z]+$"},
+			"quantity": {"type": "integer", "minimum": 1, "exclusiveMaximum": 100, "multipleOf": 5},
+			"discount": {"type": "number", "maximum": 0.5},
+			"status": {"enum": ["open", "closed"]},
+			"kind": {"const": "order"},
+			"items": {"type": "array", "minItems": 1, "maxItems": 10, "items": {"type": "string", "minLength": 1}},
+			"labels": {"type": "object", "maxProperties": 3, "additionalProperties": {"type": "string"}}
+		}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeCheck(t, res)
+
+	for _, want := range []string{
+		"utf8.RuneCountInString((*v.Code)) < 3",
+		"utf8.RuneCountInString((*v.Code)) > 8",
+		`regexp.MustCompile("^[A-Z]+$")`,
+		"(*v.Quantity) < 1",
+		"(*v.Quantity) >= 100",
+		"(*v.Quantity)%5 != 0",
+		"(*v.Discount) > 0.5",
+		`case "open", "closed":`,
+		`case "order":`,
+		"len(v.Items) < 1",
+		"len(v.Items) > 10",
+		"utf8.RuneCountInString(v.Items[i0]) < 1",
+		"len(v.Labels) > 3",
+	} {
+		if !strings.Contains(res.Code, want) {
+			t.Errorf("missing check %q in\n%s", want, res.Code)
+		}
+	}
+}
+
+func TestGenerateRootTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string // underlying type of the declared type
+	}{
+		{"string", `{"type": "string", "format": "email"}`, "string"},
+		{"array", `{"type": "array", "items": {"type": "integer"}}`, "[]int64"},
+		{"map", `{"type": "object", "additionalProperties": {"type": "boolean"}}`, "map[string]bool"},
+		{"any", `{}`, "[]byte"}, // json.RawMessage, so it can have methods
+		{"allOf", `{"allOf": [{"type": "object", "properties": {"a": {"type": "string"}}}, {"properties": {"b": {"type": "string"}}}]}`, "struct{A *string \"json:\\\"a,omitempty\\\"\"; B *string \"json:\\\"b,omitempty\\\"\"}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Generate("Root", []byte(tt.schema), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pkg := typeCheck(t, res)
+			obj := pkg.Scope().Lookup("Root")
+			if obj == nil {
+				t.Fatalf("type Root is not declared:\n%s", res.Code)
+			}
+			if got := obj.Type().Underlying().String(); got != tt.want {
+				t.Errorf("Root is %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateWarnings(t *testing.T) {
+	res, err := Generate("Shape", []byte(`{
+		"type": "object",
+		"properties": {
+			"circle": {"oneOf": [{"type": "object"}, {"type": "string"}]},
+			"name": {"type": "string", "pattern": "^(?=a)"},
+			"ref": {"$ref": "other.json#/Thing"}
+		}
+	}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	typeCheck(t, res)
+
+	for _, want := range []string{
+		"/properties/circle: oneOf is not supported",
+		"/properties/name: pattern",
+		"/properties/ref: cannot resolve $ref",
+	} {
+		found := false
+		for _, w := range res.Warnings {
+			found = found || strings.HasPrefix(w, want)
+		}
+		if !found {
+			t.Errorf("missing warning %q in %v", want, res.Warnings)
+		}
+	}
+}
+
+func TestGenerateInvalidSchema(t *testing.T) {
+	if _, err := Generate("Bad", []byte(`{"type": `), nil); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
@@ -6,8 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"text/template"
+	"text/template/parse"
 
 	"github.com/xschemadev/xschema/generator"
 	"github.com/xschemadev/xschema/language"
@@ -17,73 +20,325 @@ import (
 type InjectInput struct {
 	Language string                     `json:"language"` // typescript, python, go
 	Outputs  []generator.GenerateOutput `json:"outputs"`
-	OutDir   string                     `json:"outDir"` // default .xschema
+	OutDir   string                     `json:"outDir"`             // default .xschema
+	Layout   Layout                     `json:"layout,omitempty"`   // default LayoutSingle
+	Template string                     `json:"template,omitempty"` // project template file replacing the built-in one or its blocks
 }
 
-// TemplateData is passed to the language template
+// Layout is how the generated code is split into files
+type Layout string
+
+const (
+	// LayoutSingle writes every schema to the language's output file
+	LayoutSingle Layout = "single"
+	// LayoutNamespace writes a module per namespace, plus an index in the
+	// language's output file that imports them all, so bundlers can drop
+	// the namespaces an app never uses
+	LayoutNamespace Layout = "namespace"
+)
+
+// Layouts lists the supported layouts, the default first
+var Layouts = []Layout{LayoutSingle, LayoutNamespace}
+
+// ParseLayout returns the layout named s; "" is the default layout
+func ParseLayout(s string) (Layout, error) {
+	if s == "" {
+		return LayoutSingle, nil
+	}
+	for _, l := range Layouts {
+		if string(l) == s {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output layout %q (expected single or namespace)", s)
+}
+
+// TemplateData is passed to the language template. Project templates are
+// written against it, so fields are only ever added.
 type TemplateData struct {
-	Imports string                 // merged imports
-	Schemas []language.SchemaEntry // individual schema entries
-	Header  string                 // language-specific header (e.g., Go package decl)
-	Footer  string                 // language-specific footer
+	Language   string                    // e.g., "typescript"
+	Namespace  string                    // the namespace of a namespace module, "" in other files
+	Imports    string                    // merged imports
+	Schemas    []language.SchemaEntry    // individual schema entries
+	Header     string                    // language-specific header (e.g., Go package decl)
+	Footer     string                    // language-specific footer
+	Namespaces []language.NamespaceEntry // namespace modules, for the index template
+}
+
+// File is a generated file and its contents
+type File struct {
+	Path    string
+	Content []byte
+}
+
+// Inject writes generated code to output directory and returns the paths of
+// the files it generated. Files are replaced atomically and only when their
+// content changes; files the language generated before and no longer does
+// are removed.
+func Inject(input InjectInput) ([]string, error) {
+	files, err := RenderFiles(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure output directory exists
+	if err := os.MkdirAll(input.OutDir, 0755); err != nil {
+		ui.Verbosef("failed to create output directory: %s", input.OutDir)
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	m, err := readManifest(input.OutDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Write output files
+	for _, file := range files {
+		wrote, err := writeFile(file.Path, file.Content)
+		if err != nil {
+			ui.Verbosef("failed to write output file: %s", file.Path)
+			return nil, fmt.Errorf("failed to write output file: %w", err)
+		}
+		if !wrote {
+			ui.Verbosef("output unchanged: %s", file.Path)
+			continue
+		}
+		ui.Verbosef("successfully injected schemas: path=%s, bytes=%d", file.Path, len(file.Content))
+	}
+
+	// Remove what is no longer generated, then record what is
+	if err := m.prune(input.OutDir, input.Language, fileNames(files)); err != nil {
+		return nil, err
+	}
+	if err := m.save(input.OutDir); err != nil {
+		return nil, fmt.Errorf("failed to write output manifest: %w", err)
+	}
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	return paths, nil
 }
 
-// Inject writes generated code to output directory
-func Inject(input InjectInput) error {
+// OutputPath returns the path of the generated file Inject writes for the
+// input, the index in the namespace layout
+func OutputPath(input InjectInput) (string, error) {
+	lang := language.ByName(input.Language)
+	if lang == nil {
+		return "", fmt.Errorf("unsupported language: %s", input.Language)
+	}
+	return filepath.Join(input.OutDir, lang.OutputFile), nil
+}
+
+// Render returns the contents of the file at OutputPath without touching
+// the filesystem
+func Render(input InjectInput) ([]byte, error) {
+	files, err := RenderFiles(input)
+	if err != nil {
+		return nil, err
+	}
+	outPath, err := OutputPath(input)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.Path == outPath {
+			return file.Content, nil
+		}
+	}
+	return nil, fmt.Errorf("no output rendered for %s", outPath)
+}
+
+// RenderFiles executes the language templates for the input's layout and
+// returns every file Inject writes, without touching the filesystem
+func RenderFiles(input InjectInput) ([]File, error) {
 	lang := language.ByName(input.Language)
 	if lang == nil {
 		ui.Verbosef("unsupported language: %s", input.Language)
-		return fmt.Errorf("unsupported language: %s", input.Language)
+		return nil, fmt.Errorf("unsupported language: %s", input.Language)
 	}
 
 	if lang.Template == "" {
 		ui.Verbosef("no template defined for language: %s", input.Language)
-		return fmt.Errorf("no template defined for language: %s", input.Language)
+		return nil, fmt.Errorf("no template defined for language: %s", input.Language)
+	}
+
+	ui.Verbosef("rendering schemas: language=%s, layout=%s, outputs=%d, outDir=%s", input.Language, input.Layout, len(input.Outputs), input.OutDir)
+
+	layout, err := ParseLayout(string(input.Layout))
+	if err != nil {
+		return nil, err
+	}
+	user, err := loadTemplate(input.Template)
+	if err != nil {
+		return nil, err
+	}
+	input.Outputs = withVarNames(lang, input.Outputs)
+	if layout == LayoutNamespace {
+		if user != nil && user.body {
+			return nil, fmt.Errorf("template %s replaces the whole output file, which the namespace layout does not have; define its blocks instead", input.Template)
+		}
+		return renderNamespaces(input, lang, user)
+	}
+
+	data := buildTemplateData(input, lang, input.Outputs)
+	content, err := render(lang, lang.Template, user, data)
+	if err != nil {
+		return nil, err
+	}
+	return []File{{Path: filepath.Join(input.OutDir, lang.OutputFile), Content: content}}, nil
+}
+
+// renderNamespaces renders a module per namespace, in namespace order, then
+// the index importing them
+func renderNamespaces(input InjectInput, lang *language.Language, user *userTemplate) ([]File, error) {
+	if lang.NamespaceFile == nil || lang.NamespaceTemplate == "" || lang.IndexTemplate == "" {
+		return nil, fmt.Errorf("the namespace layout is not supported for %s", lang.Name)
+	}
+
+	byNamespace := make(map[string][]generator.GenerateOutput)
+	for _, out := range input.Outputs {
+		byNamespace[out.Namespace] = append(byNamespace[out.Namespace], out)
+	}
+	names := make([]string, 0, len(byNamespace))
+	for name := range byNamespace {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Two namespaces may sanitize to one file name, or a namespace to the index's
+	owners := map[string]string{lang.OutputFile: ""}
+	var files []File
+	var namespaces []language.NamespaceEntry
+	for _, name := range names {
+		fileName := lang.NamespaceFile(name)
+		if owner, taken := owners[fileName]; taken {
+			if owner == "" {
+				return nil, fmt.Errorf("namespace %q would overwrite the index %s, rename it or use the single layout", name, fileName)
+			}
+			return nil, fmt.Errorf("namespaces %q and %q would both be written to %s", owner, name, fileName)
+		}
+		owners[fileName] = name
+
+		data := buildTemplateData(input, lang, byNamespace[name])
+		data.Namespace = name
+		content, err := render(lang, lang.NamespaceTemplate, user, data)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Path: filepath.Join(input.OutDir, fileName), Content: content})
+		namespaces = append(namespaces, language.NamespaceEntry{
+			Name:    name,
+			Module:  strings.TrimSuffix(fileName, filepath.Ext(fileName)),
+			Schemas: data.Schemas,
+		})
+	}
+
+	// The index declares no schema code of its own, so it needs none of their imports
+	data := buildTemplateData(input, lang, input.Outputs)
+	data.Imports = ""
+	data.Namespaces = namespaces
+	content, err := render(lang, lang.IndexTemplate, user, data)
+	if err != nil {
+		return nil, err
 	}
+	return append(files, File{Path: filepath.Join(input.OutDir, lang.OutputFile), Content: content}), nil
+}
 
-	ui.Verbosef("injecting schemas: language=%s, outputs=%d, outDir=%s", input.Language, len(input.Outputs), input.OutDir)
+// userTemplate is a project's template file
+type userTemplate struct {
+	path string
+	text string
+	body bool // it has content outside {{define}}s, replacing the built-in template
+}
 
-	// Build template data
-	data := buildTemplateData(input, lang)
+// loadTemplate reads a project template file, "" meaning none
+func loadTemplate(path string) (*userTemplate, error) {
+	if path == "" {
+		return nil, nil
+	}
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(language.TemplateFuncs).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+	ui.Verbosef("loaded template: %s", path)
+	return &userTemplate{
+		path: path,
+		text: string(text),
+		body: tmpl.Tree != nil && !parse.IsEmptyTree(tmpl.Tree.Root),
+	}, nil
+}
 
-	ui.Verbosef("template data: imports=%d, schemas=%d", len(data.Imports), len(data.Schemas))
+// render executes a template of the language and formats the result. The
+// project's template, if any, redefines blocks of the built-in one or, with
+// a body of its own, is executed instead.
+func render(lang *language.Language, text string, user *userTemplate, data TemplateData) ([]byte, error) {
+	ui.Verbosef("template data: imports=%d, schemas=%d, namespaces=%d", len(data.Imports), len(data.Schemas), len(data.Namespaces))
 
 	// Parse and execute template
-	tmpl, err := template.New("inject").Parse(lang.Template)
+	tmpl, err := template.New("inject").Funcs(language.TemplateFuncs).Parse(text)
 	if err != nil {
-		ui.Verbosef("failed to parse template for language: %s", input.Language)
-		return fmt.Errorf("failed to parse template: %w", err)
+		ui.Verbosef("failed to parse template for language: %s", lang.Name)
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	exec := tmpl
+	if user != nil {
+		exec, err = tmpl.New(filepath.Base(user.path)).Parse(user.text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", user.path, err)
+		}
+		if !user.body {
+			exec = tmpl
+		}
 	}
 
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		ui.Verbosef("failed to execute template for language: %s", input.Language)
-		return fmt.Errorf("failed to execute template: %w", err)
+	if err := exec.Execute(&buf, data); err != nil {
+		ui.Verbosef("failed to execute template for language: %s", lang.Name)
+		return nil, fmt.Errorf("failed to execute template: %w", err)
 	}
 
 	ui.Verbosef("template execution successful: %d bytes", buf.Len())
-
-	// Ensure output directory exists
-	if err := os.MkdirAll(input.OutDir, 0755); err != nil {
-		ui.Verbosef("failed to create output directory: %s", input.OutDir)
-		return fmt.Errorf("failed to create output directory: %w", err)
+	if lang.Format != nil {
+		formatted, err := lang.Format(buf.Bytes())
+		if err != nil {
+			ui.Verbosef("failed to format output for language: %s\n%s", lang.Name, buf.String())
+			return nil, fmt.Errorf("failed to format generated %s code: %w", lang.Name, err)
+		}
+		return formatted, nil
 	}
+	return buf.Bytes(), nil
+}
 
-	// Write output file
-	outPath := filepath.Join(input.OutDir, lang.OutputFile)
-	if err := os.WriteFile(outPath, buf.Bytes(), 0644); err != nil {
-		ui.Verbosef("failed to write output file: %s", outPath)
-		return fmt.Errorf("failed to write output file: %w", err)
+// withVarNames returns the outputs with every VarName set. Outputs of a run
+// carry the names their code was generated with; the rest are assigned here.
+func withVarNames(lang *language.Language, outputs []generator.GenerateOutput) []generator.GenerateOutput {
+	if !slices.ContainsFunc(outputs, func(o generator.GenerateOutput) bool { return o.VarName == "" }) {
+		return outputs
+	}
+	entries := make([]language.SchemaEntry, len(outputs))
+	for i, out := range outputs {
+		entries[i] = language.SchemaEntry{Namespace: out.Namespace, ID: out.ID}
 	}
+	lang.AssignVarNames(entries)
 
-	ui.Verbosef("successfully injected schemas: path=%s, bytes=%d", outPath, buf.Len())
-	return nil
+	named := slices.Clone(outputs)
+	for i := range named {
+		if named[i].VarName == "" {
+			named[i].VarName = entries[i].VarName
+		}
+	}
+	return named
 }
 
-func buildTemplateData(input InjectInput, lang *language.Language) TemplateData {
+func buildTemplateData(input InjectInput, lang *language.Language, outputs []generator.GenerateOutput) TemplateData {
 	// Collect all imports
 	var allImports []string
-	for _, out := range input.Outputs {
+	for _, out := range outputs {
 		allImports = append(allImports, out.Imports...)
 	}
 
@@ -94,16 +349,12 @@ func buildTemplateData(input InjectInput, lang *language.Language) TemplateData
 	}
 
 	// Build schema entries
-	schemas := make([]language.SchemaEntry, len(input.Outputs))
-	for i, out := range input.Outputs {
-		varName := out.Namespace + "_" + out.ID // default
-		if lang.BuildVarName != nil {
-			varName = lang.BuildVarName(out.Namespace, out.ID)
-		}
+	schemas := make([]language.SchemaEntry, len(outputs))
+	for i, out := range outputs {
 		schemas[i] = language.SchemaEntry{
 			Namespace: out.Namespace,
 			ID:        out.ID,
-			VarName:   varName,
+			VarName:   out.VarName,
 			Code:      out.Schema,
 			Type:      out.Type,
 		}
@@ -119,10 +370,11 @@ func buildTemplateData(input InjectInput, lang *language.Language) TemplateData
 	}
 
 	return TemplateData{
-		Imports: mergedImports,
-		Schemas: schemas,
-		Header:  header,
-		Footer:  footer,
+		Language: lang.Name,
+		Imports:  mergedImports,
+		Schemas:  schemas,
+		Header:   header,
+		Footer:   footer,
 	}
 }
 
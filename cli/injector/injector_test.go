@@ -3,6 +3,7 @@ package injector
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 
@@ -34,7 +35,7 @@ func TestInject_TypeScript(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -107,7 +108,7 @@ func TestInject_Python(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -152,8 +153,358 @@ func TestInject_Python(t *testing.T) {
 	}
 }
 
+func TestInject_Go(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "schemas")
+
+	input := InjectInput{
+		Language: "go",
+		OutDir:   outDir,
+		Outputs: []generator.GenerateOutput{
+			{
+				Namespace: "user",
+				ID:        "User",
+				Schema: `type UserUser struct {
+Name string ` + "`json:\"name\"`" + `
+}
+
+func (v UserUser) Validate() error {
+if v.Name == "" {
+return errors.New("name: must not be empty")
+}
+return nil
+}`,
+				Type:    "UserUser",
+				Imports: []string{"errors"},
+			},
+			{
+				Namespace: "user",
+				ID:        "Post",
+				Schema:    "type UserPost string\n\nfunc (v UserPost) Validate() error { return fmt.Errorf(\"%s\", v) }",
+				Type:      "UserPost",
+				Imports:   []string{`"fmt"`, "errors"},
+			},
+		},
+	}
+
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outDir, "xschema.gen.go"))
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	output := string(content)
+
+	if !strings.HasPrefix(output, "// Code generated by xschema. DO NOT EDIT.") {
+		t.Error("Missing generated code header")
+	}
+	if !strings.Contains(output, "\npackage schemas\n") {
+		t.Error("Package clause not named after the output directory")
+	}
+	if !strings.Contains(output, "import (\n\t\"errors\"\n\t\"fmt\"\n)") {
+		t.Error("Imports not properly merged")
+	}
+
+	// The output is gofmt'd
+	if !strings.Contains(output, "\tName string `json:\"name\"`") {
+		t.Error("Output is not formatted")
+	}
+
+	if !strings.Contains(output, `"user:User": func() Validator { return new(UserUser) },`) {
+		t.Error("Missing user:User in schema registry")
+	}
+	if !strings.Contains(output, `"user:Post": func() Validator { return new(UserPost) },`) {
+		t.Error("Missing user:Post in schema registry")
+	}
+}
+
+func TestRender_GoInvalidCode(t *testing.T) {
+	_, err := Render(InjectInput{
+		Language: "go",
+		OutDir:   t.TempDir(),
+		Outputs: []generator.GenerateOutput{
+			{Namespace: "user", ID: "User", Schema: "type UserUser struct {", Type: "UserUser"},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "failed to format generated go code") {
+		t.Errorf("expected a format error, got %v", err)
+	}
+}
+
+// namespaceOutputs has two namespaces, interleaved the way adapter batches
+// return them
+var namespaceOutputs = []generator.GenerateOutput{
+	{Namespace: "user", ID: "User", Schema: `z.object({ id: z.string() })`, Type: "z.infer<typeof user_User>", Imports: []string{`import { z } from "zod"`}},
+	{Namespace: "post", ID: "Post", Schema: `v.object({ title: v.string() })`, Type: "v.InferOutput<typeof post_Post>", Imports: []string{`import * as v from "valibot"`}},
+	{Namespace: "user", ID: "Admin", Type: "{ role: string }"},
+}
+
+func TestInject_NamespaceLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+	paths, err := Inject(InjectInput{Language: "typescript", OutDir: tmpDir, Layout: LayoutNamespace, Outputs: namespaceOutputs})
+	if err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	for _, name := range []string{"user.gen.ts", "post.gen.ts", "xschema.gen.ts"} {
+		if !slices.Contains(paths, filepath.Join(tmpDir, name)) {
+			t.Errorf("expected %s among the generated files, got %v", name, paths)
+		}
+	}
+
+	read := func(name string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		return string(content)
+	}
+
+	user := read("user.gen.ts")
+	for _, want := range []string{
+		`import { z } from "zod"`,
+		"export const user_User =",
+		"export type user_Admin = { role: string };",
+		`"user:User": user_User,`,
+		`"user:Admin": user_Admin;`,
+	} {
+		if !strings.Contains(user, want) {
+			t.Errorf("user.gen.ts is missing %q:\n%s", want, user)
+		}
+	}
+	// Each module only imports what its own schemas use
+	if strings.Contains(user, "valibot") || strings.Contains(user, "post_Post") {
+		t.Errorf("user.gen.ts holds another namespace's code:\n%s", user)
+	}
+	if post := read("post.gen.ts"); !strings.Contains(post, `"post:Post": post_Post,`) || strings.Contains(post, "zod") {
+		t.Errorf("post.gen.ts is wrong:\n%s", post)
+	}
+
+	// Namespaces are imported in sorted order, whatever order adapters returned them in
+	index := read("xschema.gen.ts")
+	for _, want := range []string{
+		`import { schemas as schemas0, type SchemaTypes as SchemaTypes0 } from "./post.gen";`,
+		`import { schemas as schemas1, type SchemaTypes as SchemaTypes1 } from "./user.gen";`,
+		"  ...schemas0,\n  ...schemas1,\n} as const;",
+		"export type SchemaTypes = SchemaTypes0 & SchemaTypes1;",
+		"declare module '@xschema/client'",
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index is missing %q:\n%s", want, index)
+		}
+	}
+	if strings.Contains(index, "zod") {
+		t.Errorf("index should not import adapter packages:\n%s", index)
+	}
+
+	// Render still returns the file clients import
+	rendered, err := Render(InjectInput{Language: "typescript", OutDir: tmpDir, Layout: LayoutNamespace, Outputs: namespaceOutputs})
+	if err != nil || string(rendered) != index {
+		t.Errorf("Render should return the index, got err %v", err)
+	}
+}
+
+func TestInject_NamespaceLayoutPython(t *testing.T) {
+	tmpDir := t.TempDir()
+	_, err := Inject(InjectInput{
+		Language: "python",
+		OutDir:   tmpDir,
+		Layout:   LayoutNamespace,
+		Outputs: []generator.GenerateOutput{
+			{Namespace: "my-api", ID: "Key", Schema: "class my_api_Key(BaseModel):\n    id: str", Imports: []string{"from pydantic import BaseModel"}},
+			{Namespace: "user", ID: "User", Schema: "class user_User(BaseModel):\n    name: str", Imports: []string{"from pydantic import BaseModel"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+
+	// Namespaces that are not Python identifiers get an importable module name
+	module, err := os.ReadFile(filepath.Join(tmpDir, "my_api.py"))
+	if err != nil {
+		t.Fatalf("Failed to read submodule: %v", err)
+	}
+	if !strings.Contains(string(module), "from pydantic import BaseModel") || !strings.Contains(string(module), `"my-api:Key": my_api_Key,`) {
+		t.Errorf("submodule is wrong:\n%s", module)
+	}
+
+	index, err := os.ReadFile(filepath.Join(tmpDir, "__init__.py"))
+	if err != nil {
+		t.Fatalf("Failed to read __init__.py: %v", err)
+	}
+	for _, want := range []string{
+		"from .user import _schemas as _schemas1, user_User",
+		"  **_schemas0,\n  **_schemas1,\n}",
+		"class xschema(XSchemaBase):",
+		"    user_User = user_User",
+	} {
+		if !strings.Contains(string(index), want) {
+			t.Errorf("__init__.py is missing %q:\n%s", want, index)
+		}
+	}
+}
+
+func TestInject_NamespaceLayoutGo(t *testing.T) {
+	tmpDir := filepath.Join(t.TempDir(), "schemas")
+	files, err := RenderFiles(InjectInput{
+		Language: "go",
+		OutDir:   tmpDir,
+		Layout:   LayoutNamespace,
+		Outputs: []generator.GenerateOutput{
+			{Namespace: "user", ID: "User", Schema: "type UserUser struct{}\n\nfunc (v UserUser) Validate() error { return errors.New(\"x\") }", Type: "UserUser", Imports: []string{"errors"}},
+			{Namespace: "post", ID: "Post", Schema: "type PostPost struct{}\n\nfunc (v PostPost) Validate() error { return nil }", Type: "PostPost"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RenderFiles failed: %v", err)
+	}
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, filepath.Base(file.Path))
+		// Every file of the package has its clause
+		if !strings.Contains(string(file.Content), "\npackage schemas\n") {
+			t.Errorf("%s has no package clause:\n%s", file.Path, file.Content)
+		}
+	}
+	if got := strings.Join(paths, ","); got != "post.gen.go,user.gen.go,xschema.gen.go" {
+		t.Errorf("files = %s", got)
+	}
+	if post := string(files[0].Content); strings.Contains(post, "import") {
+		t.Errorf("post.gen.go should import nothing:\n%s", post)
+	}
+	if index := string(files[2].Content); !strings.Contains(index, `"user:User": func() Validator { return new(UserUser) },`) || strings.Contains(index, "errors") {
+		t.Errorf("index is wrong:\n%s", index)
+	}
+}
+
+func TestRenderFiles_NamespaceCollision(t *testing.T) {
+	tests := []struct {
+		name       string
+		language   string
+		namespaces []string
+		want       string
+	}{
+		{"index", "typescript", []string{"xschema"}, "would overwrite the index xschema.gen.ts"},
+		{"sanitized", "python", []string{"my-api", "my_api"}, "would both be written to my_api.py"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var outputs []generator.GenerateOutput
+			for _, ns := range tt.namespaces {
+				outputs = append(outputs, generator.GenerateOutput{Namespace: ns, ID: "A", Type: "string"})
+			}
+			_, err := RenderFiles(InjectInput{Language: tt.language, OutDir: t.TempDir(), Layout: LayoutNamespace, Outputs: outputs})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseLayout(t *testing.T) {
+	for in, want := range map[string]Layout{"": LayoutSingle, "single": LayoutSingle, "namespace": LayoutNamespace} {
+		if got, err := ParseLayout(in); err != nil || got != want {
+			t.Errorf("ParseLayout(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseLayout("files"); err == nil {
+		t.Error("expected an error for an unknown layout")
+	}
+}
+
+// writeTemplate writes a project template file and returns its path
+func writeTemplate(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "xschema.tmpl")
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRender_TemplateBlocks(t *testing.T) {
+	template := writeTemplate(t, `{{define "header"}}// Copyright Example Corp
+{{- end}}
+{{define "augmentation"}}
+{{- range .Schemas}}
+registry.add({{quote .Key}}, {{camel .ID}});
+{{- end}}
+{{- end}}`)
+
+	for _, layout := range Layouts {
+		t.Run(string(layout), func(t *testing.T) {
+			files, err := RenderFiles(InjectInput{Language: "typescript", OutDir: t.TempDir(), Layout: layout, Template: template, Outputs: namespaceOutputs})
+			if err != nil {
+				t.Fatalf("RenderFiles failed: %v", err)
+			}
+			for _, file := range files {
+				output := string(file.Content)
+				if !strings.HasPrefix(output, "// Copyright Example Corp\n") || strings.Contains(output, "DO NOT EDIT") {
+					t.Errorf("%s: header block not overridden:\n%s", file.Path, output)
+				}
+			}
+
+			// The blocks the template leaves alone are the built-in ones
+			index := string(files[len(files)-1].Content)
+			for _, want := range []string{`registry.add("user:Admin", admin);`, "export const schemas = {"} {
+				if !strings.Contains(index, want) {
+					t.Errorf("index is missing %q:\n%s", want, index)
+				}
+			}
+			if strings.Contains(index, "declare module") {
+				t.Errorf("augmentation block not overridden:\n%s", index)
+			}
+		})
+	}
+}
+
+func TestRender_TemplateBody(t *testing.T) {
+	template := writeTemplate(t, `{{template "header" .}}
+{{- range .Schemas}}
+export const {{pascal .VarName}} = {{json .Code}};
+{{- end}}
+`)
+	input := InjectInput{Language: "typescript", OutDir: t.TempDir(), Template: template, Outputs: namespaceOutputs[:1]}
+	output, err := Render(input)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	want := "// Generated by xschema - DO NOT EDIT\n// https://xschema.dev/docs\nexport const UserUser = \"z.object({ id: z.string() })\";\n"
+	if string(output) != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+
+	// Modules and their index can't share one body
+	input.Layout = LayoutNamespace
+	if _, err := Render(input); err == nil || !strings.Contains(err.Error(), "define its blocks instead") {
+		t.Errorf("expected the namespace layout to reject a template body, got %v", err)
+	}
+}
+
+func TestRender_TemplateErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"missing", filepath.Join(t.TempDir(), "missing.tmpl"), "failed to read template"},
+		{"parse", writeTemplate(t, `{{define "header"}}{{.Schemas`), "failed to parse template"},
+		{"execute", writeTemplate(t, `{{define "header"}}{{.Nope}}{{end}}`), "failed to execute template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Render(InjectInput{Language: "python", OutDir: t.TempDir(), Template: tt.template})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
 func TestInject_UnsupportedLanguage(t *testing.T) {
-	err := Inject(InjectInput{
+	_, err := Inject(InjectInput{
 		Language: "rust",
 		OutDir:   t.TempDir(),
 		Outputs:  []generator.GenerateOutput{},
@@ -184,7 +535,7 @@ func TestInject_TypeOnly(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -222,7 +573,7 @@ func TestInject_SchemaOnly(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -247,7 +598,7 @@ func TestInject_CreatesDirectory(t *testing.T) {
 	tmpDir := t.TempDir()
 	outDir := filepath.Join(tmpDir, "nested", ".xschema")
 
-	err := Inject(InjectInput{
+	_, err := Inject(InjectInput{
 		Language: "typescript",
 		OutDir:   outDir,
 		Outputs: []generator.GenerateOutput{
@@ -433,7 +784,7 @@ func TestInject_EmptyOutputs(t *testing.T) {
 		Outputs:  []generator.GenerateOutput{},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -481,7 +832,7 @@ func TestInject_MixedSchemaAndType(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -518,7 +869,7 @@ func TestInject_MultipleNamespaces(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -564,7 +915,7 @@ func TestInject_DifferentImports(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -602,7 +953,7 @@ func TestInject_OverwriteExisting(t *testing.T) {
 		},
 	}
 
-	err := Inject(input)
+	_, err := Inject(input)
 	if err != nil {
 		t.Fatalf("Inject failed: %v", err)
 	}
@@ -675,7 +1026,7 @@ func TestInjectClient_FileNotFound(t *testing.T) {
 }
 
 func TestInject_NilLanguage(t *testing.T) {
-	err := Inject(InjectInput{
+	_, err := Inject(InjectInput{
 		Language: "",
 		OutDir:   t.TempDir(),
 		Outputs:  []generator.GenerateOutput{},
@@ -685,3 +1036,46 @@ func TestInject_NilLanguage(t *testing.T) {
 		t.Error("Expected error for empty language")
 	}
 }
+
+func TestRender_MatchesInjectWithoutWriting(t *testing.T) {
+	tmpDir := t.TempDir()
+	outDir := filepath.Join(tmpDir, ".xschema")
+
+	input := InjectInput{
+		Language: "typescript",
+		OutDir:   outDir,
+		Outputs: []generator.GenerateOutput{
+			{Namespace: "user", ID: "User", Schema: "z.string()", Type: "string", Imports: []string{`import { z } from "zod"`}},
+		},
+	}
+
+	rendered, err := Render(input)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if _, err := os.Stat(outDir); !os.IsNotExist(err) {
+		t.Fatal("Render should not create the output directory")
+	}
+
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	outPath, err := OutputPath(input)
+	if err != nil {
+		t.Fatalf("OutputPath failed: %v", err)
+	}
+	if outPath != filepath.Join(outDir, "xschema.gen.ts") {
+		t.Errorf("unexpected output path: %s", outPath)
+	}
+	written, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Failed to read output: %v", err)
+	}
+	if string(written) != string(rendered) {
+		t.Error("Render output differs from what Inject wrote")
+	}
+
+	if _, err := OutputPath(InjectInput{Language: "cobol"}); err == nil {
+		t.Error("expected error for unsupported language")
+	}
+}
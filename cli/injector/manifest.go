@@ -0,0 +1,140 @@
+package injector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/xschemadev/xschema/internal/atomicfile"
+	"github.com/xschemadev/xschema/ui"
+)
+
+// ManifestFile lists the files xschema generated in an output directory, so
+// the ones it no longer generates can be removed without touching anything
+// else kept there
+const ManifestFile = ".xschema-manifest.json"
+
+// manifestVersion is bumped when the manifest format changes incompatibly
+const manifestVersion = 1
+
+// manifest records the generated file names of each language writing to an
+// output directory; languages may share one
+type manifest struct {
+	Version int                 `json:"version"`
+	Files   map[string][]string `json:"files"` // by language
+}
+
+// readManifest loads the manifest of an output directory. A directory without
+// one, e.g. generated by an older xschema, owns no files yet.
+func readManifest(outDir string) (*manifest, error) {
+	path := filepath.Join(outDir, ManifestFile)
+	m := &manifest{Version: manifestVersion, Files: make(map[string][]string)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if m.Version > manifestVersion {
+		return nil, fmt.Errorf("%s has version %d, this xschema supports up to %d", path, m.Version, manifestVersion)
+	}
+	if m.Files == nil {
+		m.Files = make(map[string][]string)
+	}
+	m.Version = manifestVersion
+	return m, nil
+}
+
+// save writes the manifest with sorted keys and a trailing newline
+func (m *manifest) save(outDir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	_, err = writeFile(filepath.Join(outDir, ManifestFile), append(data, '\n'))
+	return err
+}
+
+// stale returns the files a language generated before but not in names, that
+// no other language sharing the directory generates either
+func (m *manifest) stale(lang string, names []string) []string {
+	var stale []string
+	for _, name := range m.Files[lang] {
+		// Only plain file names are pruned, whatever a hand-edited manifest says
+		if slices.Contains(names, name) || name != filepath.Base(name) || name == "." || name == ".." || name == ManifestFile {
+			continue
+		}
+		if !m.ownedByOther(lang, name) {
+			stale = append(stale, name)
+		}
+	}
+	return stale
+}
+
+// ownedByOther reports whether another language generated a file name
+func (m *manifest) ownedByOther(lang, name string) bool {
+	for other, files := range m.Files {
+		if other != lang && slices.Contains(files, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// prune removes a language's stale files and records names as its files
+func (m *manifest) prune(outDir, lang string, names []string) error {
+	for _, name := range m.stale(lang, names) {
+		path := filepath.Join(outDir, name)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale output %s: %w", path, err)
+		}
+		ui.Verbosef("removed stale output file: %s", path)
+	}
+	m.Files[lang] = names
+	return nil
+}
+
+// StaleFiles returns the files of an output directory that a language
+// generated before but that rendering files would no longer produce
+func StaleFiles(input InjectInput, files []File) ([]string, error) {
+	m, err := readManifest(input.OutDir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, name := range m.stale(input.Language, fileNames(files)) {
+		path := filepath.Join(input.OutDir, name)
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// fileNames returns the names of files in an output directory
+func fileNames(files []File) []string {
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = filepath.Base(file.Path)
+	}
+	return names
+}
+
+// writeFile replaces a file atomically. A file that already has the
+// content is not rewritten, keeping its mtime so bundlers and watchers don't
+// rebuild. It reports whether it wrote.
+func writeFile(path string, data []byte) (bool, error) {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, data) {
+		return false, nil
+	}
+	return true, atomicfile.WriteFile(path, data)
+}
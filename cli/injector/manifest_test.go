@@ -0,0 +1,153 @@
+package injector
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/xschemadev/xschema/generator"
+)
+
+// dirNames lists the entries of a directory
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestInject_SkipsUnchangedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	input := InjectInput{Language: "typescript", OutDir: tmpDir, Outputs: namespaceOutputs}
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+
+	path := filepath.Join(tmpDir, "xschema.gen.ts")
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(old) {
+		t.Error("unchanged output was rewritten")
+	}
+	if info.Mode().Perm()&0644 != 0644 {
+		t.Errorf("output mode = %v, want it readable like before", info.Mode().Perm())
+	}
+
+	// Changed output is written, and no temp files are left behind
+	input.Outputs = namespaceOutputs[:1]
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	if info, _ := os.Stat(path); info.ModTime().Equal(old) {
+		t.Error("changed output was not written")
+	}
+	if got := dirNames(t, tmpDir); !slices.Equal(got, []string{ManifestFile, "xschema.gen.ts"}) {
+		t.Errorf("output directory holds %v", got)
+	}
+}
+
+func TestInject_PrunesStaleFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, "helpers.ts"), []byte("// mine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := InjectInput{Language: "typescript", OutDir: tmpDir, Layout: LayoutNamespace, Outputs: namespaceOutputs}
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+
+	// Removing a namespace removes its module
+	input.Outputs = namespaceOutputs[:1]
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	want := []string{ManifestFile, "helpers.ts", "user.gen.ts", "xschema.gen.ts"}
+	if got := dirNames(t, tmpDir); !slices.Equal(got, want) {
+		t.Errorf("after removing a namespace: %v, want %v", got, want)
+	}
+
+	files, err := RenderFiles(InjectInput{Language: "typescript", OutDir: tmpDir, Outputs: namespaceOutputs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, err := StaleFiles(input, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stale, []string{filepath.Join(tmpDir, "user.gen.ts")}) {
+		t.Errorf("StaleFiles = %v", stale)
+	}
+
+	// Switching back to one file removes every module, and only those
+	input.Layout = LayoutSingle
+	if _, err := Inject(input); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	want = []string{ManifestFile, "helpers.ts", "xschema.gen.ts"}
+	if got := dirNames(t, tmpDir); !slices.Equal(got, want) {
+		t.Errorf("after switching layouts: %v, want %v", got, want)
+	}
+}
+
+func TestInject_SharedOutputDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	py := InjectInput{
+		Language: "python",
+		OutDir:   tmpDir,
+		Outputs:  []generator.GenerateOutput{{Namespace: "user", ID: "User", Schema: "class user_User: pass"}},
+	}
+	ts := InjectInput{Language: "typescript", OutDir: tmpDir, Outputs: namespaceOutputs}
+	for _, input := range []InjectInput{py, ts} {
+		if _, err := Inject(input); err != nil {
+			t.Fatalf("Inject failed: %v", err)
+		}
+	}
+
+	// A language's files are not another's stale files
+	ts.Layout = LayoutNamespace
+	if _, err := Inject(ts); err != nil {
+		t.Fatalf("Inject failed: %v", err)
+	}
+	want := []string{ManifestFile, "__init__.py", "post.gen.ts", "user.gen.ts", "xschema.gen.ts"}
+	if got := dirNames(t, tmpDir); !slices.Equal(got, want) {
+		t.Errorf("output directory holds %v, want %v", got, want)
+	}
+}
+
+func TestReadManifest_Invalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpDir, ManifestFile), []byte(`{"version": 99}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Inject(InjectInput{Language: "typescript", OutDir: tmpDir}); err == nil {
+		t.Error("expected an error for a manifest from a newer xschema")
+	}
+}
+
+func TestManifestStale_IgnoresPaths(t *testing.T) {
+	m := &manifest{Files: map[string][]string{
+		"typescript": {"../outside.ts", "sub/file.ts", ManifestFile, "old.gen.ts", "shared.ts"},
+		"python":     {"shared.ts"},
+	}}
+	if got := m.stale("typescript", []string{"xschema.gen.ts"}); !slices.Equal(got, []string{"old.gen.ts"}) {
+		t.Errorf("stale = %v, want [old.gen.ts]", got)
+	}
+}
@@ -36,7 +36,7 @@ func TestIntegration_MultipleConfigs(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	result, err := parser.Parse(ctx, tmpDir, "")
+	result, err := parser.Parse(ctx, tmpDir, "", nil)
 	if err != nil {
 		t.Fatalf("Parse failed: %v", err)
 	}
@@ -75,7 +75,7 @@ func TestIntegration_InlineJSONPassthrough(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	result, err := parser.Parse(ctx, tmpDir, "")
+	result, err := parser.Parse(ctx, tmpDir, "", nil)
 	if err != nil {
 		t.Fatalf("Parse failed: %v", err)
 	}
@@ -110,7 +110,7 @@ func TestIntegration_AdapterGrouping(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	result, err := parser.Parse(ctx, tmpDir, "")
+	result, err := parser.Parse(ctx, tmpDir, "", nil)
 	if err != nil {
 		t.Fatalf("Parse failed: %v", err)
 	}
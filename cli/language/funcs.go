@@ -0,0 +1,65 @@
+package language
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TemplateFuncs are the functions output templates can call, built-in and
+// project templates alike. They are part of the template API, so existing
+// ones keep their behavior.
+var TemplateFuncs = template.FuncMap{
+	"camel":  Camel,
+	"pascal": Pascal,
+	"quote":  Quote,
+	"json":   JSON,
+}
+
+// Pascal joins the words of s, capitalized: "user_profile-url" -> "UserProfileUrl"
+func Pascal(s string) string {
+	var b strings.Builder
+	for _, word := range words(s) {
+		r, size := utf8.DecodeRuneInString(word)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(word[size:])
+	}
+	return b.String()
+}
+
+// Camel is Pascal with the first letter lower-cased: "user_profile-url" -> "userProfileUrl"
+func Camel(s string) string {
+	p := Pascal(s)
+	if p == "" {
+		return ""
+	}
+	r, size := utf8.DecodeRuneInString(p)
+	return string(unicode.ToLower(r)) + p[size:]
+}
+
+// words splits s on anything but letters and digits
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Quote returns s as a double-quoted string literal, valid in TypeScript,
+// Python and Go alike
+func Quote(s string) (string, error) {
+	return JSON(s)
+}
+
+// JSON encodes v compactly, leaving <, > and & as they are
+func JSON(v any) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
@@ -1,6 +1,7 @@
 package language
 
 import (
+	"path/filepath"
 	"regexp"
 	"slices"
 	"sort"
@@ -221,3 +222,58 @@ func BuildPythonFooter(_ string, schemas []SchemaEntry) string {
 
 	return strings.Join(lines, "\n")
 }
+
+// MergeGoImports dedupes and formats Go imports into one import block
+// Input: ["fmt", "\"regexp\"", "import \"fmt\"", "yaml \"gopkg.in/yaml.v3\""]
+// Output: "import (\n\t\"fmt\"\n\t\"regexp\"\n\tyaml \"gopkg.in/yaml.v3\"\n)"
+func MergeGoImports(imports []string) string {
+	specRe := regexp.MustCompile(`^(?:import\s+)?(?:([\w.]+)\s+)?"?([^"\s]+)"?$`)
+
+	byPath := make(map[string]string) // path -> spec
+	for _, imp := range imports {
+		matches := specRe.FindStringSubmatch(strings.TrimSpace(imp))
+		if matches == nil {
+			continue
+		}
+		spec := `"` + matches[2] + `"`
+		if matches[1] != "" {
+			spec = matches[1] + " " + spec
+		}
+		byPath[matches[2]] = spec
+	}
+	if len(byPath) == 0 {
+		return ""
+	}
+
+	paths := make([]string, 0, len(byPath))
+	for path := range byPath {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	b.WriteString("import (\n")
+	for _, path := range paths {
+		b.WriteString("\t" + byPath[path] + "\n")
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// BuildGoHeader generates the package clause, named after the output directory
+// e.g. ".xschema" -> "package xschema"
+func BuildGoHeader(outDir string, _ []SchemaEntry) string {
+	var name strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(outDir)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			name.WriteRune(r)
+		}
+	}
+	pkg := name.String()
+	if pkg == "" || pkg == "main" {
+		pkg = "xschema"
+	} else if pkg[0] >= '0' && pkg[0] <= '9' {
+		pkg = "x" + pkg
+	}
+	return "package " + pkg
+}
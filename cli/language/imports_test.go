@@ -142,3 +142,51 @@ func TestBuildPythonFooterEmpty(t *testing.T) {
 		t.Errorf("expected empty footer for no schemas, got %q", footer)
 	}
 }
+
+func TestMergeGoImports(t *testing.T) {
+	tests := []struct {
+		name     string
+		imports  []string
+		expected string
+	}{
+		{
+			name:     "empty",
+			imports:  []string{},
+			expected: "",
+		},
+		{
+			name:     "dedupe bare, quoted and import forms",
+			imports:  []string{`fmt`, `"fmt"`, `import "fmt"`},
+			expected: "import (\n\t\"fmt\"\n)",
+		},
+		{
+			name:     "sorted by path with aliases kept",
+			imports:  []string{`regexp`, `yaml "gopkg.in/yaml.v3"`, `errors`},
+			expected: "import (\n\t\"errors\"\n\tyaml \"gopkg.in/yaml.v3\"\n\t\"regexp\"\n)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MergeGoImports(tt.imports)
+			if got != tt.expected {
+				t.Errorf("MergeGoImports() =\n%q\nwant\n%q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildGoHeader(t *testing.T) {
+	tests := map[string]string{
+		"/app/internal/schemas": "package schemas",
+		"/app/.xschema":         "package xschema",
+		"/app/api-types":        "package apitypes",
+		"/app/2024":             "package x2024",
+		"/app/main":             "package xschema",
+	}
+	for outDir, want := range tests {
+		if got := BuildGoHeader(outDir, nil); got != want {
+			t.Errorf("BuildGoHeader(%q) = %q, want %q", outDir, got, want)
+		}
+	}
+}
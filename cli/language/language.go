@@ -1,10 +1,16 @@
 package language
 
 import (
+	"encoding/json"
+	"fmt"
+	"go/format"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -26,13 +32,24 @@ func (s SchemaEntry) Key() string {
 	return s.Namespace + ":" + s.ID
 }
 
+// NamespaceEntry is one namespace's module for the index template
+type NamespaceEntry struct {
+	Name    string        // e.g., "user"
+	Module  string        // module file name without extension, e.g. "user.gen"
+	Schemas []SchemaEntry // the schemas the module declares
+}
+
 type Language struct {
 	Name             string
-	Extensions       []string // file extensions for source files (for injector)
-	SchemaURL        string   // e.g., "https://xschema.dev/schemas/ts.jsonc"
-	SchemaExt        string   // e.g., "ts.jsonc" - extracted from SchemaURL
-	AdapterBinPrefix string   // e.g., "xschema-" - prefix for adapter binaries
-	DetectRunner     func() (cmd string, args []string, err error)
+	Extensions       []string                                                // file extensions for source files (for injector)
+	SchemaURL        string                                                  // e.g., "https://xschema.dev/schemas/ts.jsonc"
+	SchemaExt        string                                                  // e.g., "ts.jsonc" - extracted from SchemaURL
+	AdapterBinPrefix string                                                  // e.g., "xschema-" - prefix for adapter binaries
+	PackageFiles     []string                                                // manifests marking a package root, e.g. "package.json"
+	DetectRunner     func(dir string) (cmd string, args []string, err error) // package runner for a package root, see WalkUp
+	AdapterVersion   func(dir, binName string) string                        // installed package and version of an adapter, "" if unknown (optional)
+	ScriptRunner     []string                                                // runs a local adapter script, e.g. ["node"]
+	PackageBin       func(dir, binName string) (string, error)               // adapter script of a local package directory (optional)
 
 	// Client injection (after generation)
 	BuildSchemasImport   func(importPath string) string    // build import statement for schemas
@@ -41,12 +58,19 @@ type Language struct {
 	ClientFactoryPattern string                            // regex to find client factory calls e.g. createXSchemaClient({ ... })
 
 	// Output generation
+	OutputDir    string                                            // default output directory, e.g. ".xschema"
 	OutputFile   string                                            // e.g. "xschema.gen.ts", "__init__.py"
 	Template     string                                            // Go text/template for output
 	MergeImports func(imports []string) string                     // dedupe/format imports
 	BuildHeader  func(outDir string, schemas []SchemaEntry) string // inserted at top
 	BuildFooter  func(outDir string, schemas []SchemaEntry) string // inserted at bottom
 	BuildVarName func(namespace, id string) string                 // build variable name from namespace and id
+	Format       func(src []byte) ([]byte, error)                  // formats the rendered output (optional)
+
+	// Namespace layout (optional): one module per namespace, plus an index in OutputFile
+	NamespaceFile     func(namespace string) string // file name of a namespace's module, e.g. "user.gen.ts"
+	NamespaceTemplate string                        // Go text/template for a namespace module
+	IndexTemplate     string                        // Go text/template for the index importing every module
 
 	// Parser (fallback when git not available)
 	IgnoreDirs []string // directories to skip when walking
@@ -59,15 +83,23 @@ var Languages = []Language{
 		SchemaURL:            XSchemaBaseURL + "ts.jsonc",
 		SchemaExt:            "ts.jsonc",
 		AdapterBinPrefix:     "xschema-",
+		PackageFiles:         []string{"package.json"},
 		DetectRunner:         detectTSRunner,
+		AdapterVersion:       tsAdapterVersion,
+		ScriptRunner:         []string{"node"},
+		PackageBin:           tsPackageBin,
 		BuildSchemasImport:   buildTSSchemasImport,
 		ImportPattern:        `(?m)^import\s+.*$`,
 		InjectSchemasKey:     injectSchemasKeyBrace,
 		ClientFactoryPattern: `createXSchemaClient\s*\(\s*(\{[^}]*\})\s*\)`,
+		OutputDir:            ".xschema",
 		OutputFile:           "xschema.gen.ts",
 		Template:             TSTemplate,
 		MergeImports:         MergeTSImports,
-		BuildVarName:         buildVarNameUnderscore,
+		BuildVarName:         buildTSVarName,
+		NamespaceFile:        func(ns string) string { return ns + ".gen.ts" },
+		NamespaceTemplate:    TSNamespaceTemplate,
+		IndexTemplate:        TSIndexTemplate,
 		IgnoreDirs:           []string{"node_modules", "dist", "build"},
 	},
 	{
@@ -75,18 +107,45 @@ var Languages = []Language{
 		Extensions:           []string{".py"},
 		SchemaURL:            XSchemaBaseURL + "py.jsonc",
 		SchemaExt:            "py.jsonc",
+		PackageFiles:         []string{"pyproject.toml", "setup.py"},
 		DetectRunner:         detectPythonRunner,
+		ScriptRunner:         []string{"python"}, // a package directory runs its __main__.py
 		BuildSchemasImport:   buildPySchemasImport,
 		ImportPattern:        `(?m)^(?:import\s+|from\s+).*$`,
 		InjectSchemasKey:     injectSchemasKeyBrace,
 		ClientFactoryPattern: `create_xschema_client\s*\(\s*(\{[^}]*\})\s*\)`,
+		OutputDir:            ".xschema",
 		OutputFile:           "__init__.py",
 		Template:             PyTemplate,
 		MergeImports:         MergePyImports,
 		BuildFooter:          BuildPythonFooter,
-		BuildVarName:         buildVarNameUnderscore,
+		BuildVarName:         buildPyVarName,
+		NamespaceFile:        pyNamespaceFile,
+		NamespaceTemplate:    PyNamespaceTemplate,
+		IndexTemplate:        PyIndexTemplate,
 		IgnoreDirs:           []string{"__pycache__", ".venv", "venv"},
 	},
+	{
+		Name:              "go",
+		Extensions:        []string{".go"},
+		SchemaURL:         XSchemaBaseURL + "go.jsonc",
+		SchemaExt:         "go.jsonc",
+		AdapterBinPrefix:  "xschema-",
+		PackageFiles:      []string{"go.mod"},
+		DetectRunner:      detectGoRunner,
+		ScriptRunner:      []string{"go", "run"}, // a file or package directory
+		OutputDir:         "xschema",             // Go cannot import directories starting with a dot
+		OutputFile:        "xschema.gen.go",
+		Template:          GoTemplate,
+		MergeImports:      MergeGoImports,
+		BuildHeader:       BuildGoHeader,
+		BuildVarName:      buildGoVarName,
+		Format:            format.Source,
+		NamespaceFile:     func(ns string) string { return ns + ".gen.go" },
+		NamespaceTemplate: GoNamespaceTemplate,
+		IndexTemplate:     GoIndexTemplate,
+		IgnoreDirs:        []string{"vendor", "testdata"},
+	},
 }
 
 // languageBySchemaExt maps schema extensions to languages
@@ -136,49 +195,104 @@ func IsXSchemaURL(url string) bool {
 	return strings.HasPrefix(url, XSchemaBaseURL)
 }
 
-func detectTSRunner() (string, []string, error) {
-	checkCmd := func(cmd string) bool {
-		_, err := exec.LookPath(cmd)
-		return err == nil
+// PackageRoot returns the nearest directory at or above dir, and inside root,
+// holding one of the language's package manifests; root if there is none
+func (l *Language) PackageRoot(dir, root string) string {
+	dir, root = absPath(dir), absPath(root)
+	for d := dir; ; d = filepath.Dir(d) {
+		rel, err := filepath.Rel(root, d)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return root
+		}
+		for _, name := range l.PackageFiles {
+			if fileExists(filepath.Join(d, name)) {
+				return d
+			}
+		}
+		if d == root {
+			return root
+		}
 	}
+}
 
-	if _, err := os.Stat(filepath.Join(".", "package.json")); err == nil {
-		content, err := os.ReadFile(filepath.Join(".", "package.json"))
-		if err == nil {
-			pm := detectPackageManager(string(content))
-			if pm != "" && checkCmd(pm) {
-				switch pm {
-				case "bun":
-					return "bunx", nil, nil
-				case "pnpm":
-					return "pnpm", []string{"exec"}, nil
-				case "yarn":
-					return "yarn", nil, nil
-				case "npm":
-					return "npx", nil, nil
-				}
-			}
+// WalkUp calls fn for dir and each of its parents until fn returns true,
+// stopping after the root of the repository dir is in, or the filesystem
+// root outside a repository. Runner detection uses it to find the lockfiles
+// of a monorepo's workspace root from one of its packages.
+func WalkUp(dir string, fn func(dir string) bool) {
+	for d := absPath(dir); ; {
+		if fn(d) || fileExists(filepath.Join(d, ".git")) {
+			return
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return
 		}
+		d = parent
 	}
+}
 
-	lockfileCmds := map[string][]string{
-		"bun.lock":          {"bunx"},
-		"bun.lockb":         {"bunx"},
-		"pnpm-lock.yaml":    {"pnpm", "exec"},
-		"yarn.lock":         {"yarn"},
-		"package-lock.json": {"npx"},
+// absPath makes a path absolute, treating "" as the current directory
+func absPath(dir string) string {
+	if abs, err := filepath.Abs(dir); err == nil {
+		return abs
 	}
+	return dir
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func commandExists(cmd string) bool {
+	_, err := exec.LookPath(cmd)
+	return err == nil
+}
+
+// tsRunners maps a package manager to the command running a package binary
+var tsRunners = map[string][]string{
+	"bun":  {"bunx"},
+	"pnpm": {"pnpm", "exec"},
+	"yarn": {"yarn"},
+	"npm":  {"npx"},
+}
+
+// tsLockfiles maps lockfiles to package managers, in order of preference
+var tsLockfiles = []struct{ name, pm string }{
+	{"bun.lock", "bun"},
+	{"bun.lockb", "bun"},
+	{"pnpm-lock.yaml", "pnpm"},
+	{"yarn.lock", "yarn"},
+	{"package-lock.json", "npm"},
+}
 
-	for lf, cmd := range lockfileCmds {
-		if _, err := os.Stat(filepath.Join(".", lf)); err == nil {
-			if checkCmd(cmd[0]) {
-				return cmd[0], cmd[1:], nil
+// detectTSRunner picks the package runner from the "packageManager" field or
+// the lockfile nearest to dir, walking up to the workspace root
+func detectTSRunner(dir string) (string, []string, error) {
+	var runner []string
+	WalkUp(dir, func(d string) bool {
+		if content, err := os.ReadFile(filepath.Join(d, "package.json")); err == nil {
+			pm := detectPackageManager(string(content))
+			if pm != "" && commandExists(pm) {
+				runner = tsRunners[pm]
+				return true
+			}
+		}
+		for _, lf := range tsLockfiles {
+			if fileExists(filepath.Join(d, lf.name)) && commandExists(tsRunners[lf.pm][0]) {
+				runner = tsRunners[lf.pm]
+				return true
 			}
 		}
+		return false
+	})
+	if runner != nil {
+		return runner[0], runner[1:], nil
 	}
 
 	for _, cmd := range []string{"bunx", "pnpm", "yarn", "npx"} {
-		if checkCmd(cmd) {
+		if commandExists(cmd) {
 			if cmd == "pnpm" {
 				return cmd, []string{"exec"}, nil
 			}
@@ -211,34 +325,107 @@ func detectPackageManager(content string) string {
 	return ""
 }
 
-func detectPythonRunner() (string, []string, error) {
-	checkCmd := func(cmd string) bool {
-		_, err := exec.LookPath(cmd)
-		return err == nil
+// tsAdapterVersion finds the adapter binary in node_modules/.bin, in dir or a
+// parent directory, and returns the "name@version" of the package it links to
+func tsAdapterVersion(dir, binName string) string {
+	dir = absPath(dir)
+	for {
+		target, err := filepath.EvalSymlinks(filepath.Join(dir, "node_modules", ".bin", binName))
+		if err == nil {
+			return packageVersion(filepath.Dir(target))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
 	}
+}
 
-	lockfileCmds := map[string][]string{
-		"uv.lock":     {"uv", "run"},
-		"poetry.lock": {"poetry", "run"},
-		"Pipfile":     {"pipenv", "run"},
+// tsPackageBin returns the script a package.json in dir declares for binName,
+// or its only bin
+func tsPackageBin(dir, binName string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return "", fmt.Errorf("not an adapter package: %w", err)
+	}
+	var pkg struct {
+		Bin json.RawMessage `json:"bin"`
+	}
+	if err := json.Unmarshal(content, &pkg); err != nil {
+		return "", fmt.Errorf("invalid package.json in %s: %w", dir, err)
 	}
 
-	for lf, cmd := range lockfileCmds {
-		if _, err := os.Stat(filepath.Join(".", lf)); err == nil {
-			if checkCmd(cmd[0]) {
-				return cmd[0], cmd[1:], nil
-			}
+	var single string
+	var bins map[string]string
+	switch {
+	case json.Unmarshal(pkg.Bin, &single) == nil && single != "":
+		return filepath.Join(dir, single), nil
+	case json.Unmarshal(pkg.Bin, &bins) == nil && bins[binName] != "":
+		return filepath.Join(dir, bins[binName]), nil
+	case len(bins) == 1:
+		for _, script := range bins {
+			return filepath.Join(dir, script), nil
 		}
 	}
+	return "", fmt.Errorf("package.json in %s has no %q bin", dir, binName)
+}
 
-	if _, err := os.Stat(filepath.Join(".", "pyproject.toml")); err == nil {
-		content, err := os.ReadFile(filepath.Join(".", "pyproject.toml"))
+// packageVersion returns "name@version" from the nearest package.json at or
+// above dir that has both
+func packageVersion(dir string) string {
+	for {
+		content, err := os.ReadFile(filepath.Join(dir, "package.json"))
 		if err == nil {
+			var pkg struct {
+				Name    string `json:"name"`
+				Version string `json:"version"`
+			}
+			if json.Unmarshal(content, &pkg) == nil && pkg.Name != "" && pkg.Version != "" {
+				return pkg.Name + "@" + pkg.Version
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || filepath.Base(dir) == "node_modules" {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// pyLockfiles maps lockfiles to the command running a package binary, in
+// order of preference
+var pyLockfiles = []struct {
+	name string
+	cmd  []string
+}{
+	{"uv.lock", []string{"uv", "run"}},
+	{"poetry.lock", []string{"poetry", "run"}},
+	{"Pipfile", []string{"pipenv", "run"}},
+}
+
+// detectPythonRunner picks the runner from the lockfile or pyproject.toml
+// build system nearest to dir, walking up to the workspace root
+func detectPythonRunner(dir string) (string, []string, error) {
+	var runner []string
+	WalkUp(dir, func(d string) bool {
+		for _, lf := range pyLockfiles {
+			if fileExists(filepath.Join(d, lf.name)) && commandExists(lf.cmd[0]) {
+				runner = lf.cmd
+				return true
+			}
+		}
+		if content, err := os.ReadFile(filepath.Join(d, "pyproject.toml")); err == nil {
 			buildSystem := detectBuildSystem(string(content))
-			if buildSystem != "" && checkCmd(buildSystem) {
-				return buildSystem, []string{"run"}, nil
+			if buildSystem != "" && commandExists(buildSystem) {
+				runner = []string{buildSystem, "run"}
+				return true
 			}
 		}
+		return false
+	})
+	if runner != nil {
+		return runner[0], runner[1:], nil
 	}
 
 	return "python", []string{"-m"}, nil
@@ -264,6 +451,50 @@ func detectBuildSystem(content string) string {
 	return ""
 }
 
+// detectGoRunner runs adapters as tools of the module, which pins their
+// versions in go.mod: "go tool xschema-<adapter>"
+func detectGoRunner(string) (string, []string, error) {
+	return "go", []string{"tool"}, nil
+}
+
+// goInitialisms are written in capitals in Go names, e.g. "user_id" -> "UserID"
+var goInitialisms = map[string]bool{
+	"api": true, "css": true, "dns": true, "html": true, "http": true, "https": true, "id": true,
+	"ip": true, "json": true, "sql": true, "uri": true, "url": true, "uuid": true, "xml": true,
+}
+
+// GoName builds an exported Go identifier from parts: each word is
+// capitalized and anything but letters and digits is dropped,
+// e.g. ("user", "profile_url") -> "UserProfileURL"
+func GoName(parts ...string) string {
+	var b strings.Builder
+	for _, part := range parts {
+		for _, word := range words(part) {
+			if goInitialisms[strings.ToLower(word)] {
+				b.WriteString(strings.ToUpper(word))
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(word)
+			b.WriteRune(unicode.ToUpper(r))
+			b.WriteString(word[size:])
+		}
+	}
+	name := b.String()
+	if name == "" {
+		return "X"
+	}
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		// Digits and uncased letters cannot start an exported name
+		name = "X" + name
+	}
+	return name
+}
+
+// buildGoVarName builds the exported type name of a schema: "user", "Test" -> "UserTest"
+func buildGoVarName(namespace, id string) string {
+	return GoName(namespace, id)
+}
+
 // buildTSSchemasImport builds TypeScript import for schemas
 func buildTSSchemasImport(importPath string) string {
 	return `import { schemas } from "` + importPath + `";`
@@ -277,9 +508,112 @@ func buildPySchemasImport(importPath string) string {
 	return "from " + module + " import schemas"
 }
 
-// buildVarNameUnderscore builds a variable name using underscore separator: namespace_id
-func buildVarNameUnderscore(namespace, id string) string {
-	return namespace + "_" + id
+// tsReserved are the words TypeScript modules cannot declare as a variable
+var tsReserved = wordSet(`arguments await break case catch class const continue debugger
+	default delete do else enum eval export extends false finally for function if implements
+	import in instanceof interface let new null package private protected public return static
+	super switch this throw true try typeof var void while with yield`)
+
+// pyReserved are Python's keywords
+var pyReserved = wordSet(`False None True and as assert async await break class continue
+	def del elif else except finally for from global if import in is lambda nonlocal not or
+	pass raise return try while with yield`)
+
+// wordSet builds a set from whitespace-separated words
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// Identifier makes name a valid identifier: anything but letters, digits,
+// "_" and the extra runes becomes "_", a leading digit gets a "_" prefix and
+// a reserved word a "_" suffix, e.g. "my-api_User" -> "my_api_User"
+func Identifier(name string, extra string, reserved map[string]bool) string {
+	id := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(extra, r) {
+			return r
+		}
+		return '_'
+	}, name)
+	if r, _ := utf8.DecodeRuneInString(id); id == "" || unicode.IsDigit(r) {
+		id = "_" + id
+	}
+	if reserved[id] {
+		id += "_"
+	}
+	return id
+}
+
+// buildTSVarName builds a TypeScript variable name: "my-api", "User" -> "my_api_User"
+func buildTSVarName(namespace, id string) string {
+	return Identifier(namespace+"_"+id, "$", tsReserved)
+}
+
+// buildPyVarName builds a Python variable name: "my-api", "User" -> "my_api_User"
+func buildPyVarName(namespace, id string) string {
+	return Identifier(namespace+"_"+id, "", pyReserved)
+}
+
+// AssignVarNames sets the VarName of every schema of a language, making
+// them distinct: when BuildVarName gives several schemas one name, the first
+// of them by key keeps it, preferring a schema whose name needed no
+// sanitizing, and the others get a "_2", "_3", ... suffix. Keys are never
+// changed. It returns a note for each renamed schema.
+func (l *Language) AssignVarNames(schemas []SchemaEntry) []string {
+	build := l.BuildVarName
+	if build == nil {
+		build = func(namespace, id string) string { return namespace + "_" + id }
+	}
+
+	// Decide who keeps a contested name before handing out suffixes, so a
+	// suffixed name never takes another schema's own name
+	order := make([]int, len(schemas))
+	taken := make(map[string]bool, len(schemas))
+	for i := range schemas {
+		order[i] = i
+		schemas[i].VarName = build(schemas[i].Namespace, schemas[i].ID)
+		taken[schemas[i].VarName] = true
+	}
+	sanitized := func(s SchemaEntry) bool { return s.VarName != s.Namespace+"_"+s.ID }
+	slices.SortStableFunc(order, func(a, b int) int {
+		sa, sb := schemas[a], schemas[b]
+		if sanitized(sa) != sanitized(sb) {
+			if sanitized(sa) {
+				return 1
+			}
+			return -1
+		}
+		return strings.Compare(sa.Key(), sb.Key())
+	})
+
+	var notes []string
+	kept := make(map[string]string, len(schemas)) // name -> key of the schema keeping it
+	for _, i := range order {
+		name := schemas[i].VarName
+		owner, contested := kept[name]
+		if !contested {
+			kept[name] = schemas[i].Key()
+			continue
+		}
+		unique := name
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		taken[unique] = true
+		kept[unique] = schemas[i].Key()
+		schemas[i].VarName = unique
+		notes = append(notes, fmt.Sprintf("%s and %s are both named %s in %s code, so %s is named %s", owner, schemas[i].Key(), name, l.Name, schemas[i].Key(), unique))
+	}
+	return notes
+}
+
+// pyNamespaceFile names a namespace's submodule so it can be imported:
+// "my-api" -> "my_api.py", "2fa" -> "_2fa.py", "class" -> "class_.py"
+func pyNamespaceFile(namespace string) string {
+	return Identifier(namespace, "", pyReserved) + ".py"
 }
 
 // injectSchemasKeyBrace injects "schemas" into a brace-delimited config (JS/TS/Python dict)
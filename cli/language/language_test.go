@@ -0,0 +1,201 @@
+package language
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// writeFiles creates empty files (or directories, for names ending in "/") under dir
+func writeFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPackageRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo")
+	writeFiles(t, dir, "package.json", "repo/apps/web/package.json", "repo/apps/web/config/", "repo/libs/shared/")
+	ts := ByName("typescript")
+
+	tests := []struct {
+		name string
+		dir  string
+		want string
+	}{
+		{"config next to its manifest", filepath.Join(root, "apps", "web"), filepath.Join(root, "apps", "web")},
+		{"config below its manifest", filepath.Join(root, "apps", "web", "config"), filepath.Join(root, "apps", "web")},
+		{"no manifest inside the project", filepath.Join(root, "libs", "shared"), root},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ts.PackageRoot(tt.dir, root); got != tt.want {
+				t.Errorf("PackageRoot(%s) = %s, want %s", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectRunnerWorkspaceRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake package managers are shell scripts")
+	}
+	bin := t.TempDir()
+	for _, name := range []string{"pnpm", "bunx", "yarn", "uv"} {
+		if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin)
+
+	dir := t.TempDir()
+	root := filepath.Join(dir, "repo")
+	// A lockfile above the repository must not be picked up
+	writeFiles(t, dir, "yarn.lock", "repo/.git/", "repo/pnpm-lock.yaml", "repo/apps/web/package.json", "repo/uv.lock", "repo/services/api/pyproject.toml")
+
+	cmd, args, err := detectTSRunner(filepath.Join(root, "apps", "web"))
+	if err != nil || cmd != "pnpm" || len(args) != 1 || args[0] != "exec" {
+		t.Errorf("expected the workspace root's pnpm, got %s %v, %v", cmd, args, err)
+	}
+	cmd, args, err = detectPythonRunner(filepath.Join(root, "services", "api"))
+	if err != nil || cmd != "uv" || len(args) != 1 || args[0] != "run" {
+		t.Errorf("expected the workspace root's uv, got %s %v, %v", cmd, args, err)
+	}
+
+	// Without a lockfile in the repository, the first runner on PATH is used
+	if err := os.Remove(filepath.Join(root, "pnpm-lock.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if cmd, _, _ := detectTSRunner(filepath.Join(root, "apps", "web")); cmd != "bunx" {
+		t.Errorf("expected the fallback runner, got %s", cmd)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := []struct {
+		parts []string
+		want  string
+	}{
+		{[]string{"user", "Profile"}, "UserProfile"},
+		{[]string{"user", "profile_url"}, "UserProfileURL"},
+		{[]string{"api-v2", "user.id"}, "APIV2UserID"},
+		{[]string{"2fa"}, "X2fa"},
+		{[]string{"--"}, "X"},
+	}
+	for _, tt := range tests {
+		if got := GoName(tt.parts...); got != tt.want {
+			t.Errorf("GoName(%q) = %q, want %q", tt.parts, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{`{{pascal "user_profile-url"}}`, "UserProfileUrl"},
+		{`{{camel "user_profile-url"}}`, "userProfileUrl"},
+		{`{{camel "--"}}`, ""},
+		{`{{quote "a \"b\" <c>"}}`, `"a \"b\" <c>"`},
+		{`{{json .}}`, `{"k":["a&b",1]}`},
+	}
+	data := map[string]any{"k": []any{"a&b", 1}}
+	for _, tt := range tests {
+		tmpl := template.Must(template.New("").Funcs(TemplateFuncs).Parse(tt.text))
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			t.Fatalf("%s: %v", tt.text, err)
+		}
+		if b.String() != tt.want {
+			t.Errorf("%s = %s, want %s", tt.text, b.String(), tt.want)
+		}
+	}
+}
+
+func TestBuildVarName(t *testing.T) {
+	tests := []struct {
+		lang          string
+		namespace, id string
+		want          string
+	}{
+		{"typescript", "user", "User", "user_User"},
+		{"typescript", "my-api", "User", "my_api_User"},
+		{"typescript", "api", "$ref", "api_$ref"},
+		{"typescript", "v1.2", "Ünïcode", "v1_2_Ünïcode"},
+		{"typescript", "2fa", "Code", "_2fa_Code"},
+		{"python", "my-api", "User", "my_api_User"},
+		{"python", "api", "$ref", "api__ref"},
+		{"go", "my-api", "User", "MyAPIUser"},
+	}
+	for _, tt := range tests {
+		if got := ByName(tt.lang).BuildVarName(tt.namespace, tt.id); got != tt.want {
+			t.Errorf("%s: BuildVarName(%q, %q) = %q, want %q", tt.lang, tt.namespace, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"class", "class_"},
+		{"None", "None_"},
+		{"none", "none"},
+		{"", "_"},
+		{"9lives", "_9lives"},
+		{"a b-c", "a_b_c"},
+	}
+	for _, tt := range tests {
+		if got := Identifier(tt.name, "", pyReserved); got != tt.want {
+			t.Errorf("Identifier(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	if got := pyNamespaceFile("class"); got != "class_.py" {
+		t.Errorf("pyNamespaceFile(class) = %q, want class_.py", got)
+	}
+}
+
+func TestAssignVarNames(t *testing.T) {
+	schemas := []SchemaEntry{
+		{Namespace: "a-b", ID: "c"},
+		{Namespace: "a_b", ID: "c"},
+		{Namespace: "a", ID: "b-c"},
+		{Namespace: "a", ID: "b_c_2"}, // already holds the first suffix
+		{Namespace: "user", ID: "User"},
+	}
+	notes := ByName("typescript").AssignVarNames(schemas)
+
+	want := map[string]string{
+		"a-b:c":     "a_b_c_3",
+		"a_b:c":     "a_b_c", // needed no sanitizing, so it keeps the name
+		"a:b-c":     "a_b_c_4",
+		"a:b_c_2":   "a_b_c_2",
+		"user:User": "user_User",
+	}
+	for _, s := range schemas {
+		if s.VarName != want[s.Key()] {
+			t.Errorf("%s is named %s, want %s", s.Key(), s.VarName, want[s.Key()])
+		}
+	}
+	if len(notes) != 2 || !strings.Contains(notes[0], "a_b:c and a-b:c are both named a_b_c") {
+		t.Errorf("unexpected notes: %q", notes)
+	}
+}
@@ -1,13 +1,23 @@
 package language
 
+// The templates name their sections with {{block}}, so a project template can
+// redefine one, e.g. {{define "header"}}, and keep the rest. Blocks by language:
+//
+//	typescript: header, schema, registry, augmentation (index: index)
+//	python:     header, schema, registry, client (index: index)
+//	go:         header, schema, registry
+//
+// "schema" is executed once per schema with the SchemaEntry as its data; the
+// others get the whole template data.
+
 // TypeScript template - exports schemas with namespace:id keys
-const TSTemplate = `// Generated by xschema - DO NOT EDIT
+const TSTemplate = `{{block "header" .}}// Generated by xschema - DO NOT EDIT
 // https://xschema.dev/docs
 {{- if .Header}}
 {{.Header}}
-{{- end}}
+{{- end}}{{end}}
 {{.Imports}}
-{{range .Schemas}}
+{{range .Schemas}}{{block "schema" .}}
 {{- if and .Type (not .Code)}}
 export type {{.VarName}} = {{.Type}};
 {{- else if and .Code (not .Type)}}
@@ -15,9 +25,9 @@ const {{.VarName}} = {{.Code}};
 {{- else if and .Code .Type}}
 const {{.VarName}} = {{.Code}};
 type {{.VarName}}Type = {{.Type}};
-{{- end}}
+{{- end}}{{end}}
 {{end}}
-export const schemas = {
+{{block "registry" .}}export const schemas = {
 {{- range .Schemas}}
   "{{.Key}}": {{.VarName}},
 {{- end}}
@@ -33,42 +43,217 @@ export type SchemaTypes = {
   "{{.Key}}": typeof {{.VarName}};
 {{- end}}
 {{- end}}
-};
+};{{end}}
 
-declare module '@xschema/client' {
+{{block "augmentation" .}}declare module '@xschema/client' {
   interface Register {
     schemas: typeof schemas;
     schemaTypes: SchemaTypes;
   }
-}
+}{{end}}
 {{- if .Footer}}
 {{.Footer}}
 {{- end}}
 `
 
 // Python template - generates schemas with namespace:id keys
-const PyTemplate = `# Generated by xschema - DO NOT EDIT
+const PyTemplate = `{{block "header" .}}# Generated by xschema - DO NOT EDIT
 # https://xschema.dev/docs
 # pyright: reportOverlappingOverload=false
 {{- if .Header}}
 {{.Header}}
-{{- end}}
+{{- end}}{{end}}
 from typing import Literal, overload
 {{.Imports}}
 from xschema import XSchemaBase, XSchemaAdapter
-{{range .Schemas}}
-{{.Code}}
+{{range .Schemas}}{{block "schema" .}}
+{{.Code}}{{end}}
 {{end}}
-_schemas: dict[str, type] = {
+{{block "registry" .}}_schemas: dict[str, type] = {
 {{- range .Schemas}}
   "{{.Key}}": {{.VarName}},
 {{- end}}
+}{{end}}
+
+{{block "client" .}}class xschema(XSchemaBase):
+{{- range .Schemas}}
+    {{.VarName}} = {{.VarName}}
+{{- end}}
+
+{{.Footer}}{{end}}
+`
+
+// Go template - declares the schema types and a registry keyed by namespace:id
+// The header is the package clause; the output is gofmt'd after rendering.
+const GoTemplate = `{{block "header" .}}// Code generated by xschema. DO NOT EDIT.
+// https://xschema.dev/docs
+
+{{.Header}}{{end}}
+{{- if .Imports}}
+
+{{.Imports}}
+{{- end}}
+{{range .Schemas}}{{block "schema" .}}
+{{.Code}}{{end}}
+{{end}}
+{{block "registry" .}}// Validator is implemented by every generated schema type
+type Validator interface {
+	Validate() error
 }
 
-class xschema(XSchemaBase):
+// Schemas creates an empty value of a schema's type, to decode into and
+// validate, by its "namespace:id" key
+var Schemas = map[string]func() Validator{
+{{- range .Schemas}}
+	"{{.Key}}": func() Validator { return new({{.Type}}) },
+{{- end}}
+}{{end}}
+{{- if .Footer}}
+{{.Footer}}
+{{- end}}
+`
+
+// TypeScript namespace module - one namespace's schemas, re-exported by TSIndexTemplate
+const TSNamespaceTemplate = `{{block "header" .}}// Generated by xschema - DO NOT EDIT
+// https://xschema.dev/docs
+{{- if .Header}}
+{{.Header}}
+{{- end}}{{end}}
+{{.Imports}}
+{{range .Schemas}}{{block "schema" .}}
+{{- if and .Type (not .Code)}}
+export type {{.VarName}} = {{.Type}};
+{{- else if and .Code (not .Type)}}
+export const {{.VarName}} = {{.Code}};
+{{- else if and .Code .Type}}
+export const {{.VarName}} = {{.Code}};
+export type {{.VarName}}Type = {{.Type}};
+{{- end}}{{end}}
+{{end}}
+{{block "registry" .}}export const schemas = {
+{{- range .Schemas}}
+  "{{.Key}}": {{.VarName}},
+{{- end}}
+} as const;
+
+export type SchemaTypes = {
+{{- range .Schemas}}
+{{- if and .Code .Type}}
+  "{{.Key}}": {{.VarName}}Type;
+{{- else if .Type}}
+  "{{.Key}}": {{.VarName}};
+{{- else if .Code}}
+  "{{.Key}}": typeof {{.VarName}};
+{{- end}}
+{{- end}}
+};{{end}}
+`
+
+// TypeScript index - merges the namespace modules and registers them with the client
+const TSIndexTemplate = `{{block "header" .}}// Generated by xschema - DO NOT EDIT
+// https://xschema.dev/docs
+{{- if .Header}}
+{{.Header}}
+{{- end}}{{end}}
+{{- range $i, $ns := .Namespaces}}
+import { schemas as schemas{{$i}}, type SchemaTypes as SchemaTypes{{$i}} } from "./{{$ns.Module}}";
+{{- end}}
+
+{{block "index" .}}export const schemas = {
+{{- range $i, $ns := .Namespaces}}
+  ...schemas{{$i}},
+{{- end}}
+} as const;
+
+export type SchemaTypes = {{range $i, $ns := .Namespaces}}{{if $i}} & {{end}}SchemaTypes{{$i}}{{else}}{}{{end}};{{end}}
+
+{{block "augmentation" .}}declare module '@xschema/client' {
+  interface Register {
+    schemas: typeof schemas;
+    schemaTypes: SchemaTypes;
+  }
+}{{end}}
+{{- if .Footer}}
+{{.Footer}}
+{{- end}}
+`
+
+// Python namespace submodule - one namespace's schemas, imported by PyIndexTemplate
+const PyNamespaceTemplate = `{{block "header" .}}# Generated by xschema - DO NOT EDIT
+# https://xschema.dev/docs
+{{- if .Header}}
+{{.Header}}
+{{- end}}{{end}}
+{{.Imports}}
+{{range .Schemas}}{{block "schema" .}}
+{{.Code}}{{end}}
+{{end}}
+{{block "registry" .}}_schemas: dict[str, type] = {
+{{- range .Schemas}}
+  "{{.Key}}": {{.VarName}},
+{{- end}}
+}{{end}}
+`
+
+// Python package __init__ - imports every namespace submodule
+const PyIndexTemplate = `{{block "header" .}}# Generated by xschema - DO NOT EDIT
+# https://xschema.dev/docs
+# pyright: reportOverlappingOverload=false
+{{- if .Header}}
+{{.Header}}
+{{- end}}{{end}}
+from typing import Literal, overload
+from xschema import XSchemaBase, XSchemaAdapter
+{{- range $i, $ns := .Namespaces}}
+from .{{$ns.Module}} import _schemas as _schemas{{$i}}{{range $ns.Schemas}}, {{.VarName}}{{end}}
+{{- end}}
+
+{{block "index" .}}_schemas: dict[str, type] = {
+{{- range $i, $ns := .Namespaces}}
+  **_schemas{{$i}},
+{{- end}}
+}{{end}}
+
+{{block "client" .}}class xschema(XSchemaBase):
 {{- range .Schemas}}
     {{.VarName}} = {{.VarName}}
 {{- end}}
 
+{{.Footer}}{{end}}
+`
+
+// Go namespace file - one namespace's types, in the same package as GoIndexTemplate
+const GoNamespaceTemplate = `{{block "header" .}}// Code generated by xschema. DO NOT EDIT.
+// https://xschema.dev/docs
+
+{{.Header}}{{end}}
+{{- if .Imports}}
+
+{{.Imports}}
+{{- end}}
+{{range .Schemas}}{{block "schema" .}}
+{{.Code}}{{end}}
+{{end}}`
+
+// Go index file - the registry of every namespace's types
+const GoIndexTemplate = `{{block "header" .}}// Code generated by xschema. DO NOT EDIT.
+// https://xschema.dev/docs
+
+{{.Header}}{{end}}
+
+{{block "registry" .}}// Validator is implemented by every generated schema type
+type Validator interface {
+	Validate() error
+}
+
+// Schemas creates an empty value of a schema's type, to decode into and
+// validate, by its "namespace:id" key
+var Schemas = map[string]func() Validator{
+{{- range .Schemas}}
+	"{{.Key}}": func() Validator { return new({{.Type}}) },
+{{- end}}
+}{{end}}
+{{- if .Footer}}
 {{.Footer}}
+{{- end}}
 `
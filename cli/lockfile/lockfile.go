@@ -0,0 +1,206 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/xschemadev/xschema/cache"
+	"github.com/xschemadev/xschema/internal/atomicfile"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/retriever"
+	"github.com/xschemadev/xschema/ui"
+)
+
+const (
+	// FileName is the lockfile name, stored at the project root
+	FileName = "xschema.lock"
+	// Version is the current lockfile format version
+	// Version 1 keyed entries by "namespace:id"; Reconcile moves them to
+	// qualified keys.
+	Version = 2
+)
+
+// Entry pins the content of one URL-sourced declaration
+type Entry struct {
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	FetchedAt time.Time `json:"fetchedAt"`
+}
+
+// Lockfile maps qualified declaration keys ("language/namespace:id") to pinned entries
+type Lockfile struct {
+	Version int              `json:"version"`
+	Schemas map[string]Entry `json:"schemas"`
+}
+
+// New returns an empty lockfile
+func New() *Lockfile {
+	return &Lockfile{Version: Version, Schemas: make(map[string]Entry)}
+}
+
+// Load reads a lockfile, returning an empty one if it does not exist
+func Load(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		ui.Verbosef("no lockfile found: %s", path)
+		return New(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile %s: %w", path, err)
+	}
+	if lock.Version > Version {
+		return nil, fmt.Errorf("lockfile %s has version %d, this xschema supports up to %d", path, lock.Version, Version)
+	}
+	if lock.Schemas == nil {
+		lock.Schemas = make(map[string]Entry)
+	}
+	lock.Version = Version
+
+	ui.Verbosef("loaded lockfile: path=%s, entries=%d", path, len(lock.Schemas))
+	return &lock, nil
+}
+
+// Save writes the lockfile with sorted keys and a trailing newline
+func (l *Lockfile) Save(path string) error {
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lockfile: %w", err)
+	}
+	data = append(data, '\n')
+	if err := atomicfile.WriteFile(path, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	ui.Verbosef("wrote lockfile: path=%s, entries=%d", path, len(l.Schemas))
+	return nil
+}
+
+// Drift describes a URL schema whose fetched content no longer matches the lock
+type Drift struct {
+	Key     string
+	URL     string
+	Locked  string // sha256 recorded in the lock
+	Fetched string // sha256 of the content just fetched
+}
+
+func (d Drift) String() string {
+	return fmt.Sprintf("%s (%s): locked sha256:%s, fetched sha256:%s", d.Key, d.URL, short(d.Locked), short(d.Fetched))
+}
+
+func short(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// Result reports how Reconcile changed the lockfile
+type Result struct {
+	Drift   []Drift  // drifted entries left untouched
+	Added   []string // keys pinned for the first time (or whose URL changed)
+	Updated []string // drifted keys re-pinned to the fetched content
+	Removed []string // keys no longer declared as URL sources
+	Moved   []string // keys whose entry was carried over from a version 1 "namespace:id" key
+}
+
+// Changed reports whether the lockfile was modified
+func (r Result) Changed() bool {
+	return len(r.Added) > 0 || len(r.Updated) > 0 || len(r.Removed) > 0 || len(r.Moved) > 0
+}
+
+// Reconcile compares fetched URL schemas against the lock.
+// New declarations are pinned, removed ones dropped, and a drifted entry is
+// re-pinned only if update(key) returns true; otherwise it is reported as drift.
+// Declarations with no fetched schema (e.g. not selected for refresh) keep their entry.
+// When lang is set, decls are that language's only, so other languages'
+// entries are kept too.
+func (l *Lockfile) Reconcile(decls []parser.Declaration, schemas []retriever.RetrievedSchema, lang string, update func(key string) bool, now time.Time) Result {
+	var result Result
+
+	fetched := make(map[string]retriever.RetrievedSchema, len(schemas))
+	for _, s := range schemas {
+		fetched[s.QualifiedKey()] = s
+	}
+
+	declared := make(map[string]bool)
+	moved := make(map[string]bool) // version 1 keys carried over
+	for _, d := range decls {
+		if d.SourceType != parser.SourceURL {
+			continue
+		}
+		key := d.QualifiedKey()
+		declared[key] = true
+		if l.move(d) {
+			moved[d.Key()] = true
+			result.Moved = append(result.Moved, key)
+		}
+
+		var url string
+		if err := json.Unmarshal(d.Source, &url); err != nil {
+			continue
+		}
+		schema, ok := fetched[key]
+		if !ok {
+			continue
+		}
+		// Pin the document as served, not the bundle built from it
+		digest := cache.Digest(schema.Raw)
+
+		entry, locked := l.Schemas[key]
+		switch {
+		case !locked || entry.URL != url:
+			// Editing the URL in the config is an intentional change, not drift
+			l.Schemas[key] = Entry{URL: url, SHA256: digest, FetchedAt: now}
+			result.Added = append(result.Added, key)
+		case entry.SHA256 == digest:
+			// Pinned and unchanged
+		case update != nil && update(key):
+			l.Schemas[key] = Entry{URL: url, SHA256: digest, FetchedAt: now}
+			result.Updated = append(result.Updated, key)
+		default:
+			result.Drift = append(result.Drift, Drift{Key: key, URL: url, Locked: entry.SHA256, Fetched: digest})
+		}
+	}
+
+	for key := range l.Schemas {
+		if declared[key] || (lang != "" && !strings.HasPrefix(key, lang+"/")) {
+			continue
+		}
+		delete(l.Schemas, key)
+		if !moved[key] {
+			result.Removed = append(result.Removed, key)
+		}
+	}
+
+	slices.Sort(result.Added)
+	slices.Sort(result.Updated)
+	slices.Sort(result.Removed)
+	slices.Sort(result.Moved)
+	slices.SortFunc(result.Drift, func(a, b Drift) int { return strings.Compare(a.Key, b.Key) })
+	return result
+}
+
+// move carries a version 1 entry, keyed "namespace:id", over to the qualified
+// key of a declaration, so upgrading keeps every pin. The old key stays until
+// the removal pass, since the same key may be declared in several languages.
+func (l *Lockfile) move(d parser.Declaration) bool {
+	key := d.QualifiedKey()
+	if _, ok := l.Schemas[key]; ok {
+		return false
+	}
+	entry, ok := l.Schemas[d.Key()]
+	if ok {
+		l.Schemas[key] = entry
+	}
+	return ok
+}
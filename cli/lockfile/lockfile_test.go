@@ -0,0 +1,191 @@
+package lockfile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xschemadev/xschema/cache"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/retriever"
+)
+
+func urlDecl(ns, id, url string) parser.Declaration {
+	return parser.Declaration{Namespace: ns, ID: id, SourceType: parser.SourceURL, Source: json.RawMessage(`"` + url + `"`), Adapter: "zod", Language: "typescript"}
+}
+
+func fetched(ns, id, body string) retriever.RetrievedSchema {
+	return retriever.RetrievedSchema{Namespace: ns, ID: id, Schema: json.RawMessage(body), Raw: json.RawMessage(body), Adapter: "zod", Language: "typescript"}
+}
+
+func TestLoadMissing(t *testing.T) {
+	lock, err := Load(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if lock.Version != Version || len(lock.Schemas) != 0 {
+		t.Errorf("expected empty lockfile, got %+v", lock)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	lock := New()
+	lock.Schemas["typescript/user:User"] = Entry{URL: "https://example.com/user.json", SHA256: "abc", FetchedAt: now}
+	lock.Schemas["typescript/api:Post"] = Entry{URL: "https://example.com/post.json", SHA256: "def", FetchedAt: now}
+	if err := lock.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read lockfile: %v", err)
+	}
+	// Keys are sorted so the file diffs cleanly
+	if strings.Index(string(content), "typescript/api:Post") > strings.Index(string(content), "typescript/user:User") {
+		t.Error("expected lockfile keys to be sorted")
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Schemas["typescript/user:User"] != lock.Schemas["typescript/user:User"] {
+		t.Errorf("round-trip mismatch: %+v", loaded.Schemas["typescript/user:User"])
+	}
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	os.WriteFile(path, []byte(`{"version": 99, "schemas": {}}`), 0644)
+
+	if _, err := Load(path); err == nil {
+		t.Error("expected error for unsupported lockfile version")
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	now := time.Now()
+	decls := []parser.Declaration{
+		urlDecl("user", "User", "https://example.com/user.json"),
+		urlDecl("user", "Post", "https://example.com/post.json"),
+		{Namespace: "user", ID: "Inline", SourceType: parser.SourceJSON, Source: json.RawMessage(`{}`), Adapter: "zod", Language: "typescript"},
+	}
+	schemas := []retriever.RetrievedSchema{
+		fetched("user", "User", `{"type": "object"}`),
+		fetched("user", "Post", `{"type": "string"}`),
+		fetched("user", "Inline", `{}`),
+	}
+
+	// First run pins every URL schema, but not inline ones
+	lock := New()
+	res := lock.Reconcile(decls, schemas, "", nil, now)
+	if len(res.Added) != 2 || len(res.Drift) != 0 || !res.Changed() {
+		t.Fatalf("unexpected first result: %+v", res)
+	}
+	if lock.Schemas["typescript/user:User"].SHA256 != cache.Digest([]byte(`{"type": "object"}`)) {
+		t.Errorf("unexpected digest: %+v", lock.Schemas["typescript/user:User"])
+	}
+	if _, ok := lock.Schemas["typescript/user:Inline"]; ok {
+		t.Error("inline schemas should not be locked")
+	}
+
+	// Unchanged content is a no-op
+	res = lock.Reconcile(decls, schemas, "", nil, now)
+	if res.Changed() || len(res.Drift) != 0 {
+		t.Errorf("expected no changes, got %+v", res)
+	}
+
+	// Upstream change is drift unless update allows it
+	schemas[0] = fetched("user", "User", `{"type": "object", "required": ["id"]}`)
+	res = lock.Reconcile(decls, schemas, "", nil, now)
+	if len(res.Drift) != 1 || res.Drift[0].Key != "typescript/user:User" || res.Changed() {
+		t.Fatalf("expected drift for user:User, got %+v", res)
+	}
+	if !strings.Contains(res.Drift[0].String(), "typescript/user:User") {
+		t.Errorf("drift string should name the key: %s", res.Drift[0])
+	}
+
+	res = lock.Reconcile(decls, schemas, "", func(key string) bool { return key == "typescript/user:User" }, now)
+	if len(res.Updated) != 1 || len(res.Drift) != 0 {
+		t.Fatalf("expected user:User to be updated, got %+v", res)
+	}
+
+	// Changing the URL in config re-pins without reporting drift
+	decls[1] = urlDecl("user", "Post", "https://example.com/v2/post.json")
+	schemas[1] = fetched("user", "Post", `{"type": "number"}`)
+	res = lock.Reconcile(decls, schemas, "", nil, now)
+	if len(res.Added) != 1 || len(res.Drift) != 0 {
+		t.Errorf("expected URL change to re-pin, got %+v", res)
+	}
+
+	// Removed declarations are dropped
+	res = lock.Reconcile(decls[:1], schemas[:1], "", nil, now)
+	if len(res.Removed) != 1 || res.Removed[0] != "typescript/user:Post" {
+		t.Errorf("expected user:Post to be removed, got %+v", res)
+	}
+}
+
+func TestReconcileKeepsUnfetched(t *testing.T) {
+	lock := New()
+	lock.Schemas["typescript/user:User"] = Entry{URL: "https://example.com/user.json", SHA256: "abc"}
+
+	decls := []parser.Declaration{urlDecl("user", "User", "https://example.com/user.json")}
+	res := lock.Reconcile(decls, nil, "", nil, time.Now())
+	if res.Changed() || lock.Schemas["typescript/user:User"].SHA256 != "abc" {
+		t.Errorf("expected unfetched entry to be kept, got %+v", res)
+	}
+}
+
+func TestReconcileSameKeyPerLanguage(t *testing.T) {
+	ts := urlDecl("user", "User", "https://example.com/user.json")
+	py := urlDecl("user", "User", "https://example.com/py/user.json")
+	py.Language = "python"
+	pySchema := fetched("user", "User", `{"type": "string"}`)
+	pySchema.Language = "python"
+
+	lock := New()
+	res := lock.Reconcile([]parser.Declaration{ts, py}, []retriever.RetrievedSchema{fetched("user", "User", `{}`), pySchema}, "", nil, time.Now())
+	if len(res.Added) != 2 || lock.Schemas["python/user:User"].URL != "https://example.com/py/user.json" {
+		t.Fatalf("expected one entry per language, got %+v", lock.Schemas)
+	}
+}
+
+func TestReconcileMovesVersion1Keys(t *testing.T) {
+	lock := New()
+	lock.Schemas["user:User"] = Entry{URL: "https://example.com/user.json", SHA256: "abc"}
+	lock.Schemas["user:Gone"] = Entry{URL: "https://example.com/gone.json", SHA256: "def"}
+
+	// The old pin still applies: fetching other content is drift
+	decls := []parser.Declaration{urlDecl("user", "User", "https://example.com/user.json")}
+	res := lock.Reconcile(decls, []retriever.RetrievedSchema{fetched("user", "User", `{}`)}, "", nil, time.Now())
+	if len(res.Moved) != 1 || len(res.Drift) != 1 || len(res.Added) != 0 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+	if len(res.Removed) != 1 || res.Removed[0] != "user:Gone" {
+		t.Errorf("expected only the undeclared key to be removed, got %+v", res.Removed)
+	}
+	if lock.Schemas["typescript/user:User"].SHA256 != "abc" || len(lock.Schemas) != 1 {
+		t.Errorf("unexpected entries after moving: %+v", lock.Schemas)
+	}
+}
+
+func TestReconcileKeepsOtherLanguages(t *testing.T) {
+	lock := New()
+	lock.Schemas["python/user:Post"] = Entry{URL: "https://example.com/post.json", SHA256: "abc"}
+	lock.Schemas["typescript/user:Post"] = Entry{URL: "https://example.com/post.json", SHA256: "abc"}
+
+	decls := []parser.Declaration{urlDecl("user", "User", "https://example.com/user.json")}
+	res := lock.Reconcile(decls, []retriever.RetrievedSchema{fetched("user", "User", `{}`)}, "typescript", nil, time.Now())
+	if len(res.Removed) != 1 || res.Removed[0] != "typescript/user:Post" {
+		t.Errorf("expected only the typescript entry to be removed, got %+v", res.Removed)
+	}
+	if _, ok := lock.Schemas["python/user:Post"]; !ok {
+		t.Error("python entry was dropped by a typescript-only run")
+	}
+}
@@ -0,0 +1,262 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/xschemadev/xschema/ui"
+)
+
+// Glob is an expanded glob entry, kept so a watcher can notice the files it
+// would match from now on
+type Glob struct {
+	ConfigPath string   // config file the pattern is relative to
+	Pattern    string   // slash-separated, cleaned
+	Exclude    []string // paths relative to the config
+	Dirs       []string // every directory searched for matches
+}
+
+// Match reports whether the file at path would be expanded by the entry
+func (g Glob) Match(p string) bool {
+	if p == g.ConfigPath {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Dir(g.ConfigPath), p)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	return matchGlob(g.Pattern, rel) && !matchesAnyGlob(g.Exclude, rel)
+}
+
+// expandGlob turns a glob entry into one file declaration per matched file,
+// in path order. IDs are derived by the entry's idFrom rule.
+func expandGlob(ctx context.Context, config ConfigFile, entry SchemaEntryRaw, load DocumentLoader) ([]Declaration, Glob, error) {
+	var pattern string
+	if err := json.Unmarshal(entry.Source, &pattern); err != nil {
+		return nil, Glob{}, fmt.Errorf("invalid glob source in %s: expected a path pattern: %w", config.Path, err)
+	}
+	switch entry.IDFrom {
+	case "", IDFromFilename, IDFromTitle, IDFromID:
+	default:
+		return nil, Glob{}, fmt.Errorf("glob source %s in %s: unknown idFrom %q (expected filename, title or $id)", pattern, config.Path, entry.IDFrom)
+	}
+	pattern = path.Clean(filepath.ToSlash(pattern))
+	for _, p := range append([]string{pattern}, entry.Exclude...) {
+		if err := validateGlob(p); err != nil {
+			return nil, Glob{}, fmt.Errorf("invalid pattern %q for glob source in %s: %w", p, config.Path, err)
+		}
+	}
+
+	configDir := filepath.Dir(config.Path)
+	files, dirs, err := globFiles(ctx, configDir, pattern)
+	if err != nil {
+		return nil, Glob{}, fmt.Errorf("glob source %s in %s: %w", pattern, config.Path, err)
+	}
+	glob := Glob{ConfigPath: config.Path, Pattern: pattern, Exclude: entry.Exclude, Dirs: dirs}
+
+	var declarations []Declaration
+	for _, rel := range files {
+		if !glob.Match(filepath.Join(configDir, rel)) {
+			continue
+		}
+		source := rel
+		if !strings.HasPrefix(source, "../") {
+			source = "./" + source
+		}
+		sourceJSON, _ := json.Marshal(source)
+
+		d := Declaration{
+			Namespace:  config.Namespace,
+			SourceType: SourceFile,
+			Source:     sourceJSON,
+			Adapter:    entry.Adapter,
+			ConfigPath: config.Path,
+			Expanded:   true,
+			// A title or $id is read from the file, so editing it can rename the declaration
+			FileDefinesIDs: entry.IDFrom == IDFromTitle || entry.IDFrom == IDFromID,
+		}
+		id, err := globID(ctx, entry.IDFrom, d, load)
+		if err != nil {
+			return nil, Glob{}, fmt.Errorf("glob source %s in %s: %w", pattern, config.Path, err)
+		}
+		d.ID = entry.IDPrefix + id
+		declarations = append(declarations, d)
+	}
+	if len(declarations) == 0 {
+		return nil, Glob{}, fmt.Errorf("glob source %s in %s matched no schema files", pattern, config.Path)
+	}
+
+	ui.Verbosef("expanded glob source: pattern=%s, schemas=%d", pattern, len(declarations))
+	return declarations, glob, nil
+}
+
+// globFiles returns the slash-separated paths, relative to dir, of the
+// regular files matching pattern, sorted, and the directories it searched
+func globFiles(ctx context.Context, dir, pattern string) ([]string, []string, error) {
+	// Walk only below the part of the pattern without wildcards
+	segments := strings.Split(pattern, "/")
+	static := 0
+	for static < len(segments)-1 && !hasMeta(segments[static]) {
+		static++
+	}
+	root := filepath.Join(dir, filepath.FromSlash(path.Join(segments[:static]...)))
+
+	ignoreDirs := ignoredDirs()
+	var files, dirs []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if p != root && ignoreDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			dirs = append(dirs, p)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel = filepath.ToSlash(rel); matchGlob(pattern, rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, dirs, err
+}
+
+// globID derives a declaration ID for a matched file
+func globID(ctx context.Context, rule IDRule, d Declaration, load DocumentLoader) (string, error) {
+	location, _, err := d.SourceLocation()
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(location)
+
+	if rule == IDFromTitle || rule == IDFromID {
+		data, err := load(ctx, d)
+		if err != nil {
+			return "", err
+		}
+		var meta struct {
+			Title string `json:"title"`
+			ID    string `json:"$id"`
+		}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return "", fmt.Errorf("%s is not a JSON object: %w", location, err)
+		}
+
+		switch {
+		case rule == IDFromTitle && meta.Title != "":
+			name = meta.Title
+		case rule == IDFromID && meta.ID != "":
+			if u, err := url.Parse(meta.ID); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+				name = path.Base(u.Path)
+			}
+		default:
+			ui.Verbosef("no %s in %s, using its file name as ID", rule, location)
+		}
+	}
+
+	id := pascalCase(trimSchemaExt(name))
+	if id == "" {
+		return "", fmt.Errorf("cannot derive an ID from %s", location)
+	}
+	return id, nil
+}
+
+// trimSchemaExt removes a file extension and a ".schema" suffix,
+// e.g. "user.schema.json" gives "user"
+func trimSchemaExt(name string) string {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return strings.TrimSuffix(name, ".schema")
+}
+
+// pascalCase joins the alphanumeric words of s, capitalizing each,
+// e.g. "purchase order-v2" gives "PurchaseOrderV2"
+func pascalCase(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, w := range words {
+		runes := []rune(w)
+		b.WriteRune(unicode.ToUpper(runes[0]))
+		b.WriteString(string(runes[1:]))
+	}
+	return b.String()
+}
+
+// matchGlob reports whether the slash-separated path name matches pattern,
+// where a "**" segment matches any number of directories
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchesAnyGlob reports whether name matches one of the patterns
+func matchesAnyGlob(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchGlob(path.Clean(p), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateGlob checks every segment of a glob pattern for syntax errors
+func validateGlob(pattern string) error {
+	for _, segment := range strings.Split(pattern, "/") {
+		if _, err := path.Match(segment, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasMeta(segment string) bool {
+	return strings.ContainsAny(segment, `*?[\`)
+}
@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeGlobProject writes a config with the given entries plus schema files
+func writeGlobProject(t *testing.T, entries string, files map[string]string) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	files["schemas.jsonc"] = `{
+		"$schema": "https://xschema.dev/schemas/ts.jsonc",
+		"schemas": [` + entries + `]
+	}`
+	for name, content := range files {
+		p := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tmpDir
+}
+
+func globSchemaFiles() map[string]string {
+	return map[string]string{
+		"schemas/user-profile.json":         `{"title": "Account", "type": "object"}`,
+		"schemas/orders/order.schema.yaml":  "$id: https://example.com/schemas/purchase_order.json\ntype: object\n",
+		"schemas/drafts/wip.json":           `{"type": "object"}`,
+		"schemas/node_modules/dep/dep.json": `{"type": "object"}`,
+		"schemas/README.md":                 "not a schema",
+		"elsewhere/ignored.json":            `{"type": "object"}`,
+	}
+}
+
+func TestParseGlobExpansion(t *testing.T) {
+	tmpDir := writeGlobProject(t, `
+		{"sourceType": "glob", "source": "./schemas/**/*.json", "adapter": "zod", "exclude": ["schemas/drafts/**"]},
+		{"sourceType": "glob", "source": "schemas/**/*.yaml", "adapter": "zod", "idPrefix": "Api"}
+	`, globSchemaFiles())
+
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := []struct{ id, source string }{
+		{"UserProfile", `"./schemas/user-profile.json"`},
+		{"ApiOrder", `"./schemas/orders/order.schema.yaml"`},
+	}
+	if len(result.Declarations) != len(want) {
+		t.Fatalf("expected %d declarations, got %+v", len(want), result.Declarations)
+	}
+	for i, w := range want {
+		d := result.Declarations[i]
+		if d.ID != w.id || string(d.Source) != w.source || d.SourceType != SourceFile || !d.Expanded || d.FileDefinesIDs {
+			t.Errorf("declaration %d = %+v, want %s from %s", i, d, w.id, w.source)
+		}
+	}
+
+	// The entries are kept, so a watcher can tell which new files they match
+	if len(result.Globs) != 2 {
+		t.Fatalf("expected 2 globs, got %+v", result.Globs)
+	}
+	jsonGlob := result.Globs[0]
+	for path, want := range map[string]bool{
+		"schemas/new.json":         true,
+		"schemas/orders/new.json":  true,
+		"schemas/drafts/new.json":  false,
+		"schemas/new.yaml":         false,
+		"elsewhere/new.json":       false,
+		"schemas/orders/order.txt": false,
+	} {
+		if got := jsonGlob.Match(filepath.Join(tmpDir, filepath.FromSlash(path))); got != want {
+			t.Errorf("Match(%s) = %v, want %v", path, got, want)
+		}
+	}
+	wantDirs := []string{"schemas", "schemas/drafts", "schemas/orders"}
+	if len(jsonGlob.Dirs) != len(wantDirs) {
+		t.Fatalf("expected the searched directories %v, got %v", wantDirs, jsonGlob.Dirs)
+	}
+	for i, dir := range wantDirs {
+		if jsonGlob.Dirs[i] != filepath.Join(tmpDir, filepath.FromSlash(dir)) {
+			t.Errorf("Dirs[%d] = %s, want %s", i, jsonGlob.Dirs[i], dir)
+		}
+	}
+}
+
+func TestParseGlobIDFrom(t *testing.T) {
+	tests := []struct {
+		rule string
+		want []string
+	}{
+		{"filename", []string{"Wip", "Order", "UserProfile"}},
+		{"title", []string{"Wip", "Order", "Account"}},
+		{"$id", []string{"Wip", "PurchaseOrder", "UserProfile"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			tmpDir := writeGlobProject(t,
+				`{"sourceType": "glob", "source": "./schemas/*/*", "adapter": "zod", "idFrom": "`+tt.rule+`"},
+				 {"sourceType": "glob", "source": "./schemas/*.json", "adapter": "zod", "idFrom": "`+tt.rule+`"}`,
+				globSchemaFiles())
+
+			result, err := Parse(context.Background(), tmpDir, "", nil)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			var got []string
+			for _, d := range result.Declarations {
+				got = append(got, d.ID)
+				if d.FileDefinesIDs != (tt.rule != "filename") {
+					t.Errorf("%s: FileDefinesIDs = %v with idFrom %s", d.ID, d.FileDefinesIDs, tt.rule)
+				}
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("IDs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGlobErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries string
+		wantErr string
+	}{
+		{
+			name: "duplicate derived IDs",
+			entries: `{"sourceType": "glob", "source": "./schemas/**/*.json", "adapter": "zod"},
+				{"id": "Wip", "sourceType": "json", "source": {}, "adapter": "zod"}`,
+			wantErr: `duplicate schema ID "Wip"`,
+		},
+		{
+			name:    "unknown rule",
+			entries: `{"sourceType": "glob", "source": "./schemas/*.json", "adapter": "zod", "idFrom": "name"}`,
+			wantErr: "unknown idFrom",
+		},
+		{
+			name:    "idFrom on other entries",
+			entries: `{"id": "A", "sourceType": "file", "source": "./a.json", "adapter": "zod", "idFrom": "title"}`,
+			wantErr: "idFrom only applies to glob sources",
+		},
+		{
+			name:    "no matches",
+			entries: `{"sourceType": "glob", "source": "./missing/*.json", "adapter": "zod"}`,
+			wantErr: "matched no schema files",
+		},
+		{
+			name:    "invalid pattern",
+			entries: `{"sourceType": "glob", "source": "./schemas/[.json", "adapter": "zod"}`,
+			wantErr: "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := writeGlobProject(t, tt.entries, globSchemaFiles())
+			_, err := Parse(context.Background(), tmpDir, "", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"schemas/*.json", "schemas/a.json", true},
+		{"schemas/*.json", "schemas/sub/a.json", false},
+		{"schemas/**/*.json", "schemas/a.json", true},
+		{"schemas/**/*.json", "schemas/x/y/a.json", true},
+		{"schemas/**", "schemas/x/a.json", true},
+		{"**/a.json", "a.json", true},
+		{"../shared/*.json", "../shared/a.json", true},
+		{"schemas/*.json", "other/a.json", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
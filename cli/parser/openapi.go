@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/tailscale/hujson"
+	"github.com/xschemadev/xschema/ui"
+	"github.com/xschemadev/xschema/yamlconv"
+)
+
+// DocumentLoader returns the whole document behind a url or file declaration
+// as JSON. Parse uses it to read the OpenAPI documents that openapi entries
+// expand, and the schemas glob entries take IDs from.
+type DocumentLoader func(ctx context.Context, d Declaration) ([]byte, error)
+
+// loadLocalDocument is the DocumentLoader used when Parse is given none
+// It reads files only; url documents need a loader that can fetch them.
+func loadLocalDocument(ctx context.Context, d Declaration) ([]byte, error) {
+	if d.SourceType != SourceFile {
+		return nil, fmt.Errorf("cannot load %s: only file documents can be read without a document loader", d.Source)
+	}
+	p, err := d.FilePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	if yamlconv.IsYAMLPath(p) {
+		return yamlconv.ToJSON(data)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("invalid JSON in %s", p)
+	}
+	return data, nil
+}
+
+// expandOpenAPI turns an openapi entry into one declaration per
+// components.schemas entry of the referenced OpenAPI 3.x or AsyncAPI document.
+// Each declaration points at its component with a JSON Pointer fragment, so
+// the retriever fetches the document once and bundles refs between siblings.
+func expandOpenAPI(ctx context.Context, config ConfigFile, entry SchemaEntryRaw, load DocumentLoader) ([]Declaration, error) {
+	var source string
+	if err := json.Unmarshal(entry.Source, &source); err != nil {
+		return nil, fmt.Errorf("invalid openapi source in %s: expected a URL or file path: %w", config.Path, err)
+	}
+	if strings.Contains(source, "#") {
+		return nil, fmt.Errorf("invalid openapi source %q in %s: the document location cannot have a fragment", source, config.Path)
+	}
+	for _, pattern := range append(append([]string(nil), entry.Include...), entry.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q for openapi source %s in %s: %w", pattern, source, config.Path, err)
+		}
+	}
+
+	sourceType := SourceFile
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		sourceType = SourceURL
+	}
+	doc := Declaration{
+		Namespace:  config.Namespace,
+		SourceType: sourceType,
+		Source:     entry.Source,
+		Adapter:    entry.Adapter,
+		ConfigPath: config.Path,
+	}
+
+	data, err := load(ctx, doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi source %s in %s: %w", source, config.Path, err)
+	}
+	names, err := componentSchemas(data)
+	if err != nil {
+		return nil, fmt.Errorf("openapi source %s in %s: %w", source, config.Path, err)
+	}
+
+	var declarations []Declaration
+	for _, name := range names {
+		if !matchesAny(entry.Include, name, true) || matchesAny(entry.Exclude, name, false) {
+			continue
+		}
+		pointer := "/components/schemas/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+		ref, _ := json.Marshal(source + "#" + (&url.URL{Fragment: pointer}).EscapedFragment())
+
+		d := doc
+		d.ID = entry.IDPrefix + name
+		d.Source = ref
+		d.Expanded = true
+		d.FileDefinesIDs = true
+		declarations = append(declarations, d)
+	}
+	if len(declarations) == 0 {
+		return nil, fmt.Errorf("openapi source %s in %s: no component schemas match the include/exclude patterns", source, config.Path)
+	}
+
+	ui.Verbosef("expanded openapi source: source=%s, schemas=%d of %d", source, len(declarations), len(names))
+	return declarations, nil
+}
+
+// componentSchemas returns the names under components.schemas, in document order
+func componentSchemas(data []byte) ([]string, error) {
+	doc, err := hujson.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	root, ok := doc.Value.(*hujson.Object)
+	if !ok {
+		return nil, fmt.Errorf("not an OpenAPI 3.x or AsyncAPI document")
+	}
+
+	var version, asyncVersion string
+	for _, m := range root.Members {
+		lit, ok := m.Value.Value.(hujson.Literal)
+		if !ok {
+			continue
+		}
+		switch m.Name.Value.(hujson.Literal).String() {
+		case "openapi":
+			version = lit.String()
+		case "asyncapi":
+			asyncVersion = lit.String()
+		}
+	}
+	if !strings.HasPrefix(version, "3.") && asyncVersion == "" {
+		return nil, fmt.Errorf("not an OpenAPI 3.x or AsyncAPI document (found openapi %q)", version)
+	}
+
+	schemas := doc.Find("/components/schemas")
+	if schemas == nil {
+		return nil, fmt.Errorf("document has no components.schemas")
+	}
+	obj, ok := schemas.Value.(*hujson.Object)
+	if !ok {
+		return nil, fmt.Errorf("components.schemas is not an object")
+	}
+	names := make([]string, len(obj.Members))
+	for i, m := range obj.Members {
+		names[i] = m.Name.Value.(hujson.Literal).String()
+	}
+	return names, nil
+}
+
+// matchesAny reports whether name matches one of the glob patterns, or
+// whenEmpty if there are none. Patterns are validated before matching.
+func matchesAny(patterns []string, name string, whenEmpty bool) bool {
+	if len(patterns) == 0 {
+		return whenEmpty
+	}
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
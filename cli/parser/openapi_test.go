@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const petstoreYAML = `openapi: 3.1.0
+info: {title: Petstore, version: "1"}
+components:
+  schemas:
+    Pet:
+      type: object
+      properties:
+        owner: {$ref: "#/components/schemas/Owner"}
+    Owner: {type: object}
+    Error: {type: string}
+    Pet/Legacy: {type: object}
+`
+
+func writeOpenAPIProject(t *testing.T, entries string) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	config := `{
+		"$schema": "https://xschema.dev/schemas/ts.jsonc",
+		"schemas": [` + entries + `]
+	}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "api.jsonc"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "petstore.yaml"), []byte(petstoreYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return tmpDir
+}
+
+func TestParseOpenAPIExpansion(t *testing.T) {
+	tmpDir := writeOpenAPIProject(t, `
+		{"sourceType": "openapi", "source": "./petstore.yaml", "adapter": "zod", "include": ["Pet*", "Owner"], "exclude": ["*/*"], "idPrefix": "Api"},
+		{"id": "Extra", "sourceType": "json", "source": {"type": "string"}, "adapter": "zod"}
+	`)
+
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := []struct{ id, source string }{
+		{"ApiPet", `"./petstore.yaml#/components/schemas/Pet"`},
+		{"ApiOwner", `"./petstore.yaml#/components/schemas/Owner"`},
+		{"Extra", `{"type": "string"}`},
+	}
+	if len(result.Declarations) != len(want) {
+		t.Fatalf("expected %d declarations, got %+v", len(want), result.Declarations)
+	}
+	for i, w := range want {
+		d := result.Declarations[i]
+		if d.ID != w.id || string(d.Source) != w.source {
+			t.Errorf("declaration %d = %s %s, want %s %s", i, d.ID, d.Source, w.id, w.source)
+		}
+	}
+
+	pet := result.Declarations[0]
+	if pet.SourceType != SourceFile || pet.Adapter != "zod" || pet.Namespace != "api" || !pet.Expanded || !pet.FileDefinesIDs {
+		t.Errorf("unexpected expanded declaration: %+v", pet)
+	}
+	if result.Declarations[2].Expanded {
+		t.Error("plain declarations should not be marked expanded")
+	}
+}
+
+func TestParseOpenAPIEscapesComponentNames(t *testing.T) {
+	tmpDir := writeOpenAPIProject(t, `{"sourceType": "openapi", "source": "./petstore.yaml", "adapter": "zod", "include": ["*/*"]}`)
+
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(result.Declarations) != 1 {
+		t.Fatalf("expected 1 declaration, got %d", len(result.Declarations))
+	}
+	d := result.Declarations[0]
+	if d.ID != "Pet/Legacy" {
+		t.Errorf("expected ID Pet/Legacy, got %s", d.ID)
+	}
+	if _, pointer, err := d.SourceLocation(); err != nil || pointer != "/components/schemas/Pet~1Legacy" {
+		t.Errorf("SourceLocation() pointer = %q, %v", pointer, err)
+	}
+}
+
+func TestParseOpenAPIURLUsesLoader(t *testing.T) {
+	tmpDir := writeOpenAPIProject(t, `{"sourceType": "openapi", "source": "https://example.com/api.json", "adapter": "zod"}`)
+
+	if _, err := Parse(context.Background(), tmpDir, "", nil); err == nil {
+		t.Error("expected error loading a URL document without a loader")
+	}
+
+	var loaded string
+	load := func(ctx context.Context, d Declaration) ([]byte, error) {
+		loaded = string(d.Source)
+		return []byte(`{"asyncapi": "2.6.0", "components": {"schemas": {"Event": {"type": "object"}}}}`), nil
+	}
+	result, err := Parse(context.Background(), tmpDir, "", load)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if loaded != `"https://example.com/api.json"` {
+		t.Errorf("loader called with %s", loaded)
+	}
+	d := result.Declarations[0]
+	if d.ID != "Event" || d.SourceType != SourceURL || string(d.Source) != `"https://example.com/api.json#/components/schemas/Event"` {
+		t.Errorf("unexpected declaration: %+v", d)
+	}
+}
+
+func TestParseOpenAPIErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries string
+		wantErr string
+	}{
+		{
+			name: "duplicate across expansion",
+			entries: `{"sourceType": "openapi", "source": "./petstore.yaml", "adapter": "zod"},
+				{"id": "Owner", "sourceType": "json", "source": {}, "adapter": "zod"}`,
+			wantErr: `duplicate schema ID "Owner"`,
+		},
+		{
+			name:    "nothing matches",
+			entries: `{"sourceType": "openapi", "source": "./petstore.yaml", "adapter": "zod", "include": ["Nope*"]}`,
+			wantErr: "no component schemas match",
+		},
+		{
+			name:    "invalid pattern",
+			entries: `{"sourceType": "openapi", "source": "./petstore.yaml", "adapter": "zod", "exclude": ["["]}`,
+			wantErr: "invalid pattern",
+		},
+		{
+			name:    "id on openapi entry",
+			entries: `{"id": "Pets", "sourceType": "openapi", "source": "./petstore.yaml", "adapter": "zod"}`,
+			wantErr: "use idPrefix",
+		},
+		{
+			name:    "filters on other entries",
+			entries: `{"id": "User", "sourceType": "file", "source": "./user.json", "adapter": "zod", "idPrefix": "X"}`,
+			wantErr: "only apply to openapi and glob sources",
+		},
+		{
+			name:    "not an openapi document",
+			entries: `{"sourceType": "openapi", "source": "./api.jsonc", "adapter": "zod"}`,
+			wantErr: "not an OpenAPI 3.x or AsyncAPI document",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := writeOpenAPIProject(t, tt.entries)
+			_, err := Parse(context.Background(), tmpDir, "", nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
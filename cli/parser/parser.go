@@ -1,23 +1,29 @@
 package parser
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/tailscale/hujson"
 	"github.com/xschemadev/xschema/language"
 	"github.com/xschemadev/xschema/ui"
+	"github.com/xschemadev/xschema/yamlconv"
 )
 
 // Parse finds all xschema config files in the project and returns merged declarations
-// langFilter can be empty (auto-detect) or a language name to filter by
-func Parse(ctx context.Context, projectRoot string, langFilter string) (*ParseResult, error) {
+// Configs of every language are kept unless langFilter names one of them.
+// load reads the documents behind openapi entries; nil reads local files only
+func Parse(ctx context.Context, projectRoot string, langFilter string, load DocumentLoader) (*ParseResult, error) {
 	ui.Verbosef("parsing project: root=%s, langFilter=%s", projectRoot, langFilter)
 
 	// Find all JSON/JSONC files
@@ -30,9 +36,6 @@ func Parse(ctx context.Context, projectRoot string, langFilter string) (*ParseRe
 
 	// Parse each file, filter by xschema.dev $schema
 	var configs []ConfigFile
-	var detectedLang *language.Language
-	languageConflict := false
-
 	for _, path := range files {
 		select {
 		case <-ctx.Done():
@@ -52,14 +55,6 @@ func Parse(ctx context.Context, projectRoot string, langFilter string) (*ParseRe
 
 		ui.Verbosef("found xschema config: path=%s, namespace=%s, language=%s, schemas=%d",
 			path, config.Namespace, config.Language.Name, len(config.Schemas))
-
-		// Check language consistency
-		if detectedLang == nil {
-			detectedLang = config.Language
-		} else if detectedLang.Name != config.Language.Name {
-			languageConflict = true
-		}
-
 		configs = append(configs, *config)
 	}
 
@@ -67,37 +62,54 @@ func Parse(ctx context.Context, projectRoot string, langFilter string) (*ParseRe
 		return nil, fmt.Errorf("no xschema config files found in %s", projectRoot)
 	}
 
-	// Handle language filter/conflict
-	if languageConflict {
-		if langFilter == "" {
-			// List detected languages
-			langs := make(map[string]bool)
-			for _, c := range configs {
-				langs[c.Language.Name] = true
-			}
-			var langList []string
-			for l := range langs {
-				langList = append(langList, l)
-			}
-			return nil, fmt.Errorf("multiple languages detected (%s). Use --lang to specify which one to use",
-				strings.Join(langList, ", "))
+	var detected []string
+	for _, c := range configs {
+		if !slices.Contains(detected, c.Language.Name) {
+			detected = append(detected, c.Language.Name)
 		}
-		// Filter configs by language
-		var filtered []ConfigFile
-		for _, c := range configs {
-			if c.Language.Name == langFilter {
-				filtered = append(filtered, c)
-			}
-		}
-		configs = filtered
-		detectedLang = language.ByName(langFilter)
-		if detectedLang == nil {
+	}
+	slices.Sort(detected)
+
+	// Keep only the filtered language's configs
+	if langFilter != "" {
+		if language.ByName(langFilter) == nil {
 			return nil, fmt.Errorf("unknown language: %s", langFilter)
 		}
+		configs = slices.DeleteFunc(configs, func(c ConfigFile) bool { return c.Language.Name != langFilter })
+		if len(configs) == 0 {
+			return nil, fmt.Errorf("no %s xschema config files found in %s", langFilter, projectRoot)
+		}
+	}
+
+	var languages []*language.Language
+	for _, c := range configs {
+		if !slices.Contains(languages, c.Language) {
+			languages = append(languages, c.Language)
+		}
+	}
+	slices.SortFunc(languages, func(a, b *language.Language) int { return strings.Compare(a.Name, b.Name) })
+
+	// Adapters run in the package a config belongs to, e.g. apps/web in a monorepo
+	for i := range configs {
+		configs[i].PackageDir = configs[i].Language.PackageRoot(filepath.Dir(configs[i].Path), projectRoot)
+		ui.Verbosef("package root: config=%s, dir=%s", configs[i].Path, configs[i].PackageDir)
 	}
 
 	// Merge declarations, checking for conflicts
-	declarations, err := mergeDeclarations(configs)
+	if load == nil {
+		load = loadLocalDocument
+	}
+	declarations, globs, err := mergeDeclarations(ctx, configs, load)
+	if err != nil {
+		return nil, err
+	}
+
+	adapters, err := mergeAdapters(configs)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := mergeTemplates(configs)
 	if err != nil {
 		return nil, err
 	}
@@ -105,17 +117,24 @@ func Parse(ctx context.Context, projectRoot string, langFilter string) (*ParseRe
 	ui.Verbosef("parsed %d configs, %d declarations", len(configs), len(declarations))
 
 	return &ParseResult{
-		Language:     detectedLang,
+		Languages:    languages,
+		Detected:     detected,
 		Configs:      configs,
 		Declarations: declarations,
+		Adapters:     adapters,
+		Templates:    templates,
+		Globs:        globs,
 	}, nil
 }
 
-// getConfigFiles returns all JSON/JSONC files in the project
+// configExtensions are the file types that may hold an xschema config
+var configExtensions = map[string]bool{".json": true, ".jsonc": true, ".yaml": true, ".yml": true}
+
+// getConfigFiles returns all JSON/JSONC/YAML files in the project
 func getConfigFiles(ctx context.Context, projectRoot string) ([]string, error) {
 	// Try git ls-files first
 	ui.Verbosef("getting config files using git in %s", projectRoot)
-	args := []string{"ls-files", "--cached", "--others", "--exclude-standard", "*.json", "*.jsonc"}
+	args := []string{"ls-files", "--cached", "--others", "--exclude-standard", "*.json", "*.jsonc", "*.yaml", "*.yml"}
 	cmd := exec.CommandContext(ctx, "git", args...)
 	cmd.Dir = projectRoot
 	output, err := cmd.Output()
@@ -144,11 +163,7 @@ func getConfigFiles(ctx context.Context, projectRoot string) ([]string, error) {
 func walkDirForConfigs(ctx context.Context, projectRoot string) ([]string, error) {
 	ui.Verbosef("walking directory for configs: %s", projectRoot)
 
-	// Get all language-specific ignore dirs
-	ignoreDirs := language.AllIgnoreDirs()
-	// Add common dirs that should always be skipped
-	ignoreDirs[".git"] = true
-	ignoreDirs["vendor"] = true // Go vendor
+	ignoreDirs := ignoredDirs()
 
 	var files []string
 	err := filepath.WalkDir(projectRoot, func(path string, d fs.DirEntry, err error) error {
@@ -170,8 +185,7 @@ func walkDirForConfigs(ctx context.Context, projectRoot string) ([]string, error
 			return nil
 		}
 
-		ext := filepath.Ext(path)
-		if ext == ".json" || ext == ".jsonc" {
+		if configExtensions[filepath.Ext(path)] {
 			files = append(files, path)
 		}
 		return nil
@@ -181,6 +195,16 @@ func walkDirForConfigs(ctx context.Context, projectRoot string) ([]string, error
 	return files, err
 }
 
+// ignoredDirs returns the directory names never searched for configs or schemas
+func ignoredDirs() map[string]bool {
+	// Get all language-specific ignore dirs
+	ignoreDirs := language.AllIgnoreDirs()
+	// Add common dirs that should always be skipped
+	ignoreDirs[".git"] = true
+	ignoreDirs["vendor"] = true // Go vendor
+	return ignoreDirs
+}
+
 // parseConfigFile parses a single config file
 // Returns nil if file is not an xschema config (no matching $schema)
 func parseConfigFile(path string) (*ConfigFile, error) {
@@ -189,10 +213,23 @@ func parseConfigFile(path string) (*ConfigFile, error) {
 		return nil, err
 	}
 
-	// Standardize JSONC to JSON using hujson
-	standardized, err := hujson.Standardize(content)
-	if err != nil {
-		return nil, fmt.Errorf("invalid JSON/JSONC: %w", err)
+	var standardized []byte
+	if yamlconv.IsYAMLPath(path) {
+		// Most YAML in a project is unrelated (CI, Kubernetes, lockfiles), so
+		// skip converting anything that cannot carry an xschema $schema URL
+		if !bytes.Contains(content, []byte(language.XSchemaBaseURL)) {
+			return nil, nil
+		}
+		standardized, err = yamlconv.ToJSON(content)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Standardize JSONC to JSON using hujson
+		standardized, err = hujson.Standardize(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON/JSONC: %w", err)
+		}
 	}
 
 	// Parse JSON
@@ -221,45 +258,176 @@ func parseConfigFile(path string) (*ConfigFile, error) {
 		namespace = strings.TrimSuffix(base, ext)
 	}
 
+	for name, a := range raw.Adapters {
+		a.Dir = filepath.Dir(path)
+		a.Origin = path
+		raw.Adapters[name] = a
+	}
+
+	var template string
+	if raw.Template != "" {
+		template = filepath.Join(filepath.Dir(path), raw.Template)
+		if filepath.IsAbs(raw.Template) {
+			template = raw.Template
+		}
+	}
+
 	return &ConfigFile{
 		Path:      path,
 		Namespace: namespace,
 		Language:  lang,
+		Options:   raw.Options,
+		Adapters:  raw.Adapters,
+		Template:  template,
 		Schemas:   raw.Schemas,
 	}, nil
 }
 
 // mergeDeclarations merges all config files into a flat list of declarations
 // Same namespace from different files is merged; duplicate IDs within namespace are an error
-func mergeDeclarations(configs []ConfigFile) ([]Declaration, error) {
-	// Track seen IDs per namespace for duplicate detection
-	seenIDs := make(map[string]map[string]string) // namespace -> id -> config path
+// Languages generate separate outputs, so each may declare the same namespace:id.
+// openapi and glob entries are expanded into one declaration per schema first,
+// and the glob entries are returned too.
+func mergeDeclarations(ctx context.Context, configs []ConfigFile, load DocumentLoader) ([]Declaration, []Glob, error) {
+	// Track seen IDs per language and namespace for duplicate detection
+	seenIDs := make(map[string]string) // qualified key -> where it was defined
 
 	var declarations []Declaration
+	var globs []Glob
 
 	for _, config := range configs {
-		if seenIDs[config.Namespace] == nil {
-			seenIDs[config.Namespace] = make(map[string]string)
-		}
 
 		for _, schema := range config.Schemas {
-			// Check for duplicate ID in this namespace
-			if existingPath, exists := seenIDs[config.Namespace][schema.ID]; exists {
-				return nil, fmt.Errorf("duplicate schema ID %q in namespace %q: defined in both %s and %s",
-					schema.ID, config.Namespace, existingPath, config.Path)
+			if err := checkExpansionOptions(config, schema); err != nil {
+				return nil, nil, err
+			}
+
+			var expanded []Declaration
+			var err error
+			switch schema.SourceType {
+			case SourceOpenAPI:
+				expanded, err = expandOpenAPI(ctx, config, schema, load)
+			case SourceGlob:
+				var glob Glob
+				expanded, glob, err = expandGlob(ctx, config, schema, load)
+				globs = append(globs, glob)
+			default:
+				expanded = []Declaration{{
+					Namespace:  config.Namespace,
+					ID:         schema.ID,
+					SourceType: schema.SourceType,
+					Source:     schema.Source,
+					Adapter:    schema.Adapter,
+					ConfigPath: config.Path,
+				}}
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+
+			options := mergeOptions(config.Options, schema.Options)
+			for _, d := range expanded {
+				d.Options = options
+				d.PackageDir = config.PackageDir
+				d.Language = config.Language.Name
+				origin := config.Path
+				if d.Expanded {
+					origin = fmt.Sprintf("%s (%s source %s)", config.Path, schema.SourceType, d.Source)
+				}
+
+				// Check for duplicate ID in this namespace
+				if existing, exists := seenIDs[d.QualifiedKey()]; exists {
+					return nil, nil, fmt.Errorf("duplicate schema ID %q in namespace %q: defined in both %s and %s",
+						d.ID, config.Namespace, existing, origin)
+				}
+				seenIDs[d.QualifiedKey()] = origin
+				declarations = append(declarations, d)
 			}
-			seenIDs[config.Namespace][schema.ID] = config.Path
-
-			declarations = append(declarations, Declaration{
-				Namespace:  config.Namespace,
-				ID:         schema.ID,
-				SourceType: schema.SourceType,
-				Source:     schema.Source,
-				Adapter:    schema.Adapter,
-				ConfigPath: config.Path,
-			})
 		}
 	}
 
-	return declarations, nil
+	return declarations, globs, nil
+}
+
+// mergeAdapters collects the adapter overrides of all configs
+// Configs may repeat an override, but not set the same adapter differently.
+func mergeAdapters(configs []ConfigFile) (map[string]AdapterConfig, error) {
+	adapters := make(map[string]AdapterConfig)
+	for _, config := range configs {
+		for name, a := range config.Adapters {
+			if (len(a.Command) == 0) == (a.Path == "") {
+				return nil, fmt.Errorf("adapter %q in %s: set exactly one of command and path", name, config.Path)
+			}
+			if existing, ok := adapters[name]; ok && !sameAdapterConfig(existing, a) {
+				return nil, fmt.Errorf("adapter %q is configured differently in %s and %s", name, existing.Origin, a.Origin)
+			}
+			if _, ok := adapters[name]; !ok {
+				adapters[name] = a
+			}
+		}
+	}
+	return adapters, nil
+}
+
+// mergeTemplates collects the output template of each language
+// Configs of a language may repeat its template, but not name different ones.
+func mergeTemplates(configs []ConfigFile) (map[string]string, error) {
+	templates := make(map[string]string)
+	origins := make(map[string]string)
+	for _, config := range configs {
+		if config.Template == "" {
+			continue
+		}
+		lang := config.Language.Name
+		if existing, ok := templates[lang]; ok && existing != config.Template {
+			return nil, fmt.Errorf("%s template is set differently in %s and %s", lang, origins[lang], config.Path)
+		}
+		templates[lang] = config.Template
+		origins[lang] = config.Path
+	}
+	return templates, nil
+}
+
+// sameAdapterConfig reports whether two overrides start the same process
+func sameAdapterConfig(a, b AdapterConfig) bool {
+	return slices.Equal(a.Command, b.Command) && a.Path == b.Path && a.Dir == b.Dir
+}
+
+// mergeOptions returns the config file's adapter options with the entry's
+// applied on top, key by key
+func mergeOptions(configOptions, entryOptions map[string]json.RawMessage) map[string]json.RawMessage {
+	if len(configOptions) == 0 && len(entryOptions) == 0 {
+		return nil
+	}
+	merged := make(map[string]json.RawMessage, len(configOptions)+len(entryOptions))
+	maps.Copy(merged, configOptions)
+	maps.Copy(merged, entryOptions)
+	return merged
+}
+
+// checkExpansionOptions rejects expansion options on entries they do not apply to
+func checkExpansionOptions(config ConfigFile, schema SchemaEntryRaw) error {
+	expands := schema.SourceType == SourceOpenAPI || schema.SourceType == SourceGlob
+	var misplaced string
+	switch {
+	case len(schema.Include) > 0 && schema.SourceType != SourceOpenAPI:
+		misplaced = "include only applies to openapi sources"
+	case schema.IDFrom != "" && schema.SourceType != SourceGlob:
+		misplaced = "idFrom only applies to glob sources"
+	case (len(schema.Exclude) > 0 || schema.IDPrefix != "") && !expands:
+		misplaced = "exclude and idPrefix only apply to openapi and glob sources"
+	case schema.ID != "" && expands:
+		misplaced = fmt.Sprintf("%s sources declare many schemas: use idPrefix instead of id", schema.SourceType)
+	default:
+		return nil
+	}
+	return fmt.Errorf("schema %s in %s: %s", schemaLabel(schema), config.Path, misplaced)
+}
+
+// schemaLabel names a config entry in errors: its ID, or its source if it has none
+func schemaLabel(schema SchemaEntryRaw) string {
+	if schema.ID != "" {
+		return strconv.Quote(schema.ID)
+	}
+	return string(schema.Source)
 }
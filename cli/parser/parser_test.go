@@ -2,8 +2,11 @@ package parser
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -155,6 +158,55 @@ func TestParseConfigFileWithJSONC(t *testing.T) {
 	}
 }
 
+func TestParseConfigFileWithYAML(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configContent := `# Kept next to the OpenAPI spec
+$schema: https://xschema.dev/schemas/ts.jsonc
+namespace: api
+schemas:
+  - id: Test
+    sourceType: file
+    source: ./test.schema.yaml
+    adapter: zod
+  - id: Inline
+    sourceType: json
+    source:
+      type: object
+      properties:
+        name: {type: string}
+    adapter: zod
+`
+
+	configPath := filepath.Join(tmpDir, "xschema.yaml")
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config, err := parseConfigFile(configPath)
+	if err != nil {
+		t.Fatalf("parseConfigFile: %v", err)
+	}
+	if config == nil {
+		t.Fatal("expected config, got nil")
+	}
+	if config.Namespace != "api" || len(config.Schemas) != 2 {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+	if got := string(config.Schemas[1].Source); got != `{"type":"object","properties":{"name":{"type":"string"}}}` {
+		t.Errorf("unexpected inline source: %s", got)
+	}
+
+	// Unrelated YAML is not an xschema config
+	other := filepath.Join(tmpDir, "deployment.yml")
+	if err := os.WriteFile(other, []byte("apiVersion: apps/v1\nkind: Deployment\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if config, err := parseConfigFile(other); err != nil || config != nil {
+		t.Errorf("expected unrelated YAML to be skipped, got %+v, %v", config, err)
+	}
+}
+
 func TestParse(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -180,13 +232,13 @@ func TestParse(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	result, err := Parse(ctx, tmpDir, "")
+	result, err := Parse(ctx, tmpDir, "", nil)
 	if err != nil {
 		t.Fatalf("Parse: %v", err)
 	}
 
-	if result.Language.Name != "typescript" {
-		t.Errorf("expected language 'typescript', got %q", result.Language.Name)
+	if len(result.Languages) != 1 || result.Languages[0].Name != "typescript" {
+		t.Errorf("expected language 'typescript', got %v", result.Languages)
 	}
 	if len(result.Configs) != 2 {
 		t.Errorf("expected 2 configs, got %d", len(result.Configs))
@@ -224,16 +276,158 @@ func TestParseDuplicateIDError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	_, err := Parse(ctx, tmpDir, "")
+	_, err := Parse(ctx, tmpDir, "", nil)
 	if err == nil {
 		t.Error("expected error for duplicate ID in same namespace")
 	}
 }
 
-func TestParseMultipleLanguagesError(t *testing.T) {
+func TestParseAdapterOptions(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	// One TypeScript, one Python config
+	config := `{
+		"$schema": "https://xschema.dev/schemas/ts.jsonc",
+		"options": {"withoutDescribes": true, "depth": 2},
+		"schemas": [
+			{"id": "Default", "sourceType": "json", "source": {}, "adapter": "zod"},
+			{"id": "Override", "sourceType": "json", "source": {}, "adapter": "zod", "options": {"depth": 5, "withoutDefaults": true}}
+		]
+	}`
+	plain := `{
+		"$schema": "https://xschema.dev/schemas/ts.jsonc",
+		"schemas": [{"id": "Plain", "sourceType": "json", "source": {}, "adapter": "zod"}]
+	}`
+	if err := os.WriteFile(filepath.Join(tmpDir, "a.jsonc"), []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "b.jsonc"), []byte(plain), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	want := map[string]string{
+		"a:Default":  `{"depth":2,"withoutDescribes":true}`,
+		"a:Override": `{"depth":5,"withoutDefaults":true,"withoutDescribes":true}`,
+		"b:Plain":    `null`,
+	}
+	for _, d := range result.Declarations {
+		got, _ := json.Marshal(d.Options)
+		if string(got) != want[d.Key()] {
+			t.Errorf("%s options = %s, want %s", d.Key(), got, want[d.Key()])
+		}
+	}
+}
+
+func TestParseAdapterOverrides(t *testing.T) {
+	write := func(dir, name, adapters string) {
+		t.Helper()
+		config := `{
+			"$schema": "https://xschema.dev/schemas/ts.jsonc",
+			"adapters": ` + adapters + `,
+			"schemas": [{"id": "` + strings.TrimSuffix(name, ".jsonc") + `", "sourceType": "json", "source": {}, "adapter": "zod"}]
+		}`
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(config), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+
+	tmpDir := t.TempDir()
+	write(tmpDir, "a.jsonc", `{"zod": {"command": ["node", "./tools/zod.js"]}}`)
+	write(tmpDir, "b.jsonc", `{"zod": {"command": ["node", "./tools/zod.js"]}}`)
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	zod, ok := result.Adapters["zod"]
+	if !ok || strings.Join(zod.Command, " ") != "node ./tools/zod.js" || zod.Dir != tmpDir {
+		t.Errorf("unexpected override: %+v", result.Adapters)
+	}
+
+	write(tmpDir, "b.jsonc", `{"zod": {"path": "../zod"}}`)
+	if _, err := Parse(context.Background(), tmpDir, "", nil); err == nil || !strings.Contains(err.Error(), "configured differently") {
+		t.Errorf("expected conflicting overrides to fail, got %v", err)
+	}
+
+	write(tmpDir, "b.jsonc", `{"zod": {"command": ["node"], "path": "../zod"}}`)
+	if _, err := Parse(context.Background(), tmpDir, "", nil); err == nil || !strings.Contains(err.Error(), "exactly one of command and path") {
+		t.Errorf("expected an override with command and path to fail, got %v", err)
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	write := func(dir, name, template string) {
+		t.Helper()
+		config := `{
+			"$schema": "https://xschema.dev/schemas/ts.jsonc",
+			"template": "` + template + `",
+			"schemas": [{"id": "` + strings.TrimSuffix(name, ".jsonc") + `", "sourceType": "json", "source": {}, "adapter": "zod"}]
+		}`
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(config), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+
+	// Paths resolve against each config, so both name the same file
+	tmpDir := t.TempDir()
+	write(tmpDir, "a.jsonc", "templates/ts.tmpl")
+	write(filepath.Join(tmpDir, "sub"), "b.jsonc", "../templates/ts.tmpl")
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if want := filepath.Join(tmpDir, "templates", "ts.tmpl"); result.Templates["typescript"] != want {
+		t.Errorf("Templates = %v, want typescript: %s", result.Templates, want)
+	}
+
+	write(filepath.Join(tmpDir, "sub"), "b.jsonc", "other.tmpl")
+	if _, err := Parse(context.Background(), tmpDir, "", nil); err == nil || !strings.Contains(err.Error(), "typescript template is set differently") {
+		t.Errorf("expected conflicting templates to fail, got %v", err)
+	}
+}
+
+func TestParsePackageDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	web := filepath.Join(tmpDir, "apps", "web")
+	if err := os.MkdirAll(filepath.Join(web, "schemas"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := func(id string) []byte {
+		return []byte(`{"$schema": "https://xschema.dev/schemas/ts.jsonc", "schemas": [{"id": "` + id + `", "sourceType": "json", "source": {}, "adapter": "zod"}]}`)
+	}
+	files := map[string][]byte{
+		filepath.Join(web, "package.json"):         []byte(`{"name": "web"}`),
+		filepath.Join(web, "schemas", "web.jsonc"): config("Web"),
+		filepath.Join(tmpDir, "shared.jsonc"):      config("Shared"),
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := map[string]string{"web:Web": web, "shared:Shared": tmpDir}
+	for _, d := range result.Declarations {
+		if d.PackageDir != want[d.Key()] {
+			t.Errorf("%s package dir = %s, want %s", d.Key(), d.PackageDir, want[d.Key()])
+		}
+	}
+}
+
+func TestParseMultipleLanguages(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A TypeScript app and a Python service
 	tsConfig := `{
 		"$schema": "https://xschema.dev/schemas/ts.jsonc",
 		"schemas": [
@@ -247,17 +441,74 @@ func TestParseMultipleLanguagesError(t *testing.T) {
 		]
 	}`
 
-	if err := os.WriteFile(filepath.Join(tmpDir, "ts.jsonc"), []byte(tsConfig), 0644); err != nil {
-		t.Fatalf("failed to write ts config: %v", err)
-	}
-	if err := os.WriteFile(filepath.Join(tmpDir, "py.jsonc"), []byte(pyConfig), 0644); err != nil {
-		t.Fatalf("failed to write py config: %v", err)
+	for path, content := range map[string]string{
+		"apps/web/user.jsonc":             tsConfig,
+		"services/api/post.jsonc":         pyConfig,
+		"services/api/internal/tag.jsonc": strings.Replace(pyConfig, `"Post"`, `"Tag"`, 1),
+	} {
+		path = filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
 	}
 
 	ctx := context.Background()
-	_, err := Parse(ctx, tmpDir, "")
-	if err == nil {
-		t.Error("expected error for multiple languages without --lang filter")
+	result, err := Parse(ctx, tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if len(result.Languages) != 2 || result.Languages[0].Name != "python" || result.Languages[1].Name != "typescript" {
+		t.Fatalf("expected python and typescript, got %v", result.Languages)
+	}
+	for _, d := range result.Declarations {
+		want := "python"
+		if d.ID == "User" {
+			want = "typescript"
+		}
+		if d.Language != want {
+			t.Errorf("%s: expected language %q, got %q", d.Key(), want, d.Language)
+		}
+	}
+
+	if dir := result.ConfigDir("typescript"); dir != filepath.Join(tmpDir, "apps", "web") {
+		t.Errorf("unexpected typescript config dir: %s", dir)
+	}
+	if dir := result.ConfigDir("python"); dir != filepath.Join(tmpDir, "services", "api") {
+		t.Errorf("unexpected python config dir: %s", dir)
+	}
+}
+
+func TestParseSameKeyPerLanguage(t *testing.T) {
+	tmpDir := t.TempDir()
+	configs := map[string]string{
+		"web/user.jsonc": `{"$schema": "https://xschema.dev/schemas/ts.jsonc", "schemas": [
+			{"id": "User", "sourceType": "url", "source": "https://example.com/user.json", "adapter": "zod"}
+		]}`,
+		"api/user.jsonc": `{"$schema": "https://xschema.dev/schemas/py.jsonc", "schemas": [
+			{"id": "User", "sourceType": "url", "source": "https://example.com/user.json", "adapter": "xschema-pydantic"}
+		]}`,
+	}
+	for path, content := range configs {
+		path = filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each language generates its own user:User
+	result, err := Parse(context.Background(), tmpDir, "", nil)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(result.Declarations) != 2 || result.Declarations[0].QualifiedKey() == result.Declarations[1].QualifiedKey() {
+		t.Errorf("expected user:User once per language, got %+v", result.Declarations)
 	}
 }
 
@@ -286,17 +537,27 @@ func TestParseWithLanguageFilter(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	result, err := Parse(ctx, tmpDir, "typescript")
+	result, err := Parse(ctx, tmpDir, "typescript", nil)
 	if err != nil {
 		t.Fatalf("Parse with filter: %v", err)
 	}
 
-	if result.Language.Name != "typescript" {
-		t.Errorf("expected language 'typescript', got %q", result.Language.Name)
+	if len(result.Languages) != 1 || result.Languages[0].Name != "typescript" {
+		t.Errorf("expected language 'typescript', got %v", result.Languages)
 	}
 	if len(result.Declarations) != 1 {
 		t.Errorf("expected 1 declaration (filtered), got %d", len(result.Declarations))
 	}
+	if !slices.Equal(result.Detected, []string{"python", "typescript"}) {
+		t.Errorf("expected both languages to be detected, got %v", result.Detected)
+	}
+
+	if _, err := Parse(ctx, tmpDir, "go", nil); err == nil || !strings.Contains(err.Error(), "no go xschema config files") {
+		t.Errorf("expected an error for a language without configs, got %v", err)
+	}
+	if _, err := Parse(ctx, tmpDir, "cobol", nil); err == nil || !strings.Contains(err.Error(), "unknown language") {
+		t.Errorf("expected an error for an unknown language, got %v", err)
+	}
 }
 
 func TestDeclarationKey(t *testing.T) {
@@ -415,7 +676,7 @@ func TestParseNoConfigFiles(t *testing.T) {
 
 	// Empty directory - no config files
 	ctx := context.Background()
-	_, err := Parse(ctx, tmpDir, "")
+	_, err := Parse(ctx, tmpDir, "", nil)
 	if err == nil {
 		t.Error("expected error when no config files found")
 	}
@@ -443,7 +704,7 @@ func TestParseConfigFileInSubdirectory(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	result, err := Parse(ctx, tmpDir, "")
+	result, err := Parse(ctx, tmpDir, "", nil)
 	if err != nil {
 		t.Fatalf("Parse: %v", err)
 	}
@@ -549,7 +810,7 @@ func TestParseContextCancellation(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel immediately
 
-	_, err := Parse(ctx, tmpDir, "")
+	_, err := Parse(ctx, tmpDir, "", nil)
 	if err == nil {
 		t.Error("expected context cancellation error")
 	}
@@ -561,3 +822,65 @@ func TestParseConfigFileNonExistent(t *testing.T) {
 		t.Error("expected error for non-existent file")
 	}
 }
+
+func TestDeclarationFilePath(t *testing.T) {
+	d := Declaration{
+		Namespace:  "user",
+		ID:         "User",
+		SourceType: SourceFile,
+		Source:     []byte(`"./schemas/user.json"`),
+		ConfigPath: filepath.Join("project", "configs", "user.jsonc"),
+	}
+
+	got, err := d.FilePath()
+	if err != nil {
+		t.Fatalf("FilePath: %v", err)
+	}
+	want := filepath.Join("project", "configs", "schemas", "user.json")
+	if got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	d.SourceType = SourceURL
+	if _, err := d.FilePath(); err == nil {
+		t.Error("expected error for non-file source")
+	}
+
+	d.SourceType = SourceFile
+	d.Source = []byte(`123`)
+	if _, err := d.FilePath(); err == nil {
+		t.Error("expected error for invalid file source")
+	}
+}
+
+func TestDeclarationSourceLocation(t *testing.T) {
+	tests := []struct {
+		sourceType   SourceType
+		source       string
+		wantLocation string
+		wantPointer  string
+		wantErr      bool
+	}{
+		{SourceURL, "https://example.com/openapi.json", "https://example.com/openapi.json", "", false},
+		{SourceURL, "https://example.com/openapi.json#/components/schemas/User", "https://example.com/openapi.json", "/components/schemas/User", false},
+		{SourceURL, "https://example.com/a.json#/$defs/User%20Profile", "https://example.com/a.json", "/$defs/User Profile", false},
+		{SourceFile, "./defs.json#/$defs/Address", "./defs.json", "/$defs/Address", false},
+		{SourceFile, "./defs.json#", "./defs.json", "", false},
+		{SourceFile, "./defs.json#Address", "", "", true},
+		{SourceJSON, `./defs.json`, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			source, _ := json.Marshal(tt.source)
+			d := Declaration{Namespace: "ns", ID: "ID", SourceType: tt.sourceType, Source: source}
+			location, pointer, err := d.SourceLocation()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SourceLocation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if location != tt.wantLocation || pointer != tt.wantPointer {
+				t.Errorf("SourceLocation() = %q, %q; want %q, %q", location, pointer, tt.wantLocation, tt.wantPointer)
+			}
+		})
+	}
+}
@@ -2,6 +2,10 @@ package parser
 
 import (
 	"encoding/json"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
 
 	"github.com/xschemadev/xschema/language"
 )
@@ -13,29 +17,73 @@ const (
 	SourceURL  SourceType = "url"
 	SourceFile SourceType = "file"
 	SourceJSON SourceType = "json"
+
+	// SourceOpenAPI points at an OpenAPI 3.x or AsyncAPI document (URL or file
+	// path, JSON or YAML) and expands into one url/file declaration per
+	// components.schemas entry while parsing
+	SourceOpenAPI SourceType = "openapi"
+	// SourceGlob matches schema files relative to the config file, e.g.
+	// "./schemas/**/*.json", and expands into one file declaration per match
+	SourceGlob SourceType = "glob"
+)
+
+// IDRule selects how glob entries derive each declaration's ID
+type IDRule string
+
+const (
+	IDFromFilename IDRule = "filename" // file name without extensions (default)
+	IDFromTitle    IDRule = "title"    // the schema's title, else the file name
+	IDFromID       IDRule = "$id"      // last path segment of the schema's $id, else the file name
 )
 
 // ConfigFileRaw is the raw JSON structure of an xschema config file
 type ConfigFileRaw struct {
-	Schema    string           `json:"$schema"`
-	Namespace string           `json:"namespace,omitempty"` // optional namespace override
-	Schemas   []SchemaEntryRaw `json:"schemas"`
+	Schema    string                     `json:"$schema"`
+	Namespace string                     `json:"namespace,omitempty"` // optional namespace override
+	Options   map[string]json.RawMessage `json:"options,omitempty"`   // adapter options for every entry
+	Adapters  map[string]AdapterConfig   `json:"adapters,omitempty"`  // how to start adapters, by name
+	Template  string                     `json:"template,omitempty"`  // text/template file for the generated output, relative to the config
+	Schemas   []SchemaEntryRaw           `json:"schemas"`
+}
+
+// AdapterConfig starts an adapter with an explicit command or from a local
+// path instead of through the language's package runner, e.g. to try a
+// forked adapter without publishing it. Exactly one of Command and Path is set.
+type AdapterConfig struct {
+	Command []string `json:"command,omitempty"` // e.g. ["node", "./tools/zod-adapter.js"]
+	Path    string   `json:"path,omitempty"`    // adapter script, or package directory whose bin is run
+	Dir     string   `json:"-"`                 // directory relative paths resolve against
+	Origin  string   `json:"-"`                 // where it was set, for messages
 }
 
 // SchemaEntryRaw represents one schema entry in a config file
 type SchemaEntryRaw struct {
-	ID         string          `json:"id"`
-	SourceType SourceType      `json:"sourceType"` // "url", "file", "json"
-	Source     json.RawMessage `json:"source"`     // string for url/file, object for json
+	ID         string          `json:"id"`         // not used by openapi and glob entries
+	SourceType SourceType      `json:"sourceType"` // "url", "file", "json", "openapi", "glob"
+	Source     json.RawMessage `json:"source"`     // string for url/file/openapi/glob, object for json
 	Adapter    string          `json:"adapter"`    // full package name e.g., "zod"
+
+	// Adapter options, e.g. {"withoutDescribes": true}; keys set here
+	// override the config file's options
+	Options map[string]json.RawMessage `json:"options,omitempty"`
+
+	// Expansion options for openapi and glob entries
+	Include  []string `json:"include,omitempty"`  // openapi: glob patterns over component names; default all
+	Exclude  []string `json:"exclude,omitempty"`  // openapi: component names; glob: paths relative to the config
+	IDPrefix string   `json:"idPrefix,omitempty"` // prepended to each expanded ID
+	IDFrom   IDRule   `json:"idFrom,omitempty"`   // glob: how IDs are derived; default "filename"
 }
 
 // ConfigFile represents a parsed xschema config file
 type ConfigFile struct {
-	Path      string             // absolute path to config file
-	Namespace string             // derived from filename or explicit
-	Language  *language.Language // detected from $schema URL
-	Schemas   []SchemaEntryRaw   // raw schema entries
+	Path       string                     // absolute path to config file
+	Namespace  string                     // derived from filename or explicit
+	Language   *language.Language         // detected from $schema URL
+	Options    map[string]json.RawMessage // adapter options shared by every entry
+	Adapters   map[string]AdapterConfig   // adapter start overrides, resolved against the config's directory
+	Template   string                     // absolute path of the output template, "" for the built-in one
+	Schemas    []SchemaEntryRaw           // raw schema entries
+	PackageDir string                     // nearest package root, where its adapters run
 }
 
 // Declaration represents a schema declaration ready for retrieval
@@ -46,6 +94,17 @@ type Declaration struct {
 	Source     json.RawMessage // URL string, file path string, or inline JSON object
 	Adapter    string          // full adapter package e.g., "zod"
 	ConfigPath string          // path to config file (for relative file resolution)
+	PackageDir string          // package root of the config file, where the adapter runs
+	Language   string          // language of the config file, e.g. "typescript"
+	Expanded   bool            // produced by an openapi or glob entry
+
+	// Editing its file can add, remove or rename declarations: an OpenAPI
+	// document, or a glob match whose ID comes from its title or $id
+	FileDefinesIDs bool
+
+	// Options passed to the adapter: the config file's, overridden key by
+	// key by the entry's. Nil when neither sets any.
+	Options map[string]json.RawMessage
 }
 
 // Key returns the full namespaced key like "user:TestUrl"
@@ -53,11 +112,56 @@ func (d Declaration) Key() string {
 	return d.Namespace + ":" + d.ID
 }
 
+// QualifiedKey prefixes Key with the language, like "typescript/user:TestUrl"
+// Each language may declare the same key, so this is what tells them apart.
+func (d Declaration) QualifiedKey() string {
+	return d.Language + "/" + d.Key()
+}
+
+// FilePath returns the path of a file-sourced schema, resolved relative to its config file
+func (d Declaration) FilePath() (string, error) {
+	if d.SourceType != SourceFile {
+		return "", fmt.Errorf("%s is not a file source", d.Key())
+	}
+	filePath, _, err := d.SourceLocation()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(d.ConfigPath), filePath), nil
+}
+
+// SourceLocation splits a url or file source into the document location and
+// the JSON Pointer naming a sub-schema inside it, e.g. "defs.json#/$defs/Address"
+// gives "defs.json" and "/$defs/Address". The pointer is empty for whole documents.
+func (d Declaration) SourceLocation() (location, pointer string, err error) {
+	if d.SourceType != SourceURL && d.SourceType != SourceFile {
+		return "", "", fmt.Errorf("%s is not a url or file source", d.Key())
+	}
+	var source string
+	if err := json.Unmarshal(d.Source, &source); err != nil {
+		return "", "", fmt.Errorf("invalid %s source for %s: %w", d.SourceType, d.Key(), err)
+	}
+
+	location, fragment, _ := strings.Cut(source, "#")
+	if fragment == "" {
+		return location, "", nil
+	}
+	pointer, err = url.PathUnescape(fragment)
+	if err != nil || !strings.HasPrefix(pointer, "/") {
+		return "", "", fmt.Errorf("invalid source for %s: fragment %q is not a JSON Pointer (expected #/...)", d.Key(), fragment)
+	}
+	return location, pointer, nil
+}
+
 // ParseResult contains all parsed config files and declarations
 type ParseResult struct {
-	Language     *language.Language // detected language (error if multiple)
-	Configs      []ConfigFile       // all parsed config files
-	Declarations []Declaration      // flattened declarations from all configs
+	Languages    []*language.Language     // languages with config files, sorted by name
+	Detected     []string                 // names of every language with config files, including those langFilter left out
+	Configs      []ConfigFile             // all parsed config files
+	Declarations []Declaration            // flattened declarations from all configs
+	Adapters     map[string]AdapterConfig // adapter start overrides from all configs
+	Templates    map[string]string        // output template files by language
+	Globs        []Glob                   // expanded glob entries
 }
 
 // DeclarationsByNamespace groups declarations by namespace
@@ -69,6 +173,31 @@ func (r *ParseResult) DeclarationsByNamespace() map[string][]Declaration {
 	return result
 }
 
+// ConfigDir returns the deepest directory holding every config file of a
+// language, e.g. "apps/web" for apps/web/user.jsonc and apps/web/api/post.jsonc
+func (r *ParseResult) ConfigDir(langName string) string {
+	var dir string
+	for _, c := range r.Configs {
+		if c.Language.Name != langName {
+			continue
+		}
+		d := filepath.Dir(c.Path)
+		if dir == "" {
+			dir = d
+		}
+		for !isWithin(d, dir) && filepath.Dir(dir) != dir {
+			dir = filepath.Dir(dir)
+		}
+	}
+	return dir
+}
+
+// isWithin reports whether path is dir or inside it
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 // DeclarationsByAdapter groups declarations by adapter
 func (r *ParseResult) DeclarationsByAdapter() map[string][]Declaration {
 	result := make(map[string][]Declaration)
@@ -0,0 +1,905 @@
+package retriever
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tailscale/hujson"
+	"github.com/xschemadev/xschema/cache"
+	"github.com/xschemadev/xschema/parser"
+	"github.com/xschemadev/xschema/ui"
+	"golang.org/x/sync/errgroup"
+)
+
+// RefMode controls how $refs are resolved before schemas reach adapters
+type RefMode string
+
+const (
+	// RefsDefs embeds every referenced document once under the root's $defs
+	// and rewrites each $ref to a local JSON Pointer. Recursive schemas stay recursive.
+	RefsDefs RefMode = "defs"
+	// RefsInline replaces every $ref with a copy of the schema it points to.
+	// Cyclic references cannot be inlined and fail with a *RefCycleError.
+	RefsInline RefMode = "inline"
+)
+
+// ParseRefMode validates a ref mode name; empty selects RefsDefs
+func ParseRefMode(s string) (RefMode, error) {
+	switch RefMode(s) {
+	case "", RefsDefs:
+		return RefsDefs, nil
+	case RefsInline:
+		return RefsInline, nil
+	}
+	return "", fmt.Errorf("invalid ref mode %q (expected %q or %q)", s, RefsDefs, RefsInline)
+}
+
+// RefCycleError reports a $ref cycle that cannot be inlined
+type RefCycleError struct {
+	Chain []string // absolute references in the order followed; the last repeats an earlier one
+}
+
+func (e *RefCycleError) Error() string {
+	return fmt.Sprintf("cyclic $ref cannot be inlined (use %q ref mode): %s", RefsDefs, strings.Join(e.Chain, " -> "))
+}
+
+// nonSchemaKeywords hold instance data rather than subschemas, so a "$ref"
+// or "$id" inside them is not a keyword
+var nonSchemaKeywords = map[string]bool{
+	"const":    true,
+	"default":  true,
+	"enum":     true,
+	"examples": true,
+}
+
+// schemaMaps hold subschemas keyed by arbitrary names, e.g. property names,
+// so a member named "default" in them is a subschema rather than a keyword
+var schemaMaps = map[string]bool{
+	"$defs":             true,
+	"definitions":       true,
+	"dependentSchemas":  true,
+	"patternProperties": true,
+	"properties":        true,
+}
+
+// walkMember reports whether to skip an object member holding instance data,
+// and whether its value is a name-keyed map of subschemas. inMap is set when
+// the object itself is such a map, whose members are all subschemas.
+func walkMember(inMap bool, name string) (skip, childMap bool) {
+	if inMap {
+		return false, false
+	}
+	return nonSchemaKeywords[name], schemaMaps[name]
+}
+
+// refLoader fetches documents referenced by $ref through the same HTTP retry
+// logic and caches as declarations, loading each URI at most once per run
+type refLoader struct {
+	opts     Options
+	store    *cache.Store
+	memCache *schemaCache
+
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+type loadCall struct {
+	done chan struct{}
+	data json.RawMessage
+	err  error
+}
+
+func newRefLoader(opts Options, store *cache.Store, memCache *schemaCache) *refLoader {
+	return &refLoader{opts: opts, store: store, memCache: memCache, calls: make(map[string]*loadCall)}
+}
+
+// load returns the document at uri, waiting for a concurrent load of the same URI
+func (l *refLoader) load(ctx context.Context, uri string) (json.RawMessage, error) {
+	l.mu.Lock()
+	if c, ok := l.calls[uri]; ok {
+		l.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.data, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &loadCall{done: make(chan struct{})}
+	l.calls[uri] = c
+	l.mu.Unlock()
+
+	c.data, c.err = l.fetch(ctx, uri)
+	close(c.done)
+	return c.data, c.err
+}
+
+func (l *refLoader) fetch(ctx context.Context, uri string) (json.RawMessage, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref URI %s: %w", uri, err)
+	}
+
+	// Same keys as Retrieve, so a document that is also declared is read once
+	var cacheKey string
+	switch u.Scheme {
+	case "http", "https":
+		cacheKey = "url:" + uri
+	case "file":
+		cacheKey = "file:" + filepath.FromSlash(u.Path)
+	default:
+		return nil, fmt.Errorf("cannot load $ref %s: unsupported scheme %q", uri, u.Scheme)
+	}
+
+	if l.memCache != nil {
+		if cached, ok := l.memCache.get(cacheKey); ok {
+			ui.Verbosef("cache hit: ref=%s", uri)
+			if u.Scheme == "file" {
+				return cached, nil
+			}
+			return decodeURLDocument(uri, cached)
+		}
+	}
+
+	ui.Verbosef("loading referenced schema: %s", uri)
+
+	var data json.RawMessage
+	switch {
+	case u.Scheme == "file":
+		data, err = readSchemaFile(filepath.FromSlash(u.Path))
+	case l.opts.Offline:
+		var entry *cache.Entry
+		entry, data, err = l.store.Lookup(uri)
+		if err == nil && entry == nil {
+			err = fmt.Errorf("offline: %s is not in the cache", uri)
+		}
+	case l.store != nil:
+		data, err = retrieveFromURLCached(ctx, uri, l.opts, l.store)
+	default:
+		data, err = retrieveFromURL(ctx, uri, l.opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if l.memCache != nil {
+		l.memCache.set(cacheKey, data)
+	}
+	if u.Scheme == "file" {
+		return data, nil
+	}
+	return decodeURLDocument(uri, data)
+}
+
+// refDoc is a JSON document taking part in a bundle
+type refDoc struct {
+	uri  string        // retrieval URI, without fragment
+	root *hujson.Value // parsed document, never modified in inline mode
+	name string        // key under the bundle's $defs; empty for the root document
+}
+
+// refTarget is the location a $ref resolves to
+type refTarget struct {
+	doc     *refDoc
+	pointer string // JSON Pointer within doc, "" for the document root
+}
+
+// bundleDef is a value the bundle places under its root's $defs
+type bundleDef struct {
+	name  string
+	value *hujson.Value
+	base  string // base URI in effect for value
+	from  string // retrieval URI of the document value comes from
+}
+
+// bundlePart is a sub-schema of the root's document, outside the root itself,
+// embedded on its own (fragment sources only)
+type bundlePart struct {
+	pointer string
+	name    string
+}
+
+// bundler resolves the $refs of one root schema. Embedded documents follow
+// the JSON Schema 2020-12 bundling layout: each external resource appears
+// once under the root's $defs. Every $ref is rewritten to a pointer from the
+// root, so embedded $id and $anchor keywords are dropped to keep those
+// pointers valid; that is also the only form most adapters can resolve.
+//
+// When the root is a fragment of a larger document (e.g. an OpenAPI
+// component), sibling sub-schemas it references are embedded individually
+// rather than pulling in the whole document.
+type bundler struct {
+	ctx    context.Context
+	loader *refLoader
+	mode   RefMode
+
+	root        *refDoc           // document containing the bundle root
+	rootPointer string            // location of the bundle root within root, "" for the whole document
+	siblings    map[string]string // declaration IDs of other fragments, by "uri#pointer"
+
+	docs    map[string]*refDoc   // loaded documents by retrieval URI
+	ids     map[string]refTarget // resource URIs and "uri#anchor" names to their location
+	names   map[string]bool      // $defs keys in use in the root
+	parts   []bundlePart         // embedded sub-schemas of the root's document
+	defs    []bundleDef          // values to embed, in discovery order
+	changed bool
+}
+
+// bundleSchema resolves the $refs in schema, the value at pointer in doc,
+// whose URI is base. siblings names the $defs of other declared fragments by
+// "uri#pointer". Returns schema unchanged when it has nothing to resolve.
+func bundleSchema(ctx context.Context, loader *refLoader, mode RefMode, base string, doc json.RawMessage, pointer string, schema json.RawMessage, siblings map[string]string) (json.RawMessage, error) {
+	if !bytes.Contains(schema, []byte(`"$ref"`)) {
+		return schema, nil
+	}
+
+	parsed, err := hujson.Parse(bytes.Clone(doc))
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bundler{
+		ctx:         ctx,
+		loader:      loader,
+		mode:        mode,
+		rootPointer: pointer,
+		siblings:    siblings,
+		docs:        make(map[string]*refDoc),
+		ids:         make(map[string]refTarget),
+		names:       make(map[string]bool),
+	}
+	b.root = b.addDoc(base, &parsed)
+	root, rootBase, err := b.node(refTarget{doc: b.root, pointer: pointer})
+	if err != nil {
+		return nil, err
+	}
+
+	var out hujson.Value
+	switch mode {
+	case RefsInline:
+		// Targets are read from the untouched document while the copy is rewritten
+		out = root.Clone()
+		err = b.inline(&out, b.root.uri, rootBase, []string{base + "#" + pointer}, false)
+	default:
+		if obj, ok := root.Value.(*hujson.Object); ok {
+			if defs := findMember(obj, "$defs"); defs != nil {
+				if defsObj, ok := defs.Value.(*hujson.Object); ok {
+					for i := range defsObj.Members {
+						b.names[memberName(&defsObj.Members[i])] = true
+					}
+				}
+			}
+		}
+		err = b.rewrite(root, b.root.uri, rootBase, false)
+		// Rewriting an embedded value may discover further documents
+		for i := 0; err == nil && i < len(b.defs); i++ {
+			err = b.rewrite(b.defs[i].value, b.defs[i].from, b.defs[i].base, false)
+		}
+		if err == nil {
+			err = b.embed(root)
+		}
+		out = *root
+		out.BeforeExtra, out.AfterExtra = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.changed {
+		return schema, nil
+	}
+	stripIdentifiers(&out, true, false)
+	// Moving values between documents can leave trailing commas behind
+	out.Standardize()
+	ui.Verbosef("bundled $refs: base=%s, mode=%s, documents=%d", base, mode, len(b.docs)-1)
+	return json.RawMessage(out.Pack()), nil
+}
+
+// addDoc registers a parsed document and indexes the resources it defines
+func (b *bundler) addDoc(uri string, root *hujson.Value) *refDoc {
+	doc := &refDoc{uri: uri, root: root}
+	b.docs[uri] = doc
+	b.ids[uri] = refTarget{doc: doc}
+	b.index(doc, root, []string{uri}, "", false)
+	return doc
+}
+
+// index records the location of every $id and $anchor in v
+// bases holds the URIs that identify the resource v belongs to; inMap is set
+// when v is a name-keyed map of subschemas rather than a schema.
+func (b *bundler) index(doc *refDoc, v *hujson.Value, bases []string, pointer string, inMap bool) {
+	switch val := v.Value.(type) {
+	case *hujson.Object:
+		if id, ok := stringMember(val, "$id"); ok && !inMap {
+			u, err := resolveURI(bases[0], id)
+			if err == nil {
+				anchor := u.Fragment
+				u.Fragment, u.RawFragment = "", ""
+				if anchor != "" {
+					// Pre-2019 drafts declare anchors as "$id": "#name"
+					b.setID(u.String()+"#"+anchor, refTarget{doc: doc, pointer: pointer})
+				} else if pointer == "" {
+					// A root $id is an alias of the retrieval URI
+					bases = []string{u.String(), doc.uri}
+				} else {
+					bases = []string{u.String()}
+				}
+				b.setID(bases[0], refTarget{doc: doc, pointer: pointer})
+			}
+		}
+		if anchor, ok := stringMember(val, "$anchor"); ok && !inMap {
+			for _, base := range bases {
+				b.setID(base+"#"+anchor, refTarget{doc: doc, pointer: pointer})
+			}
+		}
+		for i := range val.Members {
+			m := &val.Members[i]
+			name := memberName(m)
+			skip, childMap := walkMember(inMap, name)
+			if skip {
+				continue
+			}
+			b.index(doc, &m.Value, bases, pointer+"/"+escapeToken(name), childMap)
+		}
+	case *hujson.Array:
+		for i := range val.Elements {
+			b.index(doc, &val.Elements[i], bases, pointer+"/"+strconv.Itoa(i), false)
+		}
+	}
+}
+
+func (b *bundler) setID(uri string, t refTarget) {
+	if _, ok := b.ids[uri]; !ok {
+		b.ids[uri] = t
+	}
+}
+
+// load fetches and registers the document at uri
+func (b *bundler) load(uri string) (*refDoc, error) {
+	if doc, ok := b.docs[uri]; ok {
+		return doc, nil
+	}
+
+	data, err := b.loader.load(b.ctx, uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load $ref %s: %w", uri, err)
+	}
+	root, err := hujson.Parse(bytes.Clone(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON in $ref %s: %w", uri, err)
+	}
+
+	doc := b.addDoc(uri, &root)
+	if b.mode != RefsInline {
+		doc.name = b.defName(uri)
+		b.defs = append(b.defs, bundleDef{name: doc.name, value: doc.root, base: doc.uri, from: doc.uri})
+	}
+	return doc, nil
+}
+
+// resolve finds the location a $ref in the document retrieved from from
+// points to, loading its document if needed. Only local documents may refer
+// to local files, so a remote schema cannot pull files off the disk into the
+// generated output.
+func (b *bundler) resolve(from, base, ref string) (refTarget, error) {
+	u, err := resolveURI(base, ref)
+	if err != nil {
+		return refTarget{}, fmt.Errorf("invalid $ref %q: %w", ref, err)
+	}
+	fragment := u.Fragment
+	u.Fragment, u.RawFragment = "", ""
+	uri := u.String()
+
+	t, ok := b.ids[uri]
+	if !ok {
+		if u.Scheme == "file" && !isFileURI(from) {
+			return refTarget{}, fmt.Errorf("$ref %q in %s: a remote schema cannot refer to the local file %s", ref, from, uri)
+		}
+		doc, err := b.load(uri)
+		if err != nil {
+			return refTarget{}, err
+		}
+		t = refTarget{doc: doc}
+	}
+	if isFileURI(t.doc.uri) && !isFileURI(from) {
+		return refTarget{}, fmt.Errorf("$ref %q in %s: a remote schema cannot refer to the local file %s", ref, from, t.doc.uri)
+	}
+
+	switch {
+	case fragment == "":
+	case strings.HasPrefix(fragment, "/"):
+		t.pointer += fragment
+	default:
+		anchor, ok := b.ids[uri+"#"+fragment]
+		if !ok {
+			return refTarget{}, fmt.Errorf("$ref %q: anchor %q not found in %s", ref, fragment, uri)
+		}
+		t = anchor
+	}
+
+	if _, _, err := b.node(t); err != nil {
+		return refTarget{}, fmt.Errorf("$ref %q: %w", ref, err)
+	}
+	return t, nil
+}
+
+// node returns the value at t and the base URI in effect for it, excluding
+// the value's own $id
+func (b *bundler) node(t refTarget) (*hujson.Value, string, error) {
+	base := t.doc.uri
+	v, err := lookupPointer(t.doc.root, t.pointer, func(obj *hujson.Object) {
+		if id, ok := stringMember(obj, "$id"); ok {
+			base = resolveBase(base, id)
+		}
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("%w in %s", err, t.doc.uri)
+	}
+	return v, base, nil
+}
+
+// rewrite points every $ref in v at its location in the bundle
+func (b *bundler) rewrite(v *hujson.Value, from, base string, inMap bool) error {
+	switch val := v.Value.(type) {
+	case *hujson.Object:
+		if id, ok := stringMember(val, "$id"); ok && !inMap {
+			base = resolveBase(base, id)
+		}
+		for i := range val.Members {
+			m := &val.Members[i]
+			name := memberName(m)
+			skip, childMap := walkMember(inMap, name)
+			if skip {
+				continue
+			}
+			if ref, ok := stringValue(&m.Value); ok && name == "$ref" && !inMap {
+				t, err := b.resolve(from, base, ref)
+				if err != nil {
+					return err
+				}
+				local, err := b.localRef(t)
+				if err != nil {
+					return err
+				}
+				if local != ref {
+					m.Value.Value = hujson.String(local)
+					b.changed = true
+				}
+				continue
+			}
+			if err := b.rewrite(&m.Value, from, base, childMap); err != nil {
+				return err
+			}
+		}
+	case *hujson.Array:
+		for i := range val.Elements {
+			if err := b.rewrite(&val.Elements[i], from, base, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// localRef returns the $ref for t relative to the bundle root
+func (b *bundler) localRef(t refTarget) (string, error) {
+	pointer := t.pointer
+	switch {
+	case t.doc.name != "":
+		pointer = "/$defs/" + escapeToken(t.doc.name) + pointer
+	case t.doc != b.root:
+		return "", fmt.Errorf("%s is not part of the bundle", t.doc.uri)
+	case withinPointer(pointer, b.rootPointer):
+		pointer = pointer[len(b.rootPointer):]
+	default:
+		name, rest, err := b.part(pointer)
+		if err != nil {
+			return "", err
+		}
+		pointer = "/$defs/" + escapeToken(name) + rest
+	}
+	return "#" + (&url.URL{Fragment: pointer}).EscapedFragment(), nil
+}
+
+// part returns the $defs name and remaining pointer for a sub-schema of the
+// root's document outside the bundle root, embedding it on first use
+func (b *bundler) part(pointer string) (name, rest string, err error) {
+	for _, p := range b.parts {
+		if withinPointer(pointer, p.pointer) {
+			return p.name, pointer[len(p.pointer):], nil
+		}
+	}
+	if withinPointer(b.rootPointer, pointer) {
+		return "", "", fmt.Errorf("#%s contains the bundled schema #%s and cannot be embedded in it", pointer, b.rootPointer)
+	}
+
+	node, base, err := b.node(refTarget{doc: b.root, pointer: pointer})
+	if err != nil {
+		return "", "", err
+	}
+	// A copy, so rewriting it never touches a value another part contains
+	value := node.Clone()
+	value.BeforeExtra, value.AfterExtra = nil, nil
+
+	// A declared sibling keeps its ID, so the embedded copy matches its own output
+	name, ok := b.siblings[b.root.uri+"#"+pointer]
+	if !ok {
+		tokens := strings.Split(pointer, "/")
+		name = unescapeToken(tokens[len(tokens)-1])
+	}
+	name = b.uniqueName(name)
+	b.parts = append(b.parts, bundlePart{pointer: pointer, name: name})
+	b.defs = append(b.defs, bundleDef{name: name, value: &value, base: base, from: b.root.uri})
+	return name, "", nil
+}
+
+// embed adds every loaded document and part to the root's $defs
+func (b *bundler) embed(root *hujson.Value) error {
+	if len(b.defs) == 0 {
+		return nil
+	}
+
+	obj, ok := root.Value.(*hujson.Object)
+	if !ok {
+		return fmt.Errorf("cannot bundle $refs into a schema that is not an object")
+	}
+	defs := findMember(obj, "$defs")
+	if defs == nil {
+		obj.Members = append(obj.Members, hujson.ObjectMember{
+			Name:  hujson.Value{Value: hujson.String("$defs")},
+			Value: hujson.Value{Value: &hujson.Object{}},
+		})
+		defs = &obj.Members[len(obj.Members)-1].Value
+	}
+	defsObj, ok := defs.Value.(*hujson.Object)
+	if !ok {
+		return fmt.Errorf("cannot bundle $refs: $defs is not an object")
+	}
+
+	for _, def := range b.defs {
+		defsObj.Members = append(defsObj.Members, hujson.ObjectMember{
+			Name:  hujson.Value{Value: hujson.String(def.name)},
+			Value: *def.value,
+		})
+	}
+	b.changed = true
+	return nil
+}
+
+// inline replaces every $ref in v with a copy of its target
+// stack holds the targets currently being expanded, to detect cycles.
+func (b *bundler) inline(v *hujson.Value, from, base string, stack []string, inMap bool) error {
+	switch val := v.Value.(type) {
+	case *hujson.Object:
+		if id, ok := stringMember(val, "$id"); ok && !inMap {
+			base = resolveBase(base, id)
+		}
+
+		refIdx := -1
+		for i := range val.Members {
+			m := &val.Members[i]
+			name := memberName(m)
+			if _, ok := stringValue(&m.Value); ok && name == "$ref" && !inMap {
+				refIdx = i
+				continue
+			}
+			skip, childMap := walkMember(inMap, name)
+			if skip {
+				continue
+			}
+			if err := b.inline(&m.Value, from, base, stack, childMap); err != nil {
+				return err
+			}
+		}
+		if refIdx < 0 {
+			return nil
+		}
+
+		ref, _ := stringValue(&val.Members[refIdx].Value)
+		t, err := b.resolve(from, base, ref)
+		if err != nil {
+			return err
+		}
+		key := t.doc.uri + "#" + t.pointer
+		if slices.Contains(stack, key) {
+			return &RefCycleError{Chain: append(slices.Clone(stack), key)}
+		}
+
+		node, nodeBase, err := b.node(t)
+		if err != nil {
+			return err
+		}
+		target := node.Clone()
+		if err := b.inline(&target, t.doc.uri, nodeBase, append(slices.Clip(stack), key), false); err != nil {
+			return err
+		}
+		b.changed = true
+
+		if len(val.Members) == 1 {
+			v.Value = target.Value
+			return nil
+		}
+		// Keywords next to $ref still apply, so combine them with the target
+		val.Members = slices.Delete(val.Members, refIdx, refIdx+1)
+		if allOf := findMember(val, "allOf"); allOf != nil {
+			if arr, ok := allOf.Value.(*hujson.Array); ok {
+				arr.Elements = append(arr.Elements, target)
+				return nil
+			}
+		}
+		val.Members = append(val.Members, hujson.ObjectMember{
+			Name:  hujson.Value{Value: hujson.String("allOf")},
+			Value: hujson.Value{Value: &hujson.Array{Elements: []hujson.Value{target}}},
+		})
+	case *hujson.Array:
+		for i := range val.Elements {
+			if err := b.inline(&val.Elements[i], from, base, stack, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defName picks a unique $defs key for an embedded document
+func (b *bundler) defName(uri string) string {
+	name := uri
+	if u, err := url.Parse(uri); err == nil {
+		name = strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+		if name == "" || name == "." || name == "/" {
+			name = u.Host
+		}
+	}
+	return b.uniqueName(name)
+}
+
+// uniqueName sanitizes name into a $defs key not yet used in the bundle
+func (b *bundler) uniqueName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "" {
+		name = "ref"
+	}
+
+	unique := name
+	for n := 2; b.names[unique]; n++ {
+		unique = fmt.Sprintf("%s_%d", name, n)
+	}
+	b.names[unique] = true
+	return unique
+}
+
+// stripIdentifiers removes $id and $anchor from every subschema, and $schema
+// from all but the root, since the bundle only uses root-relative pointers
+func stripIdentifiers(v *hujson.Value, root, inMap bool) {
+	switch val := v.Value.(type) {
+	case *hujson.Object:
+		val.Members = slices.DeleteFunc(val.Members, func(m hujson.ObjectMember) bool {
+			_, isString := stringValue(&m.Value)
+			if inMap {
+				return false
+			}
+			switch memberName(&m) {
+			case "$id", "$schema":
+				return isString && !root
+			case "$anchor":
+				return isString
+			}
+			return false
+		})
+		for i := range val.Members {
+			m := &val.Members[i]
+			if skip, childMap := walkMember(inMap, memberName(m)); !skip {
+				stripIdentifiers(&m.Value, false, childMap)
+			}
+		}
+	case *hujson.Array:
+		for i := range val.Elements {
+			stripIdentifiers(&val.Elements[i], false, false)
+		}
+	}
+}
+
+// bundleAll resolves $refs in every retrieved schema in place
+// docs holds each declaration's source document as JSON. Declarations that
+// are fragments of a shared document, e.g. expanded OpenAPI components, are
+// siblings: a $ref from one to another embeds it under the sibling's ID.
+func bundleAll(ctx context.Context, decls []parser.Declaration, results []RetrievedSchema, docs []json.RawMessage, opts Options, loader *refLoader) error {
+	bases := make([]string, len(decls))
+	pointers := make([]string, len(decls))
+	siblings := make(map[string]string)
+	for i, d := range decls {
+		base, err := baseURI(d)
+		if err != nil {
+			return err
+		}
+		bases[i] = base
+		if d.SourceType == parser.SourceURL || d.SourceType == parser.SourceFile {
+			_, pointers[i], _ = d.SourceLocation()
+		}
+		if pointers[i] != "" {
+			siblings[base+"#"+pointers[i]] = d.ID
+		}
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.Concurrency)
+
+	for i := range results {
+		g.Go(func() error {
+			bundled, err := bundleSchema(ctx, loader, opts.Refs, bases[i], docs[i], pointers[i], results[i].Schema, siblings)
+			if err != nil {
+				return fmt.Errorf("failed to resolve $refs in %s: %w", decls[i].Key(), err)
+			}
+			results[i].Schema = bundled
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// baseURI returns the URI relative $refs in a declaration's schema resolve against
+func baseURI(d parser.Declaration) (string, error) {
+	switch d.SourceType {
+	case parser.SourceURL:
+		u, _, err := d.SourceLocation()
+		return u, err
+	case parser.SourceFile:
+		p, err := d.FilePath()
+		if err != nil {
+			return "", err
+		}
+		return fileURI(p)
+	default:
+		// Inline schemas resolve relative to the config file declaring them
+		return fileURI(d.ConfigPath)
+	}
+}
+
+// isFileURI reports whether uri names a local file
+func isFileURI(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && u.Scheme == "file"
+}
+
+func fileURI(p string) (string, error) {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String(), nil
+}
+
+func resolveURI(base, ref string) (*url.URL, error) {
+	b, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+	return b.ResolveReference(r), nil
+}
+
+// resolveBase applies an $id to base, ignoring any fragment
+func resolveBase(base, id string) string {
+	u, err := resolveURI(base, id)
+	if err != nil {
+		return base
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u.String()
+}
+
+// extractPointer returns the value at a JSON Pointer in doc as a standalone
+// document, or doc itself for an empty pointer
+func extractPointer(doc json.RawMessage, pointer string) (json.RawMessage, error) {
+	if pointer == "" {
+		return doc, nil
+	}
+	parsed, err := hujson.Parse(bytes.Clone(doc))
+	if err != nil {
+		return nil, err
+	}
+	v, err := lookupPointer(&parsed, pointer, nil)
+	if err != nil {
+		return nil, err
+	}
+	out := *v
+	out.BeforeExtra, out.AfterExtra = nil, nil
+	return json.RawMessage(out.Pack()), nil
+}
+
+// lookupPointer finds the value at a JSON Pointer (RFC 6901), calling visit
+// for each object passed through on the way, excluding the value itself
+func lookupPointer(root *hujson.Value, pointer string, visit func(*hujson.Object)) (*hujson.Value, error) {
+	if pointer == "" {
+		return root, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON Pointer %q", pointer)
+	}
+
+	v := root
+	for _, tok := range strings.Split(pointer[1:], "/") {
+		tok = unescapeToken(tok)
+		switch val := v.Value.(type) {
+		case *hujson.Object:
+			if visit != nil {
+				visit(val)
+			}
+			next := findMember(val, tok)
+			if next == nil {
+				return nil, fmt.Errorf("#%s not found: no member %q", pointer, tok)
+			}
+			v = next
+		case *hujson.Array:
+			i, err := strconv.Atoi(tok)
+			if err != nil || i < 0 || i >= len(val.Elements) {
+				return nil, fmt.Errorf("#%s not found: no array index %q", pointer, tok)
+			}
+			v = &val.Elements[i]
+		default:
+			return nil, fmt.Errorf("#%s not found: %q is not inside an object or array", pointer, tok)
+		}
+	}
+	return v, nil
+}
+
+// withinPointer reports whether pointer is prefix or a location inside it
+func withinPointer(pointer, prefix string) bool {
+	return pointer == prefix || strings.HasPrefix(pointer, prefix+"/")
+}
+
+func memberName(m *hujson.ObjectMember) string {
+	name, _ := stringValue(&m.Name)
+	return name
+}
+
+func findMember(obj *hujson.Object, name string) *hujson.Value {
+	for i := range obj.Members {
+		if memberName(&obj.Members[i]) == name {
+			return &obj.Members[i].Value
+		}
+	}
+	return nil
+}
+
+func stringMember(obj *hujson.Object, name string) (string, bool) {
+	if v := findMember(obj, name); v != nil {
+		return stringValue(v)
+	}
+	return "", false
+}
+
+func stringValue(v *hujson.Value) (string, bool) {
+	lit, ok := v.Value.(hujson.Literal)
+	if !ok || lit.Kind() != '"' {
+		return "", false
+	}
+	return lit.String(), true
+}
+
+// escapeToken and unescapeToken encode JSON Pointer reference tokens (RFC 6901)
+func escapeToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~", "~0"), "/", "~1")
+}
+
+func unescapeToken(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "~1", "/"), "~0", "~")
+}
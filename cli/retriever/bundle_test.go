@@ -0,0 +1,395 @@
+package retriever
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xschemadev/xschema/parser"
+)
+
+// writeSchemas writes files into a temp dir and returns the dir
+func writeSchemas(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func bundleFile(t *testing.T, dir, name string, mode RefMode) (map[string]any, error) {
+	t.Helper()
+	schema, err := readSchemaFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := fileURI(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := bundleSchema(context.Background(), newRefLoader(DefaultOptions(), nil, nil), mode, base, schema, "", schema, nil)
+	if err != nil {
+		return nil, err
+	}
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("bundle is not valid JSON: %v\n%s", err, out)
+	}
+	return got, nil
+}
+
+func assertJSON(t *testing.T, got any, want string) {
+	t.Helper()
+	var w any
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, w) {
+		g, _ := json.MarshalIndent(got, "", "  ")
+		t.Errorf("unexpected bundle:\n%s\nwant:\n%s", g, want)
+	}
+}
+
+func TestBundleDefs(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"user.json": `{
+			"type": "object",
+			"properties": {
+				"address": {"$ref": "address.json"},
+				"street": {"$ref": "address.json#/properties/street"},
+				"friend": {"$ref": "#"}
+			}
+		}`,
+		"address.json": `{
+			"$id": "address.json",
+			"$schema": "https://json-schema.org/draft/2020-12/schema",
+			"type": "object",
+			"properties": {
+				"street": {"type": "string"},
+				"owner": {"$ref": "user.json"},
+				"geo": {"$ref": "#/$defs/geo"}
+			},
+			"$defs": {"geo": {"type": "array"}}
+		}`,
+	})
+
+	got, err := bundleFile(t, dir, "user.json", RefsDefs)
+	if err != nil {
+		t.Fatalf("bundle failed: %v", err)
+	}
+	assertJSON(t, got, `{
+		"type": "object",
+		"properties": {
+			"address": {"$ref": "#/$defs/address"},
+			"street": {"$ref": "#/$defs/address/properties/street"},
+			"friend": {"$ref": "#"}
+		},
+		"$defs": {
+			"address": {
+				"type": "object",
+				"properties": {
+					"street": {"type": "string"},
+					"owner": {"$ref": "#"},
+					"geo": {"$ref": "#/$defs/address/$defs/geo"}
+				},
+				"$defs": {"geo": {"type": "array"}}
+			}
+		}
+	}`)
+}
+
+func TestBundleUnchangedWithoutExternalRefs(t *testing.T) {
+	schema := json.RawMessage(`{"properties": {"a": {"$ref": "#/$defs/a"}}, "$defs": {"a": {"type": "string"}}}`)
+	out, err := bundleSchema(context.Background(), newRefLoader(DefaultOptions(), nil, nil), RefsDefs, "file:///schemas/a.json", schema, "", schema, nil)
+	if err != nil {
+		t.Fatalf("bundle failed: %v", err)
+	}
+	if string(out) != string(schema) {
+		t.Errorf("expected schema to be returned unchanged, got %s", out)
+	}
+}
+
+func TestBundleDefsNameCollision(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"root.json": `{"$defs": {"name": {"type": "null"}}, "properties": {"n": {"$ref": "name.json"}}}`,
+		"name.json": "{\"type\": \"string\"}\n",
+	})
+
+	got, err := bundleFile(t, dir, "root.json", RefsDefs)
+	if err != nil {
+		t.Fatalf("bundle failed: %v", err)
+	}
+	assertJSON(t, got, `{
+		"$defs": {"name": {"type": "null"}, "name_2": {"type": "string"}},
+		"properties": {"n": {"$ref": "#/$defs/name_2"}}
+	}`)
+}
+
+func TestBundleAnchorsAndEmbeddedIDs(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"root.json": `{
+			"properties": {
+				"a": {"$ref": "#name"},
+				"b": {"$ref": "https://example.com/item.json"}
+			},
+			"$defs": {
+				"n": {"$anchor": "name", "type": "string"},
+				"item": {"$id": "https://example.com/item.json", "type": "integer"}
+			}
+		}`,
+	})
+
+	got, err := bundleFile(t, dir, "root.json", RefsDefs)
+	if err != nil {
+		t.Fatalf("bundle failed: %v", err)
+	}
+	assertJSON(t, got, `{
+		"properties": {
+			"a": {"$ref": "#/$defs/n"},
+			"b": {"$ref": "#/$defs/item"}
+		},
+		"$defs": {
+			"n": {"type": "string"},
+			"item": {"type": "integer"}
+		}
+	}`)
+}
+
+func TestBundleInline(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"root.json": `{
+			"properties": {
+				"id": {"$ref": "common.json#/$defs/id"},
+				"name": {"$ref": "common.json#/$defs/name", "description": "display name"}
+			}
+		}`,
+		"common.json": `{
+			"$defs": {
+				"id": {"type": "integer", "minimum": 1},
+				"name": {"$ref": "#/$defs/str"},
+				"str": {"type": "string"}
+			}
+		}`,
+	})
+
+	got, err := bundleFile(t, dir, "root.json", RefsInline)
+	if err != nil {
+		t.Fatalf("bundle failed: %v", err)
+	}
+	assertJSON(t, got, `{
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"name": {"description": "display name", "allOf": [{"type": "string"}]}
+		}
+	}`)
+}
+
+func TestBundlePropertiesNamedLikeKeywords(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"root.json": `{
+			"properties": {
+				"default": {"$ref": "value.json"},
+				"enum": {"properties": {"const": {"$ref": "value.json"}}}
+			},
+			"default": {"$ref": "value.json"}
+		}`,
+		"value.json": `{"type": "string"}`,
+	})
+
+	got, err := bundleFile(t, dir, "root.json", RefsDefs)
+	if err != nil {
+		t.Fatalf("bundle failed: %v", err)
+	}
+	assertJSON(t, got, `{
+		"properties": {
+			"default": {"$ref": "#/$defs/value"},
+			"enum": {"properties": {"const": {"$ref": "#/$defs/value"}}}
+		},
+		"default": {"$ref": "value.json"},
+		"$defs": {"value": {"type": "string"}}
+	}`)
+
+	got, err = bundleFile(t, dir, "root.json", RefsInline)
+	if err != nil {
+		t.Fatalf("bundle failed: %v", err)
+	}
+	assertJSON(t, got, `{
+		"properties": {
+			"default": {"type": "string"},
+			"enum": {"properties": {"const": {"type": "string"}}}
+		},
+		"default": {"$ref": "value.json"}
+	}`)
+}
+
+func TestBundleInlineCycle(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"node.json": `{"properties": {"next": {"$ref": "#"}}}`,
+	})
+
+	_, err := bundleFile(t, dir, "node.json", RefsInline)
+	var cycleErr *RefCycleError
+	if !errors.As(err, &cycleErr) {
+		t.Fatalf("expected *RefCycleError, got %v", err)
+	}
+	if len(cycleErr.Chain) != 2 {
+		t.Errorf("expected a two-step chain, got %v", cycleErr.Chain)
+	}
+
+	// The same schema bundles fine as $defs
+	if _, err := bundleFile(t, dir, "node.json", RefsDefs); err != nil {
+		t.Errorf("defs mode should keep recursive schemas: %v", err)
+	}
+}
+
+func TestBundleMissingTarget(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"root.json":     `{"properties": {"a": {"$ref": "other.json#/$defs/missing"}}}`,
+		"other.json":    `{"$defs": {}}`,
+		"dangling.json": `{"$ref": "nope.json"}`,
+	})
+
+	if _, err := bundleFile(t, dir, "root.json", RefsDefs); err == nil {
+		t.Error("expected error for missing $ref target")
+	}
+	if _, err := bundleFile(t, dir, "dangling.json", RefsDefs); err == nil {
+		t.Error("expected error for missing document")
+	}
+}
+
+func TestRetrieveBundlesRemoteRefs(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/a.json":
+			w.Write([]byte(`{"properties": {"c": {"$ref": "common.json"}}}`))
+		case "/b.json":
+			w.Write([]byte(`{"items": {"$ref": "common.json"}}`))
+		case "/common.json":
+			w.Write([]byte(`{"type": "string"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	decls := []parser.Declaration{
+		{Namespace: "test", ID: "A", SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + `/a.json"`), Adapter: "zod"},
+		{Namespace: "test", ID: "B", SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + `/b.json"`), Adapter: "zod"},
+	}
+
+	schemas, err := Retrieve(context.Background(), decls, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("expected the shared reference to be fetched once (3 requests), got %d", n)
+	}
+
+	var a map[string]any
+	if err := json.Unmarshal(schemas[0].Schema, &a); err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, a, `{"properties": {"c": {"$ref": "#/$defs/common"}}, "$defs": {"common": {"type": "string"}}}`)
+
+	if string(schemas[0].Raw) != `{"properties": {"c": {"$ref": "common.json"}}}` {
+		t.Errorf("expected Raw to hold the document as served, got %s", schemas[0].Raw)
+	}
+}
+
+func TestRetrieveRejectsLocalFileRefsFromRemoteSchemas(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{"secret.json": `{"secret": "hunter2"}`})
+	secret, err := fileURI(filepath.Join(dir, "secret.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/absolute.json":
+			w.Write([]byte(`{"properties": {"s": {"$ref": "` + secret + `"}}}`))
+		case "/relative.json":
+			// A file: $id makes the relative ref resolve to a local file
+			w.Write([]byte(`{"$id": "` + strings.TrimSuffix(secret, "secret.json") + `remote.json", "properties": {"s": {"$ref": "secret.json"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	for _, mode := range []RefMode{RefsDefs, RefsInline} {
+		for _, path := range []string{"/absolute.json", "/relative.json"} {
+			t.Run(string(mode)+path, func(t *testing.T) {
+				opts := DefaultOptions()
+				opts.Refs = mode
+				decls := []parser.Declaration{
+					{Namespace: "test", ID: "Remote", SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + path + `"`), Adapter: "zod"},
+				}
+				schemas, err := Retrieve(context.Background(), decls, opts)
+				if err == nil || !strings.Contains(err.Error(), "cannot refer to the local file") {
+					t.Fatalf("expected the local file ref to be rejected, got %v", err)
+				}
+				if len(schemas) > 0 && strings.Contains(string(schemas[0].Schema), "hunter2") {
+					t.Errorf("local file was bundled: %s", schemas[0].Schema)
+				}
+			})
+		}
+	}
+}
+
+func TestParseRefMode(t *testing.T) {
+	for in, want := range map[string]RefMode{"": RefsDefs, "defs": RefsDefs, "inline": RefsInline} {
+		got, err := ParseRefMode(in)
+		if err != nil || got != want {
+			t.Errorf("ParseRefMode(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseRefMode("flatten"); err == nil {
+		t.Error("expected error for unknown ref mode")
+	}
+}
+
+func TestRetrieveNamesSiblingComponentsByID(t *testing.T) {
+	const doc = "openapi: 3.1.0\ncomponents:\n  schemas:\n    Pet:\n      properties:\n        owner: {$ref: '#/components/schemas/Owner'}\n    Owner: {type: object}\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+
+	source := func(name string) json.RawMessage {
+		return json.RawMessage(`"` + srv.URL + `/openapi.yaml#/components/schemas/` + name + `"`)
+	}
+	decls := []parser.Declaration{
+		{Namespace: "api", ID: "ApiPet", SourceType: parser.SourceURL, Source: source("Pet"), Adapter: "zod", Expanded: true},
+		{Namespace: "api", ID: "ApiOwner", SourceType: parser.SourceURL, Source: source("Owner"), Adapter: "zod", Expanded: true},
+	}
+
+	schemas, err := Retrieve(context.Background(), decls, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+
+	var pet map[string]any
+	if err := json.Unmarshal(schemas[0].Schema, &pet); err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, pet, `{
+		"properties": {"owner": {"$ref": "#/$defs/ApiOwner"}},
+		"$defs": {"ApiOwner": {"type": "object"}}
+	}`)
+	if string(schemas[1].Schema) != `{"type":"object"}` {
+		t.Errorf("unexpected sibling schema: %s", schemas[1].Schema)
+	}
+	if string(schemas[0].Raw) != doc {
+		t.Errorf("expected Raw to hold the YAML as served, got %s", schemas[0].Raw)
+	}
+}
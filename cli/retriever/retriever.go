@@ -3,17 +3,21 @@ package retriever
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/xschemadev/xschema/cache"
 	"github.com/xschemadev/xschema/parser"
 	"github.com/xschemadev/xschema/ui"
+	"github.com/xschemadev/xschema/yamlconv"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -21,8 +25,10 @@ const (
 	defaultRetries     = 3
 	defaultConcurrency = 10
 	defaultHTTPTimeout = 30 * time.Second
+	defaultCacheTTL    = time.Hour
 	retryBaseDelay     = 500 * time.Millisecond
 	userAgent          = "xschema-cli/1.0"
+	acceptHeader       = "application/schema+json, application/json, application/yaml;q=0.9, */*;q=0.8"
 )
 
 // Options configures retrieval behavior
@@ -30,7 +36,20 @@ type Options struct {
 	Concurrency int
 	HTTPTimeout time.Duration
 	Retries     int
-	NoCache     bool
+	NoCache     bool          // disables both the in-memory and on-disk caches
+	CacheDir    string        // on-disk URL cache location; empty disables it
+	CacheTTL    time.Duration // how long a cached URL is used before revalidating; 0 always revalidates
+
+	// Offline serves URL sources from the on-disk cache only and never touches the network
+	Offline bool
+	// Pinned maps qualified declaration keys to locked content digests
+	// (sha256), which offline mode prefers over the URL's latest cache entry.
+	// Plain keys, from lockfiles written before keys named the language, pin
+	// the declaration in every language.
+	Pinned map[string]string
+
+	// Refs selects how $refs are bundled into each schema; empty means RefsDefs
+	Refs RefMode
 }
 
 // DefaultOptions returns sensible defaults
@@ -40,6 +59,8 @@ func DefaultOptions() Options {
 		HTTPTimeout: defaultHTTPTimeout,
 		Retries:     defaultRetries,
 		NoCache:     false,
+		CacheTTL:    defaultCacheTTL,
+		Refs:        RefsDefs,
 	}
 }
 
@@ -47,8 +68,13 @@ func DefaultOptions() Options {
 type RetrievedSchema struct {
 	Namespace string
 	ID        string
-	Schema    json.RawMessage
+	Schema    json.RawMessage // self-contained schema with $refs bundled
+	Raw       json.RawMessage // document as retrieved (JSON, or YAML as served), before $ref bundling
 	Adapter   string
+	Options   map[string]json.RawMessage // adapter options from the declaration
+	Dir       string                     // package root the adapter runs in; "" for the current directory
+	Language  string                     // language of the declaring config, e.g. "typescript"
+	VarName   string                     // identifier of the generated code, assigned per language before generation
 }
 
 // Key returns the full namespaced key like "namespace:id"
@@ -56,6 +82,11 @@ func (r RetrievedSchema) Key() string {
 	return r.Namespace + ":" + r.ID
 }
 
+// QualifiedKey prefixes Key with the language, like "typescript/namespace:id"
+func (r RetrievedSchema) QualifiedKey() string {
+	return r.Language + "/" + r.Key()
+}
+
 // schemaCache caches retrieved schemas
 type schemaCache struct {
 	mu    sync.RWMutex
@@ -81,6 +112,139 @@ func (c *schemaCache) set(key string, val json.RawMessage) {
 
 // retrieveFromURL fetches a JSON schema from a URL with retry
 func retrieveFromURL(ctx context.Context, url string, opts Options) (json.RawMessage, error) {
+	resp, err := fetchURL(ctx, url, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.body, nil
+}
+
+// retrieveFromURLCached serves url from the on-disk store while fresh, and
+// otherwise revalidates it with a conditional request before refetching
+func retrieveFromURLCached(ctx context.Context, url string, opts Options, store *cache.Store) (json.RawMessage, error) {
+	entry, body, err := store.Lookup(url)
+	if err != nil {
+		ui.Verbosef("disk cache lookup failed: url=%s, error=%v", url, err)
+	}
+
+	if entry != nil && entry.Fresh(opts.CacheTTL, time.Now()) {
+		ui.Verbosef("disk cache hit: url=%s, age=%s", url, ui.FormatDuration(time.Since(entry.FetchedAt)))
+		return json.RawMessage(body), nil
+	}
+
+	resp, err := fetchURL(ctx, url, opts, entry)
+	if err != nil {
+		// A stale copy beats failing the whole run when the server is
+		// unreachable, but not when it says the schema is gone (404, 410)
+		var unavailable *unavailableError
+		if entry != nil && ctx.Err() == nil && errors.As(err, &unavailable) {
+			ui.WarnMsg(fmt.Sprintf("Using the copy of %s cached %s ago: %v",
+				url, ui.FormatDuration(time.Since(entry.FetchedAt)), err))
+			return json.RawMessage(body), nil
+		}
+		return nil, err
+	}
+
+	if resp.notModified {
+		ui.Verbosef("disk cache revalidated: url=%s", url)
+		if err := store.Touch(*entry, time.Now()); err != nil {
+			ui.Verbosef("failed to update cache entry: url=%s, error=%v", url, err)
+		}
+		return json.RawMessage(body), nil
+	}
+
+	if _, err := store.Put(url, resp.body, resp.etag, resp.lastModified, time.Now()); err != nil {
+		ui.Verbosef("failed to write disk cache: url=%s, error=%v", url, err)
+	}
+	return resp.body, nil
+}
+
+// unavailableError is a fetch that failed because the server could not be
+// reached or answered with a 5xx status; a cached copy may stand in for it
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// OfflineError lists URL declarations that offline mode could not satisfy
+type OfflineError struct {
+	Missing []parser.Declaration
+}
+
+func (e *OfflineError) Error() string {
+	lines := make([]string, len(e.Missing))
+	for i, d := range e.Missing {
+		var url string
+		json.Unmarshal(d.Source, &url)
+		lines[i] = fmt.Sprintf("  %s (%s)", d.Key(), url)
+	}
+	return fmt.Sprintf("offline: %d URL schema(s) not available in the cache or lockfile:\n%s",
+		len(e.Missing), strings.Join(lines, "\n"))
+}
+
+// retrieveOffline serves every URL declaration from the store without network
+// access, preferring the locked content digest over the URL's latest entry.
+// Returns schemas by declaration index, or an *OfflineError listing all misses.
+func retrieveOffline(decls []parser.Declaration, opts Options, store *cache.Store) (map[int]json.RawMessage, error) {
+	found := make(map[int]json.RawMessage)
+	var missing []parser.Declaration
+
+	for i, d := range decls {
+		if d.SourceType != parser.SourceURL {
+			continue
+		}
+
+		if store != nil {
+			digest, ok := opts.Pinned[d.QualifiedKey()]
+			if !ok {
+				digest, ok = opts.Pinned[d.Key()]
+			}
+			if ok {
+				if body, ok := store.Blob(digest); ok {
+					ui.Verbosef("offline: serving locked content: schema=%s, sha256=%s", d.Key(), digest)
+					found[i] = json.RawMessage(body)
+					continue
+				}
+			}
+
+			url, _, err := d.SourceLocation()
+			if err != nil {
+				return nil, err
+			}
+			if entry, body, err := store.Lookup(url); err == nil && entry != nil {
+				ui.Verbosef("offline: serving cached URL: schema=%s, url=%s, age=%s", d.Key(), url, ui.FormatDuration(time.Since(entry.FetchedAt)))
+				found[i] = json.RawMessage(body)
+				continue
+			}
+		}
+
+		missing = append(missing, d)
+	}
+
+	if len(missing) > 0 {
+		return nil, &OfflineError{Missing: missing}
+	}
+	return found, nil
+}
+
+// urlResponse is the result of fetching a URL
+type urlResponse struct {
+	body         json.RawMessage
+	etag         string
+	lastModified string
+	notModified  bool // server answered 304 to a conditional request
+}
+
+// fetchURL performs the HTTP request with retry
+// If cached is non-nil, its validators are sent as If-None-Match/If-Modified-Since
+func fetchURL(ctx context.Context, url string, opts Options, cached *cache.Entry) (*urlResponse, error) {
 	client := &http.Client{Timeout: opts.HTTPTimeout}
 	var lastErr error
 
@@ -107,6 +271,15 @@ func retrieveFromURL(ctx context.Context, url string, opts Options) (json.RawMes
 			return nil, fmt.Errorf("failed to create request for %s: %w", url, err)
 		}
 		req.Header.Set("User-Agent", userAgent)
+		req.Header.Set("Accept", acceptHeader)
+		if cached != nil {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			}
+			if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
 
 		resp, err := client.Do(req)
 		if err != nil {
@@ -130,22 +303,38 @@ func retrieveFromURL(ctx context.Context, url string, opts Options) (json.RawMes
 			continue
 		}
 
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			return &urlResponse{notModified: true}, nil
+		}
+
 		if resp.StatusCode != http.StatusOK {
 			return nil, fmt.Errorf("failed to fetch %s: status %d", url, resp.StatusCode)
 		}
 
+		// YAML is kept as served, so cache and lock digests match the server;
+		// decodeURLDocument converts it when the document is used
 		if !json.Valid(data) {
-			return nil, fmt.Errorf("invalid JSON from %s", url)
+			if !yamlconv.IsYAMLPath(url) && !yamlconv.IsYAMLMediaType(resp.Header.Get("Content-Type")) {
+				return nil, fmt.Errorf("invalid JSON from %s", url)
+			}
+			if _, err := yamlconv.ToJSON(data); err != nil {
+				return nil, fmt.Errorf("invalid YAML from %s: %w", url, err)
+			}
 		}
 
 		ui.Verbosef("successfully fetched from URL: url=%s, status=%d, bytes=%d", url, resp.StatusCode, len(data))
-		return json.RawMessage(data), nil
+		return &urlResponse{
+			body:         json.RawMessage(data),
+			etag:         resp.Header.Get("ETag"),
+			lastModified: resp.Header.Get("Last-Modified"),
+		}, nil
 	}
 
-	return nil, lastErr
+	// Every attempt failed to reach the server or got a 5xx status
+	return nil, &unavailableError{err: lastErr}
 }
 
-// retrieveFromFile reads a JSON schema from a file relative to the config file
+// retrieveFromFile reads a JSON or YAML schema from a file relative to the config file
 func retrieveFromFile(ctx context.Context, filePath string, configPath string) (json.RawMessage, error) {
 	select {
 	case <-ctx.Done():
@@ -158,13 +347,26 @@ func retrieveFromFile(ctx context.Context, filePath string, configPath string) (
 	fullPath := filepath.Join(configDir, filePath)
 
 	ui.Verbosef("reading file: %s (relative to %s)", fullPath, configDir)
+	return readSchemaFile(fullPath)
+}
 
+// readSchemaFile reads and validates a JSON schema file, converting YAML files to JSON
+func readSchemaFile(fullPath string) (json.RawMessage, error) {
 	data, err := os.ReadFile(fullPath)
 	if err != nil {
 		ui.Verbosef("failed to read file: path=%s, error=%v", fullPath, err)
 		return nil, fmt.Errorf("failed to read %s: %w", fullPath, err)
 	}
 
+	if yamlconv.IsYAMLPath(fullPath) {
+		converted, err := yamlconv.ToJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fullPath, err)
+		}
+		ui.Verbosef("successfully read YAML file: path=%s, bytes=%d", fullPath, len(data))
+		return converted, nil
+	}
+
 	if !json.Valid(data) {
 		ui.Verbosef("invalid JSON in file: %s", fullPath)
 		return nil, fmt.Errorf("invalid JSON in %s", fullPath)
@@ -174,24 +376,98 @@ func retrieveFromFile(ctx context.Context, filePath string, configPath string) (
 	return json.RawMessage(data), nil
 }
 
+// decodeURLDocument converts a document fetched from url to JSON
+// URL bodies are cached and locked as served, so YAML is converted on every
+// use. fetchURL only accepts bodies that are JSON or valid YAML, so anything
+// that is not JSON here is YAML, whatever the URL or Content-Type said.
+func decodeURLDocument(url string, data json.RawMessage) (json.RawMessage, error) {
+	if json.Valid(data) {
+		return data, nil
+	}
+	converted, err := yamlconv.ToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", url, err)
+	}
+	return converted, nil
+}
+
+// DocumentLoader returns a parser.DocumentLoader that reads url and file
+// documents through the same on-disk cache and offline rules as Retrieve
+func DocumentLoader(opts Options) parser.DocumentLoader {
+	return func(ctx context.Context, d parser.Declaration) ([]byte, error) {
+		if d.SourceType != parser.SourceURL && d.SourceType != parser.SourceFile {
+			return nil, fmt.Errorf("cannot load %s source %s", d.SourceType, d.Source)
+		}
+		if opts.Offline && (opts.NoCache || opts.CacheDir == "") {
+			return nil, fmt.Errorf("offline mode requires the on-disk schema cache")
+		}
+
+		var store *cache.Store
+		if !opts.NoCache && opts.CacheDir != "" {
+			var err error
+			store, err = cache.Open(opts.CacheDir)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		uri, err := baseURI(d)
+		if err != nil {
+			return nil, err
+		}
+		return newRefLoader(opts, store, nil).load(ctx, uri)
+	}
+}
+
 // Retrieve fetches all schemas from declarations
 func Retrieve(ctx context.Context, decls []parser.Declaration, opts Options) ([]RetrievedSchema, error) {
 	if len(decls) == 0 {
 		return nil, nil
 	}
 
-	var cache *schemaCache
+	if opts.Offline && (opts.NoCache || opts.CacheDir == "") {
+		return nil, fmt.Errorf("offline mode requires the on-disk schema cache")
+	}
+
+	var memCache *schemaCache
+	var store *cache.Store
 	if !opts.NoCache {
-		cache = newSchemaCache()
+		memCache = newSchemaCache()
+		if opts.CacheDir != "" {
+			var err error
+			store, err = cache.Open(opts.CacheDir)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Resolve every URL up front in offline mode so all misses are reported together
+	var offline map[int]json.RawMessage
+	if opts.Offline {
+		var err error
+		offline, err = retrieveOffline(decls, opts, store)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	results := make([]RetrievedSchema, len(decls))
 
-	ui.Verbosef("retrieving schemas: count=%d, concurrency=%d, cache_enabled=%v", len(decls), opts.Concurrency, cache != nil)
+	ui.Verbosef("retrieving schemas: count=%d, concurrency=%d, cache_enabled=%v, disk_cache=%s", len(decls), opts.Concurrency, memCache != nil, opts.CacheDir)
 
-	g, ctx := errgroup.WithContext(ctx)
+	g, gctx := errgroup.WithContext(ctx)
 	g.SetLimit(opts.Concurrency)
 
+	// Declarations sharing a document, e.g. fragments of one OpenAPI file,
+	// fetch it once; each declaration's JSON Pointer is applied afterwards
+	cacheKeys := make([]string, len(decls))
+	locations := make([]string, len(decls))
+	pointers := make([]string, len(decls))
+	scheduled := make(map[string]bool)
+	var docsMu sync.Mutex
+	docs := make(map[string]json.RawMessage)
+
 	for i, decl := range decls {
 		idx, d := i, decl
 
@@ -199,32 +475,38 @@ func Retrieve(ctx context.Context, decls []parser.Declaration, opts Options) ([]
 		var cacheKey string
 		switch d.SourceType {
 		case parser.SourceURL:
-			var url string
-			if err := json.Unmarshal(d.Source, &url); err != nil {
-				return nil, fmt.Errorf("invalid URL source for %s: %w", d.Key(), err)
+			location, pointer, err := d.SourceLocation()
+			if err != nil {
+				return nil, err
 			}
-			cacheKey = "url:" + url
+			locations[idx], pointers[idx] = location, pointer
+			cacheKey = "url:" + location
 		case parser.SourceFile:
-			var filePath string
-			if err := json.Unmarshal(d.Source, &filePath); err != nil {
-				return nil, fmt.Errorf("invalid file source for %s: %w", d.Key(), err)
+			fullPath, err := d.FilePath()
+			if err != nil {
+				return nil, err
 			}
-			cacheKey = "file:" + filepath.Join(filepath.Dir(d.ConfigPath), filePath)
+			locations[idx], pointers[idx], _ = d.SourceLocation()
+			cacheKey = "file:" + fullPath
 		case parser.SourceJSON:
 			// Inline JSON - use the declaration key as cache key
-			cacheKey = "json:" + d.Key()
+			cacheKey = "json:" + d.QualifiedKey()
 		}
+		cacheKeys[idx] = cacheKey
+
+		if scheduled[cacheKey] {
+			ui.Verbosef("sharing document: schema=%s, key=%s", d.Key(), cacheKey)
+			continue
+		}
+		scheduled[cacheKey] = true
 
 		// Check cache first (if enabled)
-		if cache != nil {
-			if cached, ok := cache.get(cacheKey); ok {
+		if memCache != nil {
+			if cached, ok := memCache.get(cacheKey); ok {
 				ui.Verbosef("cache hit: schema=%s, key=%s", d.Key(), cacheKey)
-				results[idx] = RetrievedSchema{
-					Namespace: d.Namespace,
-					ID:        d.ID,
-					Schema:    cached,
-					Adapter:   d.Adapter,
-				}
+				docsMu.Lock()
+				docs[cacheKey] = cached
+				docsMu.Unlock()
 				continue
 			}
 			ui.Verbosef("cache miss: schema=%s, key=%s", d.Key(), cacheKey)
@@ -236,17 +518,15 @@ func Retrieve(ctx context.Context, decls []parser.Declaration, opts Options) ([]
 
 			switch d.SourceType {
 			case parser.SourceURL:
-				var url string
-				if err := json.Unmarshal(d.Source, &url); err != nil {
-					return fmt.Errorf("invalid URL source for %s: %w", d.Key(), err)
+				if opts.Offline {
+					schema = offline[idx]
+				} else if store != nil {
+					schema, err = retrieveFromURLCached(gctx, locations[idx], opts, store)
+				} else {
+					schema, err = retrieveFromURL(gctx, locations[idx], opts)
 				}
-				schema, err = retrieveFromURL(ctx, url, opts)
 			case parser.SourceFile:
-				var filePath string
-				if err := json.Unmarshal(d.Source, &filePath); err != nil {
-					return fmt.Errorf("invalid file source for %s: %w", d.Key(), err)
-				}
-				schema, err = retrieveFromFile(ctx, filePath, d.ConfigPath)
+				schema, err = retrieveFromFile(gctx, locations[idx], d.ConfigPath)
 			case parser.SourceJSON:
 				// Inline JSON - source is already the schema
 				schema = d.Source
@@ -259,16 +539,13 @@ func Retrieve(ctx context.Context, decls []parser.Declaration, opts Options) ([]
 				return fmt.Errorf("failed to retrieve schema %s: %w", d.Key(), err)
 			}
 
-			if cache != nil {
-				cache.set(cacheKey, schema)
+			if memCache != nil {
+				memCache.set(cacheKey, schema)
 			}
 
-			results[idx] = RetrievedSchema{
-				Namespace: d.Namespace,
-				ID:        d.ID,
-				Schema:    schema,
-				Adapter:   d.Adapter,
-			}
+			docsMu.Lock()
+			docs[cacheKey] = schema
+			docsMu.Unlock()
 			return nil
 		})
 	}
@@ -277,6 +554,44 @@ func Retrieve(ctx context.Context, decls []parser.Declaration, opts Options) ([]
 		return nil, err
 	}
 
+	decoded := make(map[string]json.RawMessage)
+	jsonDocs := make([]json.RawMessage, len(decls))
+	for idx, d := range decls {
+		raw := docs[cacheKeys[idx]]
+		doc, ok := decoded[cacheKeys[idx]]
+		if !ok {
+			doc = raw
+			if d.SourceType == parser.SourceURL {
+				var err error
+				if doc, err = decodeURLDocument(locations[idx], raw); err != nil {
+					return nil, fmt.Errorf("failed to retrieve schema %s: %w", d.Key(), err)
+				}
+			}
+			decoded[cacheKeys[idx]] = doc
+		}
+
+		schema, err := extractPointer(doc, pointers[idx])
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: source %s#%s does not resolve: %w", d.Key(), locations[idx], pointers[idx], err)
+		}
+		jsonDocs[idx] = doc
+		results[idx] = RetrievedSchema{
+			Namespace: d.Namespace,
+			ID:        d.ID,
+			Schema:    schema,
+			Raw:       raw,
+			Adapter:   d.Adapter,
+			Options:   d.Options,
+			Dir:       d.PackageDir,
+			Language:  d.Language,
+		}
+	}
+
+	// Referenced documents go through the same caches as the declarations
+	if err := bundleAll(ctx, decls, results, jsonDocs, opts, newRefLoader(opts, store, memCache)); err != nil {
+		return nil, err
+	}
+
 	ui.Verbosef("retrieval complete: schemas=%d", len(results))
 	return results, nil
 }
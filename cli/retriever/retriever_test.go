@@ -3,11 +3,17 @@ package retriever
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/xschemadev/xschema/cache"
 	"github.com/xschemadev/xschema/parser"
 )
 
@@ -29,6 +35,7 @@ func TestRetrieveFromFile(t *testing.T) {
 		{"user schema", "user.json", "object", false},
 		{"post schema", "post.json", "object", false},
 		{"config schema", "config.json", "object", false},
+		{"yaml schema", "comment.yaml", "object", false},
 		{"invalid json", "invalid.txt", "", true},
 		{"not found", "nonexistent.json", "", true},
 	}
@@ -548,3 +555,291 @@ func TestDefaultOptions(t *testing.T) {
 		t.Error("expected NoCache false by default")
 	}
 }
+
+func TestRetrieveDiskCacheConditional(t *testing.T) {
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"type": "object"}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	opts := DefaultOptions()
+	opts.CacheDir = t.TempDir()
+	decls := []parser.Declaration{
+		{Namespace: "test", ID: "Remote", SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + `"`), Adapter: "zod"},
+	}
+
+	// First run fetches and stores
+	if _, err := Retrieve(ctx, decls, opts); err != nil {
+		t.Fatalf("first Retrieve failed: %v", err)
+	}
+	// Second run within TTL is served from disk without a request
+	if _, err := Retrieve(ctx, decls, opts); err != nil {
+		t.Fatalf("second Retrieve failed: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request within TTL, got %d", requests)
+	}
+
+	// With a zero TTL the entry is revalidated with If-None-Match
+	opts.CacheTTL = 0
+	schemas, err := Retrieve(ctx, decls, opts)
+	if err != nil {
+		t.Fatalf("third Retrieve failed: %v", err)
+	}
+	if requests != 2 || notModified != 1 {
+		t.Errorf("expected a conditional request answered with 304, got requests=%d notModified=%d", requests, notModified)
+	}
+	if string(schemas[0].Schema) != `{"type": "object"}` {
+		t.Errorf("expected cached body after 304, got %s", schemas[0].Schema)
+	}
+
+	// NoCache bypasses the disk cache entirely
+	opts.NoCache = true
+	if _, err := Retrieve(ctx, decls, opts); err != nil {
+		t.Fatalf("no-cache Retrieve failed: %v", err)
+	}
+	if requests != 3 || notModified != 1 {
+		t.Errorf("expected an unconditional request with NoCache, got requests=%d notModified=%d", requests, notModified)
+	}
+}
+
+func TestRetrieveDiskCacheStaleOnError(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"type": "string"}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	opts := DefaultOptions()
+	opts.CacheDir = t.TempDir()
+	opts.CacheTTL = 0
+	opts.Retries = 1
+	decls := []parser.Declaration{
+		{Namespace: "test", ID: "Remote", SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + `"`), Adapter: "zod"},
+	}
+
+	if _, err := Retrieve(ctx, decls, opts); err != nil {
+		t.Fatalf("first Retrieve failed: %v", err)
+	}
+
+	status = http.StatusServiceUnavailable
+	schemas, err := Retrieve(ctx, decls, opts)
+	if err != nil {
+		t.Fatalf("expected stale cache to be served, got error: %v", err)
+	}
+	if string(schemas[0].Schema) != `{"type": "string"}` {
+		t.Errorf("unexpected schema: %s", schemas[0].Schema)
+	}
+
+	// A schema the server no longer has is a failure, not a reason to use the cache
+	status = http.StatusNotFound
+	if _, err := Retrieve(ctx, decls, opts); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("expected the 404 to be reported, got %v", err)
+	}
+}
+
+func TestRetrieveOffline(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"type": "string"}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := cache.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The latest cache entry differs from the locked content
+	locked := []byte(`{"type": "object"}`)
+	if _, err := store.Put(srv.URL+"/pinned", locked, "", "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(srv.URL+"/pinned", []byte(`{"type": "number"}`), "", "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Put(srv.URL+"/cached", []byte(`{"type": "boolean"}`), "", "", time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	urlDecl := func(id, path string) parser.Declaration {
+		return parser.Declaration{Namespace: "test", ID: id, SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + path + `"`), Adapter: "zod"}
+	}
+
+	opts := DefaultOptions()
+	opts.CacheDir = dir
+	opts.Offline = true
+	opts.Pinned = map[string]string{"test:Pinned": cache.Digest(locked)}
+
+	t.Run("serves locked and cached content", func(t *testing.T) {
+		decls := []parser.Declaration{urlDecl("Pinned", "/pinned"), urlDecl("Cached", "/cached")}
+		schemas, err := Retrieve(ctx, decls, opts)
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		if string(schemas[0].Schema) != string(locked) {
+			t.Errorf("expected locked content, got %s", schemas[0].Schema)
+		}
+		if string(schemas[1].Schema) != `{"type": "boolean"}` {
+			t.Errorf("expected stale cached content, got %s", schemas[1].Schema)
+		}
+	})
+
+	t.Run("reports every missing declaration", func(t *testing.T) {
+		decls := []parser.Declaration{urlDecl("Pinned", "/pinned"), urlDecl("A", "/a"), urlDecl("B", "/b")}
+		_, err := Retrieve(ctx, decls, opts)
+		var offlineErr *OfflineError
+		if !errors.As(err, &offlineErr) {
+			t.Fatalf("expected *OfflineError, got %v", err)
+		}
+		if len(offlineErr.Missing) != 2 || offlineErr.Missing[0].Key() != "test:A" || offlineErr.Missing[1].Key() != "test:B" {
+			t.Errorf("unexpected missing declarations: %+v", offlineErr.Missing)
+		}
+	})
+
+	t.Run("requires the disk cache", func(t *testing.T) {
+		noCache := opts
+		noCache.NoCache = true
+		if _, err := Retrieve(ctx, []parser.Declaration{urlDecl("Pinned", "/pinned")}, noCache); err == nil {
+			t.Error("expected error for offline mode without a cache")
+		}
+	})
+
+	if requests != 0 {
+		t.Errorf("offline mode made %d network requests", requests)
+	}
+}
+
+func TestRetrieveFragments(t *testing.T) {
+	openapi := `{
+		"openapi": "3.1.0",
+		"components": {
+			"schemas": {
+				"User": {
+					"type": "object",
+					"properties": {
+						"address": {"$ref": "#/components/schemas/Address"},
+						"manager": {"$ref": "#/components/schemas/User"}
+					}
+				},
+				"Address": {"type": "object", "properties": {"city": {"type": "string"}}}
+			}
+		}
+	}`
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte(openapi))
+	}))
+	defer srv.Close()
+
+	dir := writeSchemas(t, map[string]string{
+		"defs.json": `{"$defs": {"Point": {"type": "array", "items": {"type": "number"}}}}`,
+	})
+	configPath := filepath.Join(dir, "shapes.jsonc")
+
+	decls := []parser.Declaration{
+		{Namespace: "api", ID: "User", SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + `/openapi.json#/components/schemas/User"`), Adapter: "zod"},
+		{Namespace: "api", ID: "Address", SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + `/openapi.json#/components/schemas/Address"`), Adapter: "zod"},
+		{Namespace: "shapes", ID: "Point", SourceType: parser.SourceFile, Source: json.RawMessage(`"./defs.json#/$defs/Point"`), Adapter: "zod", ConfigPath: configPath},
+	}
+
+	schemas, err := Retrieve(context.Background(), decls, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the shared document to be fetched once, got %d requests", n)
+	}
+
+	var user map[string]any
+	if err := json.Unmarshal(schemas[0].Schema, &user); err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, user, `{
+		"type": "object",
+		"properties": {
+			"address": {"$ref": "#/$defs/Address"},
+			"manager": {"$ref": "#"}
+		},
+		"$defs": {"Address": {"type": "object", "properties": {"city": {"type": "string"}}}}
+	}`)
+	if string(schemas[0].Raw) != openapi {
+		t.Error("expected Raw to hold the whole document")
+	}
+
+	var address, point any
+	json.Unmarshal(schemas[1].Schema, &address)
+	json.Unmarshal(schemas[2].Schema, &point)
+	assertJSON(t, address, `{"type": "object", "properties": {"city": {"type": "string"}}}`)
+	assertJSON(t, point, `{"type": "array", "items": {"type": "number"}}`)
+}
+
+func TestRetrieveFragmentNotFound(t *testing.T) {
+	dir := writeSchemas(t, map[string]string{
+		"defs.json": `{"$defs": {"Point": {"type": "array"}}}`,
+	})
+	decls := []parser.Declaration{
+		{Namespace: "shapes", ID: "Line", SourceType: parser.SourceFile, Source: json.RawMessage(`"./defs.json#/$defs/Line"`), Adapter: "zod", ConfigPath: filepath.Join(dir, "shapes.jsonc")},
+	}
+
+	_, err := Retrieve(context.Background(), decls, DefaultOptions())
+	if err == nil {
+		t.Fatal("expected error for unresolved fragment")
+	}
+	if !strings.Contains(err.Error(), "shapes:Line") || !strings.Contains(err.Error(), "/$defs/Line") {
+		t.Errorf("expected error naming the declaration and pointer, got: %v", err)
+	}
+}
+
+func TestRetrieveYAMLFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/schema":
+			w.Header().Set("Content-Type", "application/yaml")
+			w.Write([]byte("type: object\nproperties:\n  id: {type: integer}\n"))
+		case "/schema.yml":
+			w.Write([]byte("type: string\n"))
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>not a schema</html>"))
+		}
+	}))
+	defer srv.Close()
+
+	decl := func(id, path string) parser.Declaration {
+		return parser.Declaration{Namespace: "test", ID: id, SourceType: parser.SourceURL, Source: json.RawMessage(`"` + srv.URL + path + `"`), Adapter: "zod"}
+	}
+
+	schemas, err := Retrieve(context.Background(), []parser.Declaration{decl("ByType", "/schema"), decl("ByExt", "/schema.yml")}, DefaultOptions())
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	if got := string(schemas[0].Schema); got != `{"type":"object","properties":{"id":{"type":"integer"}}}` {
+		t.Errorf("unexpected schema from application/yaml response: %s", got)
+	}
+	if got := string(schemas[1].Schema); got != `{"type":"string"}` {
+		t.Errorf("unexpected schema from .yml URL: %s", got)
+	}
+
+	if _, err := Retrieve(context.Background(), []parser.Declaration{decl("Page", "/page")}, DefaultOptions()); err == nil {
+		t.Error("expected error for a non-JSON, non-YAML response")
+	}
+}
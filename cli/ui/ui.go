@@ -3,6 +3,7 @@ package ui
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/lipgloss"
@@ -99,6 +100,24 @@ func WarnMsg(msg string) {
 	fmt.Printf("%s %s\n", Warning.Render("!"), msg)
 }
 
+// PrintDiff prints a unified diff with added/removed lines colored
+func PrintDiff(diff string) {
+	for line := range strings.SplitSeq(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			fmt.Println(Bold.Render(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(Primary.Render(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(Success.Render(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(Error.Render(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
 // FormatDuration formats duration nicely (e.g., "234ms" or "1.2s")
 func FormatDuration(d time.Duration) string {
 	if d < time.Second {
@@ -0,0 +1,202 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/xschemadev/xschema/ui"
+)
+
+// DefaultDebounce is how long the watcher waits for a burst of events to settle
+const DefaultDebounce = 200 * time.Millisecond
+
+// Watcher watches a set of files, and the files created in a set of
+// directories, and reports debounced batches of changed paths.
+// Parent directories are watched instead of the files themselves so that editors
+// that save via rename/replace keep triggering events.
+type Watcher struct {
+	fs       *fsnotify.Watcher
+	debounce time.Duration
+
+	mu       sync.Mutex
+	files    map[string]bool        // absolute file paths we report changes for
+	fileDirs map[string]bool        // parent directories of files
+	created  map[string]bool        // directories whose new entries we report, if match allows
+	match    func(path string) bool // which new files in created directories to report
+	dirs     map[string]bool        // directories currently registered with fsnotify
+}
+
+// New creates a watcher with the given debounce interval
+func New(debounce time.Duration) (*Watcher, error) {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %w", err)
+	}
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	return &Watcher{
+		fs:       fsw,
+		debounce: debounce,
+		files:    make(map[string]bool),
+		fileDirs: make(map[string]bool),
+		created:  make(map[string]bool),
+		dirs:     make(map[string]bool),
+	}, nil
+}
+
+// SetFiles replaces the set of watched files
+// Directories no longer needed are unregistered; missing directories are skipped
+func (w *Watcher) SetFiles(paths []string) error {
+	files := make(map[string]bool, len(paths))
+	dirs := make(map[string]bool)
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", p, err)
+		}
+		files[abs] = true
+		dirs[filepath.Dir(abs)] = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files, w.fileDirs = files, dirs
+	w.register()
+
+	ui.Verbosef("watching files: files=%d, dirs=%d", len(w.files), len(w.dirs))
+	return nil
+}
+
+// SetCreated replaces the set of directories whose new entries are reported:
+// files for which match returns true, e.g. the files a glob would match, and
+// subdirectories, which the caller may want to watch in turn
+func (w *Watcher) SetCreated(dirs []string, match func(path string) bool) error {
+	created := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", dir, err)
+		}
+		created[abs] = true
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.created, w.match = created, match
+	w.register()
+
+	ui.Verbosef("watching for new files: dirs=%d", len(w.created))
+	return nil
+}
+
+// register makes the directories registered with fsnotify those of the
+// watched files and created directories; w.mu must be held
+func (w *Watcher) register() {
+	for dir := range w.dirs {
+		if !w.fileDirs[dir] && !w.created[dir] {
+			if err := w.fs.Remove(dir); err != nil {
+				ui.Verbosef("failed to unwatch directory: path=%s, error=%v", dir, err)
+			}
+			delete(w.dirs, dir)
+		}
+	}
+	for _, dirs := range []map[string]bool{w.fileDirs, w.created} {
+		for dir := range dirs {
+			if w.dirs[dir] {
+				continue
+			}
+			if err := w.fs.Add(dir); err != nil {
+				ui.Verbosef("failed to watch directory: path=%s, error=%v", dir, err)
+				continue
+			}
+			w.dirs[dir] = true
+		}
+	}
+}
+
+// Files returns the watched file paths in sorted order
+func (w *Watcher) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	files := make([]string, 0, len(w.files))
+	for f := range w.files {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// isWatched reports whether an event on path is one to report
+func (w *Watcher) isWatched(event fsnotify.Event) bool {
+	path := filepath.Clean(event.Name)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.files[path] {
+		return true
+	}
+	if !event.Has(fsnotify.Create) || !w.created[filepath.Dir(path)] {
+		return false
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return true
+	}
+	return w.match == nil || w.match(path)
+}
+
+// Run blocks until ctx is cancelled, calling onChange with each debounced batch
+// of changed paths (sorted). onChange runs on the Run goroutine, so events that
+// arrive while it is running are collected into the next batch.
+func (w *Watcher) Run(ctx context.Context, onChange func(paths []string)) error {
+	pending := make(map[string]bool)
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-w.fs.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Chmod) || !w.isWatched(event) {
+				continue
+			}
+			ui.Verbosef("file event: path=%s, op=%s", event.Name, event.Op)
+			pending[filepath.Clean(event.Name)] = true
+			timer.Reset(w.debounce)
+
+		case err, ok := <-w.fs.Errors:
+			if !ok {
+				return nil
+			}
+			ui.Verbosef("file watcher error: %v", err)
+
+		case <-timer.C:
+			if len(pending) == 0 {
+				continue
+			}
+			paths := make([]string, 0, len(pending))
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			clear(pending)
+			onChange(paths)
+		}
+	}
+}
+
+// Close releases the underlying file watcher
+func (w *Watcher) Close() error {
+	return w.fs.Close()
+}
@@ -0,0 +1,212 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runWatcher starts w.Run in the background and returns a channel of batches
+func runWatcher(t *testing.T, w *Watcher) (<-chan []string, context.CancelFunc, <-chan error) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := make(chan []string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- w.Run(ctx, func(paths []string) { batches <- paths })
+	}()
+	return batches, cancel, done
+}
+
+func TestWatcherDebouncesBurst(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "user.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	w, err := New(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer w.Close()
+	if err := w.SetFiles([]string{path}); err != nil {
+		t.Fatalf("SetFiles failed: %v", err)
+	}
+
+	batches, cancel, done := runWatcher(t, w)
+	defer cancel()
+
+	// Several writes in quick succession should produce a single batch
+	for i := range 5 {
+		if err := os.WriteFile(path, []byte(`{"v": `+string(rune('0'+i))+`}`), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	select {
+	case paths := <-batches:
+		if len(paths) != 1 || paths[0] != path {
+			t.Errorf("expected [%s], got %v", path, paths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for change batch")
+	}
+
+	select {
+	case paths := <-batches:
+		t.Errorf("expected a single batch, got another: %v", paths)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run returned error after cancel: %v", err)
+	}
+}
+
+func TestWatcherIgnoresUnwatchedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	watched := filepath.Join(tmpDir, "user.json")
+	other := filepath.Join(tmpDir, "other.json")
+	for _, p := range []string{watched, other} {
+		if err := os.WriteFile(p, []byte(`{}`), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	w, err := New(50 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer w.Close()
+	if err := w.SetFiles([]string{watched}); err != nil {
+		t.Fatalf("SetFiles failed: %v", err)
+	}
+
+	batches, cancel, _ := runWatcher(t, w)
+	defer cancel()
+
+	if err := os.WriteFile(other, []byte(`{"a": 1}`), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	select {
+	case paths := <-batches:
+		t.Errorf("expected no batch for unwatched file, got %v", paths)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestWatcherDetectsReplace(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "user.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	w, err := New(50 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer w.Close()
+	if err := w.SetFiles([]string{path}); err != nil {
+		t.Fatalf("SetFiles failed: %v", err)
+	}
+
+	batches, cancel, _ := runWatcher(t, w)
+	defer cancel()
+
+	// Editors often save by writing a temp file and renaming it over the original
+	tmp := filepath.Join(tmpDir, ".user.json.swp")
+	if err := os.WriteFile(tmp, []byte(`{"a": 1}`), 0644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("failed to rename: %v", err)
+	}
+
+	select {
+	case paths := <-batches:
+		if len(paths) != 1 || paths[0] != path {
+			t.Errorf("expected [%s], got %v", path, paths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for change batch")
+	}
+}
+
+func TestWatcherSetFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	sub := filepath.Join(tmpDir, "sub")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	w, err := New(0)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer w.Close()
+
+	if w.debounce != DefaultDebounce {
+		t.Errorf("expected default debounce, got %v", w.debounce)
+	}
+
+	a := filepath.Join(tmpDir, "a.json")
+	b := filepath.Join(sub, "b.json")
+	if err := w.SetFiles([]string{b, a, a}); err != nil {
+		t.Fatalf("SetFiles failed: %v", err)
+	}
+	files := w.Files()
+	if len(files) != 2 || files[0] != a || files[1] != b {
+		t.Errorf("unexpected files: %v", files)
+	}
+	if len(w.dirs) != 2 {
+		t.Errorf("expected 2 watched dirs, got %d", len(w.dirs))
+	}
+
+	// Shrinking the set unregisters directories that are no longer needed
+	if err := w.SetFiles([]string{a}); err != nil {
+		t.Fatalf("SetFiles failed: %v", err)
+	}
+	if len(w.dirs) != 1 || !w.dirs[tmpDir] {
+		t.Errorf("expected only %s watched, got %v", tmpDir, w.dirs)
+	}
+}
+
+func TestWatcherReportsCreatedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	w, err := New(50 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer w.Close()
+	if err := w.SetCreated([]string{tmpDir}, func(path string) bool { return filepath.Ext(path) == ".json" }); err != nil {
+		t.Fatalf("SetCreated failed: %v", err)
+	}
+
+	batches, cancel, _ := runWatcher(t, w)
+	defer cancel()
+
+	// Only new files match allows are reported
+	if err := os.WriteFile(filepath.Join(tmpDir, "notes.txt"), []byte("x"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	path := filepath.Join(tmpDir, "order.json")
+	if err := os.WriteFile(path, []byte(`{}`), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	select {
+	case paths := <-batches:
+		if len(paths) != 1 || paths[0] != path {
+			t.Errorf("expected [%s], got %v", path, paths)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for change batch")
+	}
+}
@@ -0,0 +1,227 @@
+package yamlconv
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// IsYAMLPath reports whether a file path or URL names a YAML document
+func IsYAMLPath(p string) bool {
+	if u, err := url.Parse(p); err == nil && u.Scheme != "" && u.Opaque == "" {
+		p = u.Path
+	}
+	switch strings.ToLower(path.Ext(p)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// IsYAMLMediaType reports whether a Content-Type header names YAML, including
+// structured suffixes such as application/openapi+yaml
+func IsYAMLMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+yaml")
+}
+
+// ToJSON converts a single YAML document to compact JSON
+// Mapping keys keep their order, so generated code lists properties as written.
+func ToJSON(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid YAML: %w", err)
+	}
+	if doc.Kind == 0 {
+		return nil, fmt.Errorf("invalid YAML: empty document")
+	}
+
+	var c converter
+	if err := c.writeNode(&doc, 0); err != nil {
+		return nil, err
+	}
+	return c.buf.Bytes(), nil
+}
+
+// Limits on alias expansion: recursive anchors fail instead of looping, and
+// documents whose aliases multiply into huge output ("billion laughs") fail
+// instead of exhausting memory
+const (
+	maxAliasDepth   = 100
+	maxAliases      = 10000
+	maxOutputLength = 64 << 20
+)
+
+// converter writes the JSON for a YAML document, counting alias expansions
+type converter struct {
+	buf     bytes.Buffer
+	aliases int
+}
+
+// expand follows an alias, failing once the limits on aliases are reached
+func (c *converter) expand(n *yaml.Node, depth int) (*yaml.Node, error) {
+	if depth >= maxAliasDepth {
+		return nil, fmt.Errorf("invalid YAML: alias *%s nests too deeply (line %d)", n.Value, n.Line)
+	}
+	if c.aliases++; c.aliases > maxAliases {
+		return nil, fmt.Errorf("invalid YAML: more than %d alias expansions (line %d)", maxAliases, n.Line)
+	}
+	return n.Alias, nil
+}
+
+func (c *converter) writeNode(n *yaml.Node, depth int) error {
+	buf := &c.buf
+	if buf.Len() > maxOutputLength {
+		return fmt.Errorf("invalid YAML: converts to more than %d MiB of JSON (line %d)", maxOutputLength>>20, n.Line)
+	}
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			buf.WriteString("null")
+			return nil
+		}
+		return c.writeNode(n.Content[0], depth)
+
+	case yaml.AliasNode:
+		target, err := c.expand(n, depth)
+		if err != nil {
+			return err
+		}
+		return c.writeNode(target, depth+1)
+
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range n.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := c.writeNode(item, depth); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+
+	case yaml.MappingNode:
+		pairs, err := c.mappingPairs(n, depth)
+		if err != nil {
+			return err
+		}
+		buf.WriteByte('{')
+		for i, p := range pairs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, _ := json.Marshal(p.key)
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := c.writeNode(p.value, depth); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case yaml.ScalarNode:
+		if n.ShortTag() == "!!timestamp" {
+			// Kept as written; JSON has no timestamps, and converting would
+			// turn a date such as 2024-01-01 into 2024-01-01T00:00:00Z
+			out, _ := json.Marshal(n.Value)
+			buf.Write(out)
+			return nil
+		}
+		var v any
+		if err := n.Decode(&v); err != nil {
+			return fmt.Errorf("invalid YAML scalar at line %d: %w", n.Line, err)
+		}
+		out, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("YAML value at line %d has no JSON equivalent: %w", n.Line, err)
+		}
+		buf.Write(out)
+		return nil
+	}
+	return fmt.Errorf("invalid YAML: unexpected node kind %d at line %d", n.Kind, n.Line)
+}
+
+type pair struct {
+	key   string
+	value *yaml.Node
+}
+
+// mappingPairs returns the entries of a mapping in order, applying "<<" merge
+// keys; explicit keys override merged ones, as in YAML 1.1
+func (c *converter) mappingPairs(n *yaml.Node, depth int) ([]pair, error) {
+	var pairs []pair
+	index := make(map[string]int)
+	set := func(key string, value *yaml.Node, override bool) {
+		if i, ok := index[key]; ok {
+			if override {
+				pairs[i].value = value
+			}
+			return
+		}
+		index[key] = len(pairs)
+		pairs = append(pairs, pair{key: key, value: value})
+	}
+
+	var merged []pair
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		k, v := n.Content[i], n.Content[i+1]
+		if k.Kind == yaml.ScalarNode && k.Tag == "!!merge" {
+			m, err := c.mergeSources(v, depth)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, m...)
+			continue
+		}
+		if k.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("invalid YAML: mapping key at line %d is not a string", k.Line)
+		}
+		set(k.Value, v, true)
+	}
+	for _, p := range merged {
+		set(p.key, p.value, false)
+	}
+	return pairs, nil
+}
+
+// mergeSources resolves the value of a "<<" key: a mapping or a list of mappings
+func (c *converter) mergeSources(v *yaml.Node, depth int) ([]pair, error) {
+	for v.Kind == yaml.AliasNode {
+		target, err := c.expand(v, depth)
+		if err != nil {
+			return nil, err
+		}
+		v, depth = target, depth+1
+	}
+	switch v.Kind {
+	case yaml.MappingNode:
+		return c.mappingPairs(v, depth)
+	case yaml.SequenceNode:
+		var all []pair
+		for _, item := range v.Content {
+			p, err := c.mergeSources(item, depth)
+			if err != nil {
+				return nil, err
+			}
+			all = append(all, p...)
+		}
+		return all, nil
+	}
+	return nil, fmt.Errorf("invalid YAML: merge key at line %d must reference a mapping", v.Line)
+}
@@ -0,0 +1,103 @@
+package yamlconv
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// aliasBomb nests lists of ten aliases to the previous level, so its last
+// level expands to 10^8 scalars
+func aliasBomb() string {
+	var b strings.Builder
+	b.WriteString("l0: &l0 [x, x, x, x, x, x, x, x, x, x]\n")
+	for i := 1; i <= 8; i++ {
+		prev := fmt.Sprintf("*l%d", i-1)
+		fmt.Fprintf(&b, "l%d: &l%d [%s%s]\n", i, i, strings.Repeat(prev+", ", 9), prev)
+	}
+	return b.String()
+}
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "keeps key order",
+			yaml: "type: object\nproperties:\n  zeta: {type: string}\n  alpha: {type: integer}\n",
+			want: `{"type":"object","properties":{"zeta":{"type":"string"},"alpha":{"type":"integer"}}}`,
+		},
+		{
+			name: "scalars",
+			yaml: "a: 1\nb: 1.5\nc: true\nd: null\ne: \"1\"\nf: [x, 2]\n",
+			want: `{"a":1,"b":1.5,"c":true,"d":null,"e":"1","f":["x",2]}`,
+		},
+		{
+			name: "aliases and merge keys",
+			yaml: "base: &base {type: string, minLength: 1}\nname:\n  <<: *base\n  minLength: 2\n",
+			want: `{"base":{"type":"string","minLength":1},"name":{"minLength":2,"type":"string"}}`,
+		},
+		{
+			name: "json is valid yaml",
+			yaml: `{"type": "array", "items": {"$ref": "#/$defs/item"}}`,
+			want: `{"type":"array","items":{"$ref":"#/$defs/item"}}`,
+		},
+		{
+			name: "timestamps keep their text",
+			yaml: "since: 2024-01-01\nat: 2001-12-14t21:59:43.10-05:00\n",
+			want: `{"since":"2024-01-01","at":"2001-12-14t21:59:43.10-05:00"}`,
+		},
+		{name: "alias bomb", yaml: aliasBomb(), wantErr: true},
+		{name: "empty", yaml: "", wantErr: true},
+		{name: "invalid", yaml: "a: [1, 2", wantErr: true},
+		{name: "non-string key", yaml: "? [a]\n: 1\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToJSON([]byte(tt.yaml))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("ToJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsYAMLPath(t *testing.T) {
+	tests := map[string]bool{
+		"./api.yaml":                           true,
+		"schemas/API.YML":                      true,
+		"https://example.com/openapi.yaml?v=2": true,
+		"https://example.com/openapi.json":     false,
+		"./user.json":                          false,
+		"https://example.com/yaml":             false,
+	}
+	for p, want := range tests {
+		if got := IsYAMLPath(p); got != want {
+			t.Errorf("IsYAMLPath(%q) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+func TestIsYAMLMediaType(t *testing.T) {
+	tests := map[string]bool{
+		"application/yaml":                  true,
+		"application/x-yaml; charset=utf-8": true,
+		"text/yaml":                         true,
+		"application/openapi+yaml":          true,
+		"application/json":                  false,
+		"application/schema+json":           false,
+		"":                                  false,
+	}
+	for ct, want := range tests {
+		if got := IsYAMLMediaType(ct); got != want {
+			t.Errorf("IsYAMLMediaType(%q) = %v, want %v", ct, got, want)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/xschemadev/xschema/examples/go
+
+go 1.22
@@ -0,0 +1,39 @@
+// XSchema Example - Go
+//
+// This example shows how to use xschema to:
+//  1. Define JSON Schema sources in config files (*.jsonc)
+//  2. Generate Go structs with Validate methods, without Node or Python
+//  3. Decode and validate data with the generated types
+//
+// Run `xschema generate` to regenerate schemas into ./xschema, then `go run .`
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/xschemadev/xschema/examples/go/xschema"
+)
+
+func main() {
+	// Generated types are named after their namespace and id
+	var profile xschema.UserProfile
+	if err := json.Unmarshal([]byte(`{"email": "ada@example.com", "age": 36}`), &profile); err != nil {
+		panic(err)
+	}
+	fmt.Println("valid profile:", profile.Validate() == nil)
+
+	// Validate reports every violation, one per line. Fields are pointers, so
+	// a missing required property is told apart from an empty one.
+	email := "nope"
+	invalid := xschema.UserProfile{Email: &email, Tags: []string{"a", "b", "c", "d", "e", "f"}}
+	fmt.Println("invalid profile:", invalid.Validate())
+
+	// Schemas looks types up by "namespace:id", e.g. for data routed at runtime
+	event := xschema.Schemas["user:Event"]()
+	data := `{"summary": "Launch", "start": "2024-01-01T10:00:00Z", "location": {"name": "HQ", "latitude": 120}}`
+	if err := json.Unmarshal([]byte(data), event); err != nil {
+		panic(err)
+	}
+	fmt.Println("event:", event.Validate())
+}
@@ -0,0 +1,157 @@
+// Code generated by xschema. DO NOT EDIT.
+// https://xschema.dev/docs
+
+package xschema
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+)
+
+// UserEvent is a scheduled event
+type UserEvent struct {
+	Attendees []UserEventAttendee `json:"attendees,omitempty"`
+	Location  *UserEventLocation  `json:"location,omitempty"`
+	Start     *string             `json:"start"`
+	Status    *string             `json:"status,omitempty"`
+	Summary   *string             `json:"summary"`
+}
+
+// Validate reports every way the value violates its schema
+func (v UserEvent) Validate() error {
+	var errs []error
+	for i0 := range v.Attendees {
+		if err := v.Attendees[i0].Validate(); err != nil {
+			nested := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				nested = joined.Unwrap()
+			}
+			for _, err := range nested {
+				errs = append(errs, fmt.Errorf("%s: %w", fmt.Sprintf("%s[%d]", "attendees", i0), err))
+			}
+		}
+	}
+	if v.Location != nil {
+		if err := (*v.Location).Validate(); err != nil {
+			nested := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				nested = joined.Unwrap()
+			}
+			for _, err := range nested {
+				errs = append(errs, fmt.Errorf("%s: %w", "location", err))
+			}
+		}
+	}
+	if v.Start == nil {
+		errs = append(errs, fmt.Errorf("%s: is required", "start"))
+	}
+	if v.Status != nil {
+		switch *v.Status {
+		case "confirmed", "tentative", "cancelled":
+		default:
+			errs = append(errs, fmt.Errorf("%s: must be one of \"confirmed\", \"tentative\", \"cancelled\"", "status"))
+		}
+	}
+	if v.Summary == nil {
+		errs = append(errs, fmt.Errorf("%s: is required", "summary"))
+	} else {
+		if utf8.RuneCountInString((*v.Summary)) < 1 {
+			errs = append(errs, fmt.Errorf("%s: must be at least 1 characters long", "summary"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type UserEventAttendee struct {
+	Email    *string `json:"email"`
+	Optional *bool   `json:"optional,omitempty"`
+}
+
+// Validate reports every way the value violates its schema
+func (v UserEventAttendee) Validate() error {
+	var errs []error
+	if v.Email == nil {
+		errs = append(errs, fmt.Errorf("%s: is required", "email"))
+	} else {
+		if !userEventPattern.MatchString((*v.Email)) {
+			errs = append(errs, fmt.Errorf("%s: must match the pattern ^[^@]+@[^@]+$", "email"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var userEventPattern = regexp.MustCompile("^[^@]+@[^@]+$")
+
+type UserEventLocation struct {
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	Name      *string  `json:"name"`
+}
+
+// Validate reports every way the value violates its schema
+func (v UserEventLocation) Validate() error {
+	var errs []error
+	if v.Latitude != nil {
+		if (*v.Latitude) < -90 {
+			errs = append(errs, fmt.Errorf("%s: must be at least -90", "latitude"))
+		}
+		if (*v.Latitude) > 90 {
+			errs = append(errs, fmt.Errorf("%s: must be at most 90", "latitude"))
+		}
+	}
+	if v.Longitude != nil {
+		if (*v.Longitude) < -180 {
+			errs = append(errs, fmt.Errorf("%s: must be at least -180", "longitude"))
+		}
+		if (*v.Longitude) > 180 {
+			errs = append(errs, fmt.Errorf("%s: must be at most 180", "longitude"))
+		}
+	}
+	if v.Name == nil {
+		errs = append(errs, fmt.Errorf("%s: is required", "name"))
+	}
+	return errors.Join(errs...)
+}
+
+type UserProfile struct {
+	Age   *int64   `json:"age,omitempty"`
+	Email *string  `json:"email"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// Validate reports every way the value violates its schema
+func (v UserProfile) Validate() error {
+	var errs []error
+	if v.Age != nil {
+		if (*v.Age) < 0 {
+			errs = append(errs, fmt.Errorf("%s: must be at least 0", "age"))
+		}
+	}
+	if v.Email == nil {
+		errs = append(errs, fmt.Errorf("%s: is required", "email"))
+	} else {
+		if !userProfilePattern.MatchString((*v.Email)) {
+			errs = append(errs, fmt.Errorf("%s: must match the pattern ^[^@]+@[^@]+$", "email"))
+		}
+	}
+	if len(v.Tags) > 5 {
+		errs = append(errs, fmt.Errorf("%s: must have at most 5 items", "tags"))
+	}
+	return errors.Join(errs...)
+}
+
+var userProfilePattern = regexp.MustCompile("^[^@]+@[^@]+$")
+
+// Validator is implemented by every generated schema type
+type Validator interface {
+	Validate() error
+}
+
+// Schemas creates an empty value of a schema's type, to decode into and
+// validate, by its "namespace:id" key
+var Schemas = map[string]func() Validator{
+	"user:Event":   func() Validator { return new(UserEvent) },
+	"user:Profile": func() Validator { return new(UserProfile) },
+}
@@ -1,5 +1,5 @@
 #!/usr/bin/env node
 import { createAdapterCLI } from "../../index.js";
-import { convert } from "./index.js";
+import { capabilities, convert } from "./index.js";
 
-createAdapterCLI(convert);
+createAdapterCLI(convert, capabilities);
@@ -1,10 +1,32 @@
-import type { ConvertInput, ConvertResult } from "../../index.js";
+import type {
+  AdapterCapabilities,
+  ConvertInput,
+  ConvertResult,
+} from "../../index.js";
 import { jsonSchemaToZod } from "json-schema-to-zod";
 
+// Keywords json-schema-to-zod turns into validation
+export const capabilities: AdapterCapabilities = {
+  drafts: ["draft-04", "draft-06", "draft-07"],
+  keywords: [
+    "type", "enum", "const", "nullable", "format",
+    "properties", "required", "additionalProperties", "patternProperties",
+    "items", "additionalItems", "minItems", "maxItems", "uniqueItems",
+    "minLength", "maxLength", "pattern",
+    "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf",
+    "allOf", "anyOf", "oneOf", "not", "if", "then", "else",
+  ],
+  // Passed through to json-schema-to-zod
+  options: ["withoutDefaults", "withoutDescribes", "depth"],
+};
+
 export function convert(input: ConvertInput): ConvertResult {
-  const { namespace, id, schema } = input;
-  const schemaCode = jsonSchemaToZod(schema);
-  const varName = `${namespace}_${id}`;
+  const { namespace, id, schema, options = {}, varName = `${namespace}_${id}` } = input;
+  const schemaCode = jsonSchemaToZod(schema, {
+    withoutDefaults: options.withoutDefaults === true,
+    withoutDescribes: options.withoutDescribes === true,
+    depth: typeof options.depth === "number" ? options.depth : undefined,
+  });
 
   return {
     namespace,
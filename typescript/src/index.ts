@@ -1,3 +1,5 @@
+import { createInterface } from "node:readline";
+
 // Core types for xschema adapters
 export interface XSchemaAdapter {
   readonly __brand: "xschema-adapter";
@@ -9,6 +11,10 @@ export interface ConvertInput {
   namespace: string;
   id: string;
   schema: object;
+  /** Adapter options from the config file and declaration; absent when none are set */
+  options?: Record<string, unknown>;
+  /** Identifier the output file declares the schema as, e.g. "user_User"; absent from older CLIs */
+  varName?: string;
 }
 
 export interface ConvertResult {
@@ -17,31 +23,136 @@ export interface ConvertResult {
   imports: string[];
   schema: string;
   type: string;
+  /** Set when this schema could not be converted; the others still are */
+  error?: string;
+  /** Non-fatal notes about the conversion, shown to the user */
+  warnings?: string[];
+}
+
+/** Adapter protocol version implemented by createAdapterCLI */
+export const PROTOCOL_VERSION = 1;
+
+/** Flag the xschema CLI passes to ask an adapter for its capabilities */
+export const CAPABILITIES_FLAG = "--xschema-capabilities";
+
+/** Flag the xschema CLI passes to start an adapter as a long-lived worker */
+export const WORKER_FLAG = "--xschema-worker";
+
+/** What an adapter supports, reported during the handshake */
+export interface AdapterCapabilities {
+  /** JSON Schema drafts, e.g. "draft-07" or "2020-12" */
+  drafts: string[];
+  /** Keywords the adapter converts; schemas using others get a warning */
+  keywords: string[];
+  /** Adapter options it accepts; schemas setting others get a warning */
+  options: string[];
+}
+
+/** One line the xschema CLI sends to a worker */
+interface WorkerRequest {
+  id: number;
+  method: "convert" | "ping";
+  inputs?: ConvertInput[];
+}
+
+/** One line a worker answers with, carrying the request's id */
+interface WorkerResponse {
+  id: number;
+  outputs?: ConvertResult[];
+  /** Set when the whole request failed */
+  error?: string;
+}
+
+function errorMessage(err: unknown): string {
+  return err instanceof Error ? err.message : String(err);
+}
+
+/** Converts a batch, reporting schemas whose convert call throws with `error` set */
+function convertAll(
+  convert: (input: ConvertInput) => ConvertResult,
+  inputs: ConvertInput[]
+): ConvertResult[] {
+  return inputs.map((input): ConvertResult => {
+    try {
+      return convert(input);
+    } catch (err) {
+      return {
+        namespace: input.namespace,
+        id: input.id,
+        imports: [],
+        schema: "",
+        type: "",
+        error: errorMessage(err),
+      };
+    }
+  });
+}
+
+/** Answers newline-delimited JSON requests on stdin until it closes */
+function runWorker(convert: (input: ConvertInput) => ConvertResult): void {
+  const lines = createInterface({ input: process.stdin, crlfDelay: Infinity });
+  lines.on("line", (line) => {
+    if (!line.trim()) return;
+
+    let request: WorkerRequest;
+    try {
+      request = JSON.parse(line);
+    } catch (err) {
+      console.error(`invalid request: ${errorMessage(err)}`);
+      return;
+    }
+
+    const response: WorkerResponse = { id: request.id };
+    switch (request.method) {
+      case "ping":
+        break;
+      case "convert":
+        response.outputs = convertAll(convert, request.inputs ?? []);
+        break;
+      default:
+        response.error = `unknown method: ${request.method}`;
+    }
+    process.stdout.write(JSON.stringify(response) + "\n");
+  });
 }
 
 /**
  * Creates a CLI handler for xschema adapters.
  * Reads JSON array of ConvertInput from stdin, calls convert for each, outputs JSON array of ConvertResult.
+ * A schema whose convert call throws is reported with `error` set instead of failing the whole batch.
+ * Run with `--xschema-capabilities`, it prints the protocol version and capabilities instead;
+ * without capabilities it only reports the protocol, and its schemas are not checked.
+ * Run with `--xschema-worker`, it stays up and answers newline-delimited JSON requests, so
+ * `xschema generate --watch` pays the startup cost once.
  *
  * @example
  * ```ts
  * #!/usr/bin/env node
  * import { createAdapterCLI } from "@xschema";
- * import { convert } from "./index";
+ * import { capabilities, convert } from "./index";
  *
- * createAdapterCLI(convert);
+ * createAdapterCLI(convert, capabilities);
  * ```
  */
 export function createAdapterCLI(
-  convert: (input: ConvertInput) => ConvertResult
+  convert: (input: ConvertInput) => ConvertResult,
+  capabilities?: AdapterCapabilities
 ): void {
+  if (process.argv.includes(CAPABILITIES_FLAG)) {
+    console.log(JSON.stringify({ protocol: PROTOCOL_VERSION, worker: true, ...capabilities }));
+    return;
+  }
+  if (process.argv.includes(WORKER_FLAG)) {
+    runWorker(convert);
+    return;
+  }
+
   const chunks: string[] = [];
   process.stdin.on("data", (chunk) => chunks.push(String(chunk)));
   process.stdin.on("end", () => {
     try {
       const inputs: ConvertInput[] = JSON.parse(chunks.join(""));
-      const outputs = inputs.map(convert);
-      console.log(JSON.stringify(outputs));
+      console.log(JSON.stringify(convertAll(convert, inputs)));
     } catch (err) {
       console.error(err instanceof Error ? err.message : err);
       process.exit(1);